@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yleoer/music/pkg/config"
+	"github.com/yleoer/music/pkg/database"
+	"github.com/yleoer/music/pkg/dirname"
+	"github.com/yleoer/music/pkg/scheduler"
+)
+
+// commands 是可以在运行中的容器里执行的子命令，例如 docker exec <容器> music-processor jobs failed
+var commands = map[string]func(cfg *config.Config, args []string, logger *log.Logger) error{
+	"jobs":    listJobs,
+	"requeue": requeueJobs,
+	"dirname": testDirNames,
+}
+
+// runCommand 执行 args[0] 对应的子命令，不是子命令时返回 false
+func runCommand(cfg *config.Config, args []string, logger *log.Logger) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		return true, fmt.Errorf("unknown command %q, available commands: jobs [state...], requeue [path...], dirname <name...>", args[0])
+	}
+	return true, command(cfg, args[1:], logger)
+}
+
+// listJobs 列出任务队列中指定状态的任务，不指定时列出全部
+func listJobs(cfg *config.Config, args []string, logger *log.Logger) error {
+	store, err := database.NewSQLiteStore(cfg.DBPath, logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	jobs, err := store.ListJobs(args...)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STATE\tPRIORITY\tATTEMPTS\tNEXT RUN\tPATH\tLAST ERROR")
+	for _, job := range jobs {
+		next := "-"
+		if job.State == database.JobQueued {
+			next = job.NextRunAt.Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\n", job.State, job.Priority, job.Attempts, next, job.Path, job.LastError)
+	}
+	return w.Flush()
+}
+
+// requeueJobs 将失败的任务重新排队，不指定路径时重新排队所有失败的任务
+func requeueJobs(cfg *config.Config, args []string, logger *log.Logger) error {
+	store, err := database.NewSQLiteStore(cfg.DBPath, logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	var paths []string
+	if len(args) == 0 {
+		jobs, err := store.ListJobs(database.JobFailed)
+		if err != nil {
+			return err
+		}
+		for _, job := range jobs {
+			paths = append(paths, job.Path)
+		}
+	}
+	for _, arg := range args {
+		path, err := filepath.Abs(arg)
+		if err != nil {
+			return err
+		}
+		job, err := store.Job(path)
+		if err != nil {
+			return err
+		}
+		if job == nil || job.State != database.JobFailed {
+			return fmt.Errorf("%s is not a failed job", path)
+		}
+		paths = append(paths, path)
+	}
+	requeued := 0
+	for _, path := range paths {
+		ok, err := store.RequeueJob(path, scheduler.PriorityManual, time.Now())
+		if err != nil {
+			return err
+		}
+		if !ok { // 检查之后已被其他进程重新排队
+			continue
+		}
+		requeued++
+		fmt.Printf("Requeued %s\n", path)
+	}
+	fmt.Printf("%d job(s) requeued.\n", requeued)
+	return nil
+}
+
+// testDirNames 用配置的目录名解析规则解析参数中的目录名 (路径只取最后一级)，显示去掉噪声后的名称、匹配的规则和各字段
+func testDirNames(cfg *config.Config, args []string, logger *log.Logger) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: dirname <name...>")
+	}
+	parser, err := dirname.NewParser(cfg.DirNameRules.Rules, cfg.DirNameRules.Noise)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, arg := range args {
+		result := parser.Parse(filepath.Base(arg))
+		fmt.Fprintf(w, "%s\n", arg)
+		fmt.Fprintf(w, "  cleaned:\t%s\n", result.Cleaned)
+		fmt.Fprintf(w, "  rule:\t%s\n", result.Rule)
+		fmt.Fprintf(w, "  artist:\t%s\n", result.Artist)
+		fmt.Fprintf(w, "  title:\t%s\n", result.Title)
+		fmt.Fprintf(w, "  year:\t%s\n", result.Year)
+		fmt.Fprintf(w, "  label:\t%s\n", result.Label)
+		fmt.Fprintf(w, "  catalog:\t%s\n", result.Catalog)
+	}
+	return w.Flush()
+}
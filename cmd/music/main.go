@@ -1,26 +1,34 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
-	"path/filepath"
+	"os/exec"
+	"os/signal"
+	"syscall"
 
-	"github.com/fsnotify/fsnotify"
 	"github.com/yleoer/music/pkg/config"
 	"github.com/yleoer/music/pkg/converter"
 	"github.com/yleoer/music/pkg/database"
+	"github.com/yleoer/music/pkg/dirname"
 	"github.com/yleoer/music/pkg/metadata"
 	"github.com/yleoer/music/pkg/parser"
+	"github.com/yleoer/music/pkg/probe"
 	"github.com/yleoer/music/pkg/processor"
 	"github.com/yleoer/music/pkg/scanner"
 	"github.com/yleoer/music/pkg/scheduler"
-	"github.com/yleoer/music/pkg/util"
+	"github.com/yleoer/music/pkg/sidecar"
+	"github.com/yleoer/music/pkg/watcher"
 )
 
 func main() {
 	// 1. 初始化日志器
 	logger := log.New(os.Stdout, "[MusicProcessor] ", log.LstdFlags|log.Lshortfile)
 	logger.Println("Starting Music Processor application...")
+	// SIGINT/SIGTERM (docker stop) 时取消 ctx，进入优雅退出流程
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 	// 2. 加载配置
 	cfg, err := config.LoadConfig()
 	if err != nil {
@@ -28,6 +36,13 @@ func main() {
 	}
 	logger.Printf("Configuration loaded: DownloadDir=%s, MusicLibDir=%s, DataDir=%s, DBPath=%s",
 		cfg.DownloadDir, cfg.MusicLibDir, cfg.DataDir, cfg.DBPath)
+	// 带参数时执行子命令 (查看或重新排队任务) 后退出
+	if handled, err := runCommand(cfg, os.Args[1:], logger); handled {
+		if err != nil {
+			logger.Fatalf("Command failed: %v", err)
+		}
+		return
+	}
 	// 3. 初始化所有依赖服务
 	// 3.1 繁简体转换器
 	t2sConverter, err := converter.NewOpenCCConverter(logger)
@@ -39,81 +54,91 @@ func main() {
 	if err != nil {
 		logger.Fatalf("Failed to initialize database: %v", err)
 	}
-	defer dbStore.Close()
 	// 3.3 元数据获取器
-	metaFetcher := metadata.NewNeteaseClient(cfg.NeteaseAPI, cfg.HTTPTimeout, logger)
-	// 3.4 CUE 文件解析器 (依赖于 TextConverter)
-	cueParser := parser.NewCueParser(t2sConverter, logger)
-	// 3.5 专辑扫描器 (依赖于 CueParser 和 TextConverter)
-	albumScanner := scanner.NewAlbumScanner(cueParser, t2sConverter, logger)
-	// 3.6 FFmpeg 处理器 (依赖于 MetadataFetcher, Config)
-	ffmpegProcessor := processor.NewFFmpegProcessor(cfg.FFmpegPath, logger)
+	metaFetcher := metadata.NewNeteaseClient(cfg.NeteaseAPI, cfg.HTTPTimeout, cfg.MetadataRequestGap, logger)
+	// 3.4 CUE 文件解析器 (依赖于 TextConverter 和读取镜像参数的 Prober)
+	prober := probe.NewProber(cfg.FFprobePath, logger)
+	cueParser := parser.NewCueParser(t2sConverter, prober, logger)
+	// 3.5 专辑扫描器 (依赖于 CueParser、旁注文件和目录名的解析器以及 TextConverter)
+	sidecars, err := sidecar.NewParsers(cfg.SidecarRules)
+	if err != nil {
+		logger.Fatalf("Invalid sidecar rules in %s: %v", cfg.SidecarRulesFile, err)
+	}
+	dirNames, err := dirname.NewParser(cfg.DirNameRules.Rules, cfg.DirNameRules.Noise)
+	if err != nil {
+		logger.Fatalf("Invalid directory name rules in %s: %v", cfg.DirNameRulesFile, err)
+	}
+	albumScanner := scanner.NewAlbumScanner(cueParser, sidecars, dirNames, t2sConverter, logger)
+	// 3.6 专辑处理器 (FFmpeg 或纯 Go 实现，依赖于 Config 中的输出配置)
+	outputs, err := processor.ResolveOutputs(cfg)
+	if err != nil {
+		logger.Fatalf("Invalid output configuration: %v", err)
+	}
+	opts := processor.Options{
+		Workers:           cfg.TranscodeWorkers,
+		AcceptPartial:     cfg.FailurePolicy == config.FailurePartial,
+		CoverMaxDimension: cfg.CoverMaxDimension,
+		CoverMaxBytes:     cfg.CoverMaxBytes,
+		WriteCoverFile:    cfg.WriteCoverFile,
+		Progress:          dbStore,
+	}
+	// 有损输出的时长只能通过 ffprobe 读取，找不到 ffprobe 时 (NewProber 已给出警告) 只检查输出非空
+	if _, err := exec.LookPath(cfg.FFprobePath); err == nil {
+		opts.Prober = probe.NewFFprobeProber(cfg.FFprobePath)
+	}
+	// 只有 retry 策略才在处理器内部重试失败的音轨
+	if cfg.FailurePolicy == config.FailureRetry {
+		opts.Retries = cfg.TrackRetries
+	}
+	var albumProcessor processor.Processor
+	switch cfg.Processor {
+	case config.ProcessorNative:
+		albumProcessor, err = processor.NewNativeProcessor(outputs, opts, logger)
+		if err != nil {
+			logger.Fatalf("Failed to initialize native processor: %v", err)
+		}
+	default:
+		albumProcessor = processor.NewFFmpegProcessor(cfg.FFmpegPath, outputs, opts, logger)
+	}
+	for _, o := range outputs {
+		logger.Printf("Output: profile=%s, library=%s", o.Profile.Name, o.LibraryDir)
+	}
+	logger.Printf("Library path template: %s", cfg.PathTemplate)
+	logger.Printf("Using %s album processor with %d album workers and %d transcode workers per album, failure policy %s.",
+		cfg.Processor, cfg.AlbumWorkers, cfg.TranscodeWorkers, cfg.FailurePolicy)
 	// 4. 初始化任务调度器
 	taskScheduler := scheduler.NewTaskScheduler(
+		ctx,
 		cfg,
 		dbStore,
 		albumScanner,
-		ffmpegProcessor,
+		albumProcessor,
 		metaFetcher,
 		logger,
 	)
-	// 5. 执行初始扫描
+	// 5. 恢复任务队列并执行初始扫描
+	taskScheduler.Start()
 	taskScheduler.InitialScan(cfg.DownloadDir)
-	// 6. 启动文件系统监听器 (fsnotify 监听器现在只关注一级目录的事件)
-	watcher, err := fsnotify.NewWatcher()
+	// 6. 启动文件系统监听器，递归监听下载目录，新建的子目录也会加入监听
+	dirWatcher, err := watcher.NewDirWatcher(cfg.DownloadDir, cfg.ScanMaxDepth, taskScheduler.TriggerScan, logger)
 	if err != nil {
-		logger.Fatalf("Error creating file watcher: %v", err)
+		logger.Fatalf("Failed to start file watcher: %v", err)
 	}
-	defer watcher.Close()
-	if err := watcher.Add(cfg.DownloadDir); err != nil {
-		logger.Fatalf("Error adding download root path %s to watcher: %v", cfg.DownloadDir, err)
-	}
-	logger.Printf("Monitoring download directory %s for new top-level subdirectories...", cfg.DownloadDir)
+	logger.Printf("Monitoring download directory %s for albums up to %d level(s) deep...", cfg.DownloadDir, cfg.ScanMaxDepth)
 	// 7. 处理文件系统事件
-	go func() {
-		for {
-			select {
-			case event, ok := <-watcher.Events:
-				if !ok {
-					return
-				}
-				logger.Printf("Watcher event: %s, on %s", event.Op.String(), event.Name)
-				// 仅关注下载根目录下的直接子目录事件
-				// 1. 新建顶级目录
-				if event.Op&fsnotify.Create == fsnotify.Create && filepath.Dir(event.Name) == cfg.DownloadDir {
-					if util.IsDirectory(event.Name) {
-						logger.Printf("  -> New top-level directory created: %s. Scheduling scan.", event.Name)
-						// 即使是新创建的目录，也检查是否已处理（可能上次创建失败后被复用）
-						// taskScheduler 内部会处理重复扫描和已处理标记
-						taskScheduler.TriggerScan(event.Name)
-						continue
-					}
-				}
-				// 2. 顶级目录内的文件变化 或 顶级目录本身被修改
-				albumPathCandidate := event.Name
-				// 如果event.Name是文件，我们关注它所在的父目录
-				if !util.IsDirectory(event.Name) {
-					albumPathCandidate = filepath.Dir(event.Name)
-				}
-				// 且这个父目录必须是下载根目录的直接子目录
-				if filepath.Dir(albumPathCandidate) == cfg.DownloadDir {
-					logger.Printf("  -> File/directory change detected in top-level album candidate: %s. Scheduling rescan.", albumPathCandidate)
-					taskScheduler.TriggerScan(albumPathCandidate)
-				} else if albumPathCandidate == cfg.DownloadDir {
-					// 下载根目录本身被修改（例如添加文件），忽略，因为我们只关注子目录
-					logger.Printf("  -> Download root directory %s itself changed. Ignoring.", cfg.DownloadDir)
-				} else {
-					logger.Printf("  -> Event %s not in a direct album directory. Ignoring.", event.Name)
-				}
-			case err, ok := <-watcher.Errors:
-				if !ok {
-					return
-				}
-				logger.Printf("ERROR: Watcher error: %v", err)
-			}
-		}
-	}()
-	// 保持主Goroutine运行
+	go dirWatcher.Run(ctx)
+	// 保持主Goroutine运行，直到收到退出信号
 	logger.Println("Application is running. Press Ctrl+C to exit.")
-	<-make(chan struct{})
+	<-ctx.Done()
+	stop() // 再次收到信号时按默认行为立即退出
+	logger.Println("Shutdown signal received, stopping...")
+	// 8. 先停止监听和调度，等待正在处理的专辑完成或回滚，最后关闭数据库
+	if err := dirWatcher.Close(); err != nil {
+		logger.Printf("WARN: Error closing file watcher: %v", err)
+	}
+	taskScheduler.Shutdown(cfg.ShutdownGracePeriod)
+	if err := dbStore.Close(); err != nil {
+		logger.Printf("ERROR: Error closing database: %v", err)
+	}
+	logger.Println("Music Processor stopped.")
 }
@@ -4,33 +4,123 @@ import "time"
 
 // Album 代表一张完整的专辑信息
 type Album struct {
-	Path        string // 专辑根目录
-	Artist      string
-	Title       string
-	Year        string
-	CoverArt    string  // 封面图片路径
-	Discs       []*Disc // 专辑包含的光盘
-	InfoContent string  // Info.txt 的内容
+	Path          string // 专辑根目录
+	Artist        string
+	Title         string
+	Year          string
+	CoverArt      string  // 封面图片路径，CoverEmbedded 时为内嵌封面的音频文件
+	CoverEmbedded bool    // CoverArt 是内嵌了封面的源音频文件 (FLAC/APE 等)，处理时从中提取
+	Discs         []*Disc // 专辑包含的光盘
+	InfoContent   string  // Info.txt 的内容
+
+	// 从 Info.txt、.nfo、JSON 等旁注文件中提取的信息
+	ReleaseDate string           // 发行日期，保留原文，如 "1998年5月1日"
+	Label       string           // 厂牌或唱片公司
+	Catalog     string           // 唱片编号，如 "VICL-60185"
+	Genre       string           // 流派
+	Tracklist   []TracklistEntry // 曲目表，用于补全 CUE 或文件名中缺失的音轨信息
+}
+
+// TracklistEntry 是旁注文件曲目表中的一项，Disc 为 0 表示曲目表没有区分光盘
+type TracklistEntry struct {
+	Disc   int
+	Number int
+	Artist string
+	Title  string
+}
+
+// LookupTracklist 查找曲目表中指定光盘和音轨号的条目，没有区分光盘的条目只对应第一张光盘。
+// 光盘编号必须是最终的编号 (见 scanner 的 numberDiscs)
+func (a *Album) LookupTracklist(disc, number int) (TracklistEntry, bool) {
+	for _, entry := range a.Tracklist {
+		if entry.Number == number && (entry.Disc == disc || entry.Disc == 0 && disc <= 1) {
+			return entry, true
+		}
+	}
+	return TracklistEntry{}, false
 }
 
 // Disc 代表一张光盘
 type Disc struct {
 	DiscNumber int
-	CuePath    string
-	WavPath    string
+	TotalDiscs int      // 整套专辑的光盘数，可能多于本次扫描到的光盘
+	CuePath    string   // 已分轨的专辑为空
+	ImagePath  string   // 第一个 FILE 对应的音频镜像 (WAV/FLAC/APE/WV/TTA 等)，已分轨的专辑为第一首音轨的文件
+	Files      []string // CUE 中引用的全部音频文件，按出现顺序；已分轨的专辑为各音轨的文件
 	Tracks     []*Track
+
+	// CUE 中记录的文件名 -> 实际使用的文件，例如 CUE 写的是 album.wav 而磁盘上只有 album.flac
+	Substitutions map[string]string
+
+	// CUE 中光盘级的命令
+	Catalog    string            // CATALOG (UPC/EAN)
+	Title      string            // 光盘级 TITLE
+	Performer  string            // 光盘级 PERFORMER
+	Songwriter string            // 光盘级 SONGWRITER
+	Genre      string            // REM GENRE
+	Date       string            // REM DATE
+	DiscID     string            // REM DISCID
+	Comment    string            // REM COMMENT
+	Rem        map[string]string // 全部 REM 字段，键为大写，如 REPLAYGAIN_ALBUM_GAIN
+}
+
+// FramesPerSecond 是 CD 每秒的帧 (扇区) 数，CUE 中 MM:SS:FF 的 FF 即以此为单位
+const FramesPerSecond = 75
+
+// CDSampleRate 是 CD 音频的采样率，无法读取音频参数时以此为默认值
+const CDSampleRate = 44100
+
+// Frames 是以 CD 帧 (1/75 秒) 为单位的位置或长度，可以无损地表示 CUE 中的任意时间
+type Frames int64
+
+// Samples 将帧数换算为指定采样率下的采样数。44100/48000/88200/96000/192000 等常见采样率都能被 75 整除，结果是精确的
+func (f Frames) Samples(sampleRate int) int64 {
+	return int64(f) * int64(sampleRate) / FramesPerSecond
+}
+
+// Duration 将帧数换算为时间，仅用于显示
+func (f Frames) Duration() time.Duration {
+	return time.Duration(f) * time.Second / FramesPerSecond
+}
+
+// Index 代表 CUE 中的一个 INDEX 点。多 FILE 的 CUE 中，同一音轨的 INDEX 可能位于不同文件
+type Index struct {
+	File   string // INDEX 所在的 FILE
+	Offset Frames // 在该文件中的位置
 }
 
 // Track 代表一个音轨
 type Track struct {
-	Number      int
-	Title       string
-	Artist      string // 可能是合唱，所以每个轨道都保留
-	StartTime   time.Duration
-	EndTime     time.Duration
-	Album       string // 反向引用
-	AlbumArtist string // 专辑艺术家
-	Year        string
+	Number        int
+	DiscNumber    int // 所在光盘的编号
+	TotalDiscs    int // 整套专辑的光盘数
+	Title         string
+	Artist        string // 可能是合唱，所以每个轨道都保留
+	SourcePath    string // 切割该音轨所用的音频文件
+	SampleRate    int    // SourcePath 的采样率
+	BitsPerSample int    // SourcePath 的位深，未知时为 0
+	Channels      int    // SourcePath 的声道数，未知时为 0
+	StartSample   int64  // 在 SourcePath 中的起始采样 (包含)
+	EndSample     int64  // 在 SourcePath 中的结束采样 (不包含)，0 表示镜像长度未知或不精确，切割到文件结尾
+	Album         string // 反向引用
+	AlbumArtist   string // 专辑艺术家
+	Year          string
+
+	// CUE 和文件标签都没有提供标题或艺术家时为 true：Title 取自文件名或按音轨号生成，Artist 取自文件名或沿用专辑艺术家。
+	// 扫描器确定光盘编号后用旁注文件曲目表中对应的条目替换
+	GuessedTitle  bool
+	GuessedArtist bool
+
+	// CUE 中音轨级的命令
+	Songwriter string
+	ISRC       string
+	Flags      []string      // FLAGS，如 DCP、4CH、PRE、SCMS
+	Pregap     Frames        // PREGAP，不包含在音频文件中的静音
+	Postgap    Frames        // POSTGAP
+	Indexes    map[int]Index // INDEX 编号 -> 位置
+	Genre      string
+	Comment    string
+	Rem        map[string]string // REM 字段，音轨级覆盖光盘级，如 REPLAYGAIN_TRACK_GAIN
 
 	// 从网络获取的元数据
 	OnlineID int    // 网易云音乐 ID
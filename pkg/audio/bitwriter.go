@@ -0,0 +1,53 @@
+package audio
+
+// bitWriter 按大端位序向缓冲区写入任意位宽的整数
+type bitWriter struct {
+	buf   []byte
+	acc   uint64 // 尚未写出的位
+	nbits uint   // acc 中有效位数
+}
+
+// writeBits 写入 v 的低 n 位 (n <= 32)
+func (w *bitWriter) writeBits(v uint64, n uint) {
+	if n == 0 {
+		return
+	}
+	w.acc = w.acc<<n | v&(1<<n-1)
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.nbits -= 8
+		w.buf = append(w.buf, byte(w.acc>>w.nbits))
+	}
+}
+
+// writeSigned 以 n 位二进制补码写入 v
+func (w *bitWriter) writeSigned(v int64, n uint) {
+	w.writeBits(uint64(v), n)
+}
+
+// writeUnary 写入 q 个 0 和一个结束的 1
+func (w *bitWriter) writeUnary(q uint64) {
+	for q >= 32 {
+		w.writeBits(0, 32)
+		q -= 32
+	}
+	w.writeBits(1, uint(q)+1)
+}
+
+// alignByte 用 0 填充到字节边界
+func (w *bitWriter) alignByte() {
+	if w.nbits > 0 {
+		w.writeBits(0, 8-w.nbits)
+	}
+}
+
+// bytes 返回已写出的完整字节
+func (w *bitWriter) bytes() []byte {
+	return w.buf
+}
+
+// reset 清空缓冲区以便复用
+func (w *bitWriter) reset() {
+	w.buf = w.buf[:0]
+	w.acc, w.nbits = 0, 0
+}
@@ -0,0 +1,498 @@
+package audio
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/bits"
+)
+
+const (
+	flacBlockSize      = 4096
+	flacMaxFixedOrder  = 4
+	flacMaxRiceParam   = 14 // 4 位 Rice 参数中 15 表示 escape
+	flacMaxPartitionOr = 6
+	flacVendor         = "music flac encoder"
+)
+
+// FLAC 元数据块类型
+const (
+	flacBlockStreamInfo    = 0
+	flacBlockVorbisComment = 4
+	flacBlockPicture       = 6
+)
+
+// Picture 是写入 FLAC PICTURE 块的图片
+type Picture struct {
+	Type        int // ID3v2 APIC 图片类型，3 为封面
+	MIMEType    string
+	Description string
+	Width       int
+	Height      int
+	Depth       int // 每像素位数
+	Data        []byte
+}
+
+// EncodeFLAC 将 src 中 totalSamples 个交错 PCM 采样帧 (WAV data 块格式，小端) 编码为 FLAC 写入 dst，
+// comments 为 "KEY=value" 形式的 Vorbis comment。编码完成后回写 STREAMINFO 中的帧大小和 MD5
+func EncodeFLAC(dst io.WriteSeeker, src io.Reader, format Format, totalSamples int64, comments []string, pictures []Picture) error {
+	switch format.BitsPerSample {
+	case 8, 16, 24:
+	default:
+		return fmt.Errorf("unsupported bits per sample for FLAC encoding: %d", format.BitsPerSample)
+	}
+	if format.Channels < 1 || format.Channels > 8 {
+		return fmt.Errorf("unsupported channel count for FLAC encoding: %d", format.Channels)
+	}
+
+	start, err := dst.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(dst)
+	enc := &flacEncoder{format: format, totalSamples: totalSamples, md5: md5.New()}
+	if err := enc.writeHeader(out, comments, pictures); err != nil {
+		return err
+	}
+
+	bytesPerSample := format.BitsPerSample / 8
+	blockAlign := format.BlockAlign()
+	raw := make([]byte, flacBlockSize*blockAlign)
+	channels := make([][]int32, format.Channels)
+	for ch := range channels {
+		channels[ch] = make([]int32, flacBlockSize)
+	}
+	remaining := totalSamples
+	for frameNumber := uint64(0); remaining > 0; frameNumber++ {
+		n := int64(flacBlockSize)
+		if remaining < n {
+			n = remaining
+		}
+		chunk := raw[:n*int64(blockAlign)]
+		if _, err := io.ReadFull(src, chunk); err != nil {
+			return fmt.Errorf("failed to read PCM samples: %w", err)
+		}
+		for i := 0; i < int(n); i++ {
+			for ch := range channels {
+				channels[ch][i] = decodePCMSample(chunk[(i*format.Channels+ch)*bytesPerSample:], bytesPerSample)
+			}
+		}
+		// FLAC 的 MD5 基于有符号小端采样，16/24 位 WAV 的原始字节即是如此，8 位 WAV 为无符号需要转换
+		if bytesPerSample == 1 {
+			signed := make([]byte, len(chunk))
+			for i, b := range chunk {
+				signed[i] = b - 128
+			}
+			enc.md5.Write(signed)
+		} else {
+			enc.md5.Write(chunk)
+		}
+		frame := enc.encodeFrame(channels, int(n), frameNumber)
+		if _, err := out.Write(frame); err != nil {
+			return err
+		}
+		remaining -= n
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	return enc.patchStreamInfo(dst, start)
+}
+
+// decodePCMSample 将小端 PCM 采样转换为有符号整数，8 位 WAV 是无符号的
+func decodePCMSample(b []byte, bytesPerSample int) int32 {
+	switch bytesPerSample {
+	case 1:
+		return int32(b[0]) - 128
+	case 2:
+		return int32(int16(binary.LittleEndian.Uint16(b)))
+	default:
+		return int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+	}
+}
+
+type flacEncoder struct {
+	format       Format
+	totalSamples int64
+	md5          hash.Hash
+	minFrameSize int
+	maxFrameSize int
+	bw           bitWriter
+	residual     []int64
+}
+
+// writeHeader 写出 "fLaC" 标记和全部元数据块，STREAMINFO 中的帧大小和 MD5 先以 0 占位
+func (e *flacEncoder) writeHeader(w io.Writer, comments []string, pictures []Picture) error {
+	if _, err := w.Write([]byte("fLaC")); err != nil {
+		return err
+	}
+	blocks := [][]byte{e.streamInfo([16]byte{})}
+	types := []byte{flacBlockStreamInfo}
+	blocks = append(blocks, vorbisCommentBlock(comments))
+	types = append(types, flacBlockVorbisComment)
+	for _, pic := range pictures {
+		blocks = append(blocks, pictureBlock(pic))
+		types = append(types, flacBlockPicture)
+	}
+	for i, block := range blocks {
+		if len(block) >= 1<<24 {
+			return errors.New("FLAC metadata block too large")
+		}
+		header := []byte{types[i], byte(len(block) >> 16), byte(len(block) >> 8), byte(len(block))}
+		if i == len(blocks)-1 {
+			header[0] |= 0x80
+		}
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		if _, err := w.Write(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *flacEncoder) streamInfo(sum [16]byte) []byte {
+	info := make([]byte, 34)
+	binary.BigEndian.PutUint16(info[0:2], flacBlockSize)
+	binary.BigEndian.PutUint16(info[2:4], flacBlockSize)
+	putUint24(info[4:7], e.minFrameSize)
+	putUint24(info[7:10], e.maxFrameSize)
+	packed := uint64(e.format.SampleRate)<<44 |
+		uint64(e.format.Channels-1)<<41 |
+		uint64(e.format.BitsPerSample-1)<<36 |
+		uint64(e.totalSamples)&0xfffffffff
+	binary.BigEndian.PutUint64(info[10:18], packed)
+	copy(info[18:34], sum[:])
+	return info
+}
+
+// patchStreamInfo 回写 STREAMINFO (位于 "fLaC" 和 4 字节块头之后)
+func (e *flacEncoder) patchStreamInfo(dst io.WriteSeeker, start int64) error {
+	end, err := dst.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	var sum [16]byte
+	copy(sum[:], e.md5.Sum(nil))
+	if _, err := dst.Seek(start+8, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := dst.Write(e.streamInfo(sum)); err != nil {
+		return err
+	}
+	_, err = dst.Seek(end, io.SeekStart)
+	return err
+}
+
+func vorbisCommentBlock(comments []string) []byte {
+	block := binary.LittleEndian.AppendUint32(nil, uint32(len(flacVendor)))
+	block = append(block, flacVendor...)
+	block = binary.LittleEndian.AppendUint32(block, uint32(len(comments)))
+	for _, c := range comments {
+		block = binary.LittleEndian.AppendUint32(block, uint32(len(c)))
+		block = append(block, c...)
+	}
+	return block
+}
+
+func pictureBlock(pic Picture) []byte {
+	block := binary.BigEndian.AppendUint32(nil, uint32(pic.Type))
+	block = binary.BigEndian.AppendUint32(block, uint32(len(pic.MIMEType)))
+	block = append(block, pic.MIMEType...)
+	block = binary.BigEndian.AppendUint32(block, uint32(len(pic.Description)))
+	block = append(block, pic.Description...)
+	block = binary.BigEndian.AppendUint32(block, uint32(pic.Width))
+	block = binary.BigEndian.AppendUint32(block, uint32(pic.Height))
+	block = binary.BigEndian.AppendUint32(block, uint32(pic.Depth))
+	block = binary.BigEndian.AppendUint32(block, 0) // 非索引色图片
+	block = binary.BigEndian.AppendUint32(block, uint32(len(pic.Data)))
+	return append(block, pic.Data...)
+}
+
+func putUint24(b []byte, v int) {
+	b[0], b[1], b[2] = byte(v>>16), byte(v>>8), byte(v)
+}
+
+// encodeFrame 编码一个固定块大小的音频帧，各声道独立编码
+func (e *flacEncoder) encodeFrame(channels [][]int32, blockSize int, frameNumber uint64) []byte {
+	bw := &e.bw
+	bw.reset()
+
+	// 帧头
+	bw.writeBits(0xFFF8, 16) // 同步码 + 固定块大小
+	blockSizeCode := uint64(0x7)
+	if blockSize == flacBlockSize {
+		blockSizeCode = 0xC
+	}
+	bw.writeBits(blockSizeCode, 4)
+	bw.writeBits(sampleRateCode(e.format.SampleRate), 4)
+	bw.writeBits(uint64(e.format.Channels-1), 4)
+	bw.writeBits(sampleSizeCode(e.format.BitsPerSample), 3)
+	bw.writeBits(0, 1)
+	for _, b := range utf8Uint(frameNumber) {
+		bw.writeBits(uint64(b), 8)
+	}
+	if blockSizeCode == 0x7 {
+		bw.writeBits(uint64(blockSize-1), 16)
+	}
+	bw.writeBits(uint64(crc8(bw.bytes())), 8)
+
+	// 子帧
+	for _, samples := range channels {
+		e.encodeSubframe(samples[:blockSize])
+	}
+
+	// 帧尾
+	bw.alignByte()
+	bw.writeBits(uint64(crc16(bw.bytes())), 16)
+
+	frame := bw.bytes()
+	if e.minFrameSize == 0 || len(frame) < e.minFrameSize {
+		e.minFrameSize = len(frame)
+	}
+	if len(frame) > e.maxFrameSize {
+		e.maxFrameSize = len(frame)
+	}
+	return frame
+}
+
+// encodeSubframe 在 CONSTANT、VERBATIM 和 0-4 阶 FIXED 预测中选择编码后最小的一种
+func (e *flacEncoder) encodeSubframe(samples []int32) {
+	bw := &e.bw
+	bps := uint(e.format.BitsPerSample)
+
+	constant := true
+	for _, s := range samples[1:] {
+		if s != samples[0] {
+			constant = false
+			break
+		}
+	}
+	if constant {
+		bw.writeBits(0x00, 8)
+		bw.writeSigned(int64(samples[0]), bps)
+		return
+	}
+
+	bestOrder, bestCost, bestParams, bestPartitionOrder := -1, uint64(len(samples))*uint64(bps), []int(nil), 0
+	for order := 0; order <= flacMaxFixedOrder && order < len(samples); order++ {
+		residual := fixedResidual(samples, order, e.residual[:0])
+		e.residual = residual
+		partitionOrder, params, cost := chooseRiceParams(residual, len(samples), order)
+		cost += uint64(order) * uint64(bps)
+		if cost < bestCost {
+			bestOrder, bestCost, bestParams, bestPartitionOrder = order, cost, params, partitionOrder
+		}
+	}
+
+	if bestOrder < 0 {
+		bw.writeBits(0x02, 8) // VERBATIM
+		for _, s := range samples {
+			bw.writeSigned(int64(s), bps)
+		}
+		return
+	}
+
+	bw.writeBits(uint64(0x08|bestOrder)<<1, 8) // FIXED，无 wasted bits
+	for _, s := range samples[:bestOrder] {
+		bw.writeSigned(int64(s), bps)
+	}
+	residual := fixedResidual(samples, bestOrder, e.residual[:0])
+	e.residual = residual
+	bw.writeBits(0, 2) // 4 位 Rice 参数
+	bw.writeBits(uint64(bestPartitionOrder), 4)
+	partitions := 1 << bestPartitionOrder
+	partitionSize := len(samples) >> bestPartitionOrder
+	pos := 0
+	for p := 0; p < partitions; p++ {
+		n := partitionSize
+		if p == 0 {
+			n -= bestOrder
+		}
+		k := uint(bestParams[p])
+		bw.writeBits(uint64(k), 4)
+		for _, r := range residual[pos : pos+n] {
+			u := zigzag(r)
+			bw.writeUnary(u >> k)
+			bw.writeBits(u, k)
+		}
+		pos += n
+	}
+}
+
+// fixedResidual 计算 FIXED 预测的残差，长度为 len(samples)-order
+func fixedResidual(samples []int32, order int, dst []int64) []int64 {
+	s := func(i int) int64 { return int64(samples[i]) }
+	for i := order; i < len(samples); i++ {
+		switch order {
+		case 0:
+			dst = append(dst, s(i))
+		case 1:
+			dst = append(dst, s(i)-s(i-1))
+		case 2:
+			dst = append(dst, s(i)-2*s(i-1)+s(i-2))
+		case 3:
+			dst = append(dst, s(i)-3*s(i-1)+3*s(i-2)-s(i-3))
+		case 4:
+			dst = append(dst, s(i)-4*s(i-1)+6*s(i-2)-4*s(i-3)+s(i-4))
+		}
+	}
+	return dst
+}
+
+// chooseRiceParams 选择代价最小的分区阶数及每个分区的 Rice 参数，返回估算的残差编码位数
+func chooseRiceParams(residual []int64, blockSize, order int) (int, []int, uint64) {
+	bestOrder, bestParams, bestCost := 0, []int(nil), ^uint64(0)
+	for partitionOrder := 0; partitionOrder <= flacMaxPartitionOr; partitionOrder++ {
+		partitions := 1 << partitionOrder
+		if blockSize%partitions != 0 || blockSize/partitions <= order {
+			break
+		}
+		params := make([]int, partitions)
+		cost := uint64(6) // 编码方式 + 分区阶数
+		pos := 0
+		for p := 0; p < partitions; p++ {
+			n := blockSize / partitions
+			if p == 0 {
+				n -= order
+			}
+			k, bitsUsed := bestRiceParam(residual[pos : pos+n])
+			params[p] = k
+			cost += 4 + bitsUsed
+			pos += n
+		}
+		if cost < bestCost {
+			bestOrder, bestParams, bestCost = partitionOrder, params, cost
+		}
+	}
+	return bestOrder, bestParams, bestCost
+}
+
+// bestRiceParam 以均值估算 Rice 参数，并在相邻参数中取实际位数最少者
+func bestRiceParam(residual []int64) (int, uint64) {
+	if len(residual) == 0 {
+		return 0, 0
+	}
+	var sum uint64
+	for _, r := range residual {
+		sum += zigzag(r)
+	}
+	mean := sum / uint64(len(residual))
+	estimate := 0
+	if mean > 0 {
+		estimate = min(bits.Len64(mean)-1, flacMaxRiceParam)
+	}
+	bestK, bestBits := 0, ^uint64(0)
+	for k := estimate - 1; k <= estimate+1; k++ {
+		if k < 0 || k > flacMaxRiceParam {
+			continue
+		}
+		total := uint64(len(residual)) * uint64(k+1)
+		for _, r := range residual {
+			total += zigzag(r) >> uint(k)
+		}
+		if total < bestBits {
+			bestK, bestBits = k, total
+		}
+	}
+	return bestK, bestBits
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func sampleRateCode(rate int) uint64 {
+	switch rate {
+	case 88200:
+		return 0x1
+	case 176400:
+		return 0x2
+	case 192000:
+		return 0x3
+	case 8000:
+		return 0x4
+	case 16000:
+		return 0x5
+	case 22050:
+		return 0x6
+	case 24000:
+		return 0x7
+	case 32000:
+		return 0x8
+	case 44100:
+		return 0x9
+	case 48000:
+		return 0xA
+	case 96000:
+		return 0xB
+	default:
+		return 0x0 // 从 STREAMINFO 读取
+	}
+}
+
+func sampleSizeCode(bps int) uint64 {
+	switch bps {
+	case 8:
+		return 0x1
+	case 16:
+		return 0x4
+	case 24:
+		return 0x6
+	default:
+		return 0x0
+	}
+}
+
+// utf8Uint 以 FLAC 帧头使用的类 UTF-8 方式编码帧号
+func utf8Uint(v uint64) []byte {
+	if v < 0x80 {
+		return []byte{byte(v)}
+	}
+	n := 2
+	for v >= 1<<(5*n+1) {
+		n++
+	}
+	out := make([]byte, n)
+	for i := n - 1; i > 0; i-- {
+		out[i] = 0x80 | byte(v&0x3F)
+		v >>= 6
+	}
+	out[0] = byte(0xFF<<(8-n)) | byte(v)
+	return out
+}
+
+func crc8(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,310 @@
+package audio
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yleoer/music/pkg/tag"
+)
+
+// bitReader 按大端位序读取 FLAC 帧
+type bitReader struct {
+	data []byte
+	pos  int // 位偏移
+}
+
+func (r *bitReader) readBits(n int) uint64 {
+	var v uint64
+	for i := 0; i < n; i++ {
+		bit := r.data[r.pos/8] >> (7 - r.pos%8) & 1
+		v = v<<1 | uint64(bit)
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) readSigned(n int) int64 {
+	v := r.readBits(n)
+	return int64(v<<(64-n)) >> (64 - n)
+}
+
+func (r *bitReader) readUnary() uint64 {
+	var q uint64
+	for r.readBits(1) == 0 {
+		q++
+	}
+	return q
+}
+
+func (r *bitReader) alignByte() {
+	r.pos = (r.pos + 7) / 8 * 8
+}
+
+// decodeFLACFrames 解码 EncodeFLAC 产生的音频帧 (CONSTANT、VERBATIM、FIXED 子帧)，
+// 返回与 WAV data 块格式相同的 PCM 数据以及按 FLAC 规范计算的 MD5
+func decodeFLACFrames(t *testing.T, data []byte, format Format) ([]byte, [16]byte, []int) {
+	t.Helper()
+	var pcm []byte
+	var frameSizes []int
+	sum := md5.New()
+	bytesPerSample := format.BitsPerSample / 8
+	r := &bitReader{data: data}
+	for frame := uint64(0); r.pos/8 < len(data); frame++ {
+		start := r.pos / 8
+		if sync := r.readBits(16); sync != 0xFFF8 {
+			t.Fatalf("frame %d: bad sync code 0x%04x", frame, sync)
+		}
+		blockSizeCode := r.readBits(4)
+		r.readBits(4) // 采样率
+		if channels := int(r.readBits(4)) + 1; channels != format.Channels {
+			t.Fatalf("frame %d: %d channels, want %d", frame, channels, format.Channels)
+		}
+		r.readBits(4) // 位深 + 保留位
+		number := r.readBits(8)
+		if n := bits.LeadingZeros8(^uint8(number)); n > 0 { // 前导 1 的个数即编码的字节数
+			number &= 0xFF >> (n + 1)
+			for i := 1; i < n; i++ {
+				number = number<<6 | r.readBits(8)&0x3F
+			}
+		}
+		if number != frame {
+			t.Fatalf("frame number %d, want %d", number, frame)
+		}
+		blockSize := flacBlockSize
+		switch blockSizeCode {
+		case 0xC:
+		case 0x7:
+			blockSize = int(r.readBits(16)) + 1
+		default:
+			t.Fatalf("frame %d: unexpected block size code 0x%x", frame, blockSizeCode)
+		}
+		if crc := byte(r.readBits(8)); crc != crc8(data[start:r.pos/8-1]) {
+			t.Fatalf("frame %d: header CRC mismatch", frame)
+		}
+
+		channels := make([][]int64, format.Channels)
+		for ch := range channels {
+			channels[ch] = decodeSubframe(t, r, blockSize, format.BitsPerSample)
+		}
+		r.alignByte()
+		if crc := uint16(r.readBits(16)); crc != crc16(data[start:r.pos/8-2]) {
+			t.Fatalf("frame %d: CRC16 mismatch", frame)
+		}
+		frameSizes = append(frameSizes, r.pos/8-start)
+
+		sample := make([]byte, 4)
+		for i := 0; i < blockSize; i++ {
+			for ch := range channels {
+				v := channels[ch][i]
+				binary.LittleEndian.PutUint32(sample, uint32(v))
+				sum.Write(sample[:bytesPerSample])
+				if bytesPerSample == 1 {
+					v += 128 // 8 位 WAV 是无符号的
+					binary.LittleEndian.PutUint32(sample, uint32(v))
+				}
+				pcm = append(pcm, sample[:bytesPerSample]...)
+			}
+		}
+	}
+	var digest [16]byte
+	copy(digest[:], sum.Sum(nil))
+	return pcm, digest, frameSizes
+}
+
+func decodeSubframe(t *testing.T, r *bitReader, blockSize, bps int) []int64 {
+	t.Helper()
+	header := r.readBits(8)
+	kind := header >> 1 & 0x3F
+	samples := make([]int64, blockSize)
+	switch {
+	case kind == 0x00:
+		v := r.readSigned(bps)
+		for i := range samples {
+			samples[i] = v
+		}
+	case kind == 0x01:
+		for i := range samples {
+			samples[i] = r.readSigned(bps)
+		}
+	case kind >= 0x08 && kind <= 0x0C:
+		order := int(kind - 0x08)
+		for i := 0; i < order; i++ {
+			samples[i] = r.readSigned(bps)
+		}
+		if method := r.readBits(2); method != 0 {
+			t.Fatalf("unexpected residual coding method %d", method)
+		}
+		partitionOrder := int(r.readBits(4))
+		pos := order
+		for p := 0; p < 1<<partitionOrder; p++ {
+			n := blockSize >> partitionOrder
+			if p == 0 {
+				n -= order
+			}
+			k := int(r.readBits(4))
+			if k == 15 {
+				t.Fatal("unexpected escaped Rice partition")
+			}
+			for i := 0; i < n; i++ {
+				u := r.readUnary()<<k | r.readBits(k)
+				samples[pos] = int64(u>>1) ^ -int64(u&1)
+				pos++
+			}
+		}
+		for i := order; i < blockSize; i++ {
+			s := samples
+			switch order {
+			case 1:
+				s[i] += s[i-1]
+			case 2:
+				s[i] += 2*s[i-1] - s[i-2]
+			case 3:
+				s[i] += 3*s[i-1] - 3*s[i-2] + s[i-3]
+			case 4:
+				s[i] += 4*s[i-1] - 6*s[i-2] + 4*s[i-3] - s[i-4]
+			}
+		}
+	default:
+		t.Fatalf("unexpected subframe type 0x%02x", kind)
+	}
+	return samples
+}
+
+// testPCM 生成包含正弦波、噪声、静音和满幅度采样的 PCM 数据，覆盖各种子帧类型
+func testPCM(format Format, samples int) []byte {
+	rng := rand.New(rand.NewSource(int64(format.BitsPerSample*format.Channels + format.SampleRate)))
+	bytesPerSample := format.BitsPerSample / 8
+	maxValue := int64(1)<<(format.BitsPerSample-1) - 1
+	pcm := make([]byte, 0, samples*format.BlockAlign())
+	sample := make([]byte, 4)
+	for i := 0; i < samples; i++ {
+		for ch := 0; ch < format.Channels; ch++ {
+			var v int64
+			switch section := i / 3000; section % 4 {
+			case 0:
+				v = int64(float64(maxValue) * 0.8 * math.Sin(float64(i*(ch+1))/20))
+			case 1:
+				v = rng.Int63n(2*maxValue+1) - maxValue
+			case 2:
+				v = 0
+			case 3:
+				v = maxValue
+				if i%2 == 1 {
+					v = -maxValue - 1
+				}
+			}
+			if bytesPerSample == 1 {
+				v += 128
+			}
+			binary.LittleEndian.PutUint32(sample, uint32(v))
+			pcm = append(pcm, sample[:bytesPerSample]...)
+		}
+	}
+	return pcm
+}
+
+func TestEncodeFLACRoundTrip(t *testing.T) {
+	formats := []Format{
+		{SampleRate: 44100, Channels: 2, BitsPerSample: 16},
+		{SampleRate: 96000, Channels: 2, BitsPerSample: 24},
+		{SampleRate: 48000, Channels: 1, BitsPerSample: 8},
+		{SampleRate: 44100, Channels: 6, BitsPerSample: 16},
+	}
+	for _, format := range formats {
+		t.Run(fmt.Sprintf("%dHz-%dbit-%dch", format.SampleRate, format.BitsPerSample, format.Channels), func(t *testing.T) {
+			samples := 3*flacBlockSize + 1234 // 最后一帧不满一个块
+			pcm := testPCM(format, samples)
+			path := filepath.Join(t.TempDir(), "out.flac")
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			comments := []string{"TITLE=Round Trip", "ARTIST=测试"}
+			pictures := []Picture{{Type: 3, MIMEType: "image/png", Width: 1, Height: 1, Depth: 24, Data: []byte("\x89PNG fake")}}
+			if err := EncodeFLAC(f, bytes.NewReader(pcm), format, int64(samples), comments, pictures); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			meta, err := tag.ReadFLACMetadata(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			info := meta.StreamInfo
+			if info.SampleRate != format.SampleRate || info.Channels != format.Channels ||
+				info.BitsPerSample != format.BitsPerSample || info.TotalSamples != int64(samples) {
+				t.Errorf("STREAMINFO = %+v, want %+v with %d samples", info, format, samples)
+			}
+			if got := meta.Comments.Get("ARTIST"); got != "测试" {
+				t.Errorf("ARTIST = %q", got)
+			}
+			if len(meta.Pictures) != 1 || meta.Pictures[0].Type != 3 || !bytes.Equal(meta.Pictures[0].Data, pictures[0].Data) {
+				t.Errorf("pictures = %+v", meta.Pictures)
+			}
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			streamInfo, audioStart := readTestStreamInfo(t, content)
+			decoded, digest, frameSizes := decodeFLACFrames(t, content[audioStart:], format)
+			if !bytes.Equal(decoded, pcm) {
+				t.Fatal("decoded PCM differs from the input")
+			}
+			if !bytes.Equal(streamInfo[18:34], digest[:]) {
+				t.Errorf("STREAMINFO MD5 %x, want %x", streamInfo[18:34], digest)
+			}
+			minFrame, maxFrame := frameSizes[0], frameSizes[0]
+			for _, n := range frameSizes {
+				minFrame, maxFrame = min(minFrame, n), max(maxFrame, n)
+			}
+			gotMin := int(streamInfo[4])<<16 | int(streamInfo[5])<<8 | int(streamInfo[6])
+			gotMax := int(streamInfo[7])<<16 | int(streamInfo[8])<<8 | int(streamInfo[9])
+			if gotMin != minFrame || gotMax != maxFrame {
+				t.Errorf("STREAMINFO frame sizes %d-%d, want %d-%d", gotMin, gotMax, minFrame, maxFrame)
+			}
+		})
+	}
+}
+
+// readTestStreamInfo 返回 STREAMINFO 块的内容以及第一个音频帧的位置
+func readTestStreamInfo(t *testing.T, content []byte) ([]byte, int) {
+	t.Helper()
+	if string(content[:4]) != "fLaC" {
+		t.Fatal("missing fLaC marker")
+	}
+	pos := 4
+	var streamInfo []byte
+	for {
+		header := content[pos : pos+4]
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		if header[0]&0x7F == flacBlockStreamInfo {
+			streamInfo = content[pos+4 : pos+4+length]
+		}
+		pos += 4 + length
+		if header[0]&0x80 != 0 {
+			return streamInfo, pos
+		}
+	}
+}
+
+func TestEncodeFLACShortInput(t *testing.T) {
+	format := Format{SampleRate: 44100, Channels: 2, BitsPerSample: 16}
+	f, err := os.Create(filepath.Join(t.TempDir(), "out.flac"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	pcm := testPCM(format, 100)
+	if err := EncodeFLAC(f, bytes.NewReader(pcm), format, 200, nil, nil); err == nil {
+		t.Error("EncodeFLAC accepted input shorter than totalSamples")
+	}
+}
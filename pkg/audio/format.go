@@ -0,0 +1,38 @@
+package audio
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"github.com/yleoer/music/pkg/tag"
+)
+
+// ErrUnsupportedFormat 表示无法在不借助外部工具的情况下读取该文件的音频参数
+var ErrUnsupportedFormat = errors.New("unsupported audio format")
+
+// ReadFormat 读取 WAV/FLAC 文件头中的音频参数
+func ReadFormat(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".wav":
+		wav, err := ReadWAVHeader(path)
+		if err != nil {
+			return Format{}, err
+		}
+		return wav.Format, nil
+	case ".flac":
+		meta, err := tag.ReadFLACMetadata(path)
+		if err != nil {
+			return Format{}, err
+		}
+		return Format{
+			SampleRate:    meta.StreamInfo.SampleRate,
+			Channels:      meta.StreamInfo.Channels,
+			BitsPerSample: meta.StreamInfo.BitsPerSample,
+			TotalSamples:  meta.StreamInfo.TotalSamples,
+			ExactLength:   meta.StreamInfo.TotalSamples > 0, // STREAMINFO 中的采样数为 0 表示未知
+		}, nil
+	default:
+		return Format{}, ErrUnsupportedFormat
+	}
+}
@@ -0,0 +1,168 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	wavFormatPCM        = 1
+	wavFormatExtensible = 0xFFFE
+)
+
+// Format 描述 PCM 音频的基本参数
+type Format struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+	TotalSamples  int64 // 每声道的采样数，0 表示未知
+	ExactLength   bool  // TotalSamples 是否为精确值 (读自文件头或以 1/采样率 为时间基的 duration_ts)，否则是按时长估算的
+}
+
+// BlockAlign 返回一个采样帧 (全部声道) 占用的字节数
+func (f Format) BlockAlign() int {
+	return f.Channels * ((f.BitsPerSample + 7) / 8)
+}
+
+// WAVFile 描述一个 PCM WAV 文件的格式以及 data 块的位置
+type WAVFile struct {
+	Format
+	Path       string
+	DataOffset int64 // data 块内容在文件中的起始位置
+	DataSize   int64 // data 块内容的字节数
+}
+
+// ReadWAVHeader 解析 RIFF/WAVE 文件头，只支持整数 PCM (包括 WAVE_FORMAT_EXTENSIBLE)
+func ReadWAVHeader(path string) (*WAVFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(f, header); err != nil || string(header[:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("%s is not a RIFF/WAVE file", path)
+	}
+
+	wav := &WAVFile{Path: path}
+	hasFormat := false
+	pos := int64(12)
+	chunkHeader := make([]byte, 8)
+	for {
+		if _, err := f.ReadAt(chunkHeader, pos); err != nil {
+			return nil, fmt.Errorf("no data chunk found in %s", path)
+		}
+		id := string(chunkHeader[:4])
+		size := int64(binary.LittleEndian.Uint32(chunkHeader[4:8]))
+		pos += 8
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, fmt.Errorf("fmt chunk too short in %s", path)
+			}
+			fmtChunk := make([]byte, size)
+			if _, err := f.ReadAt(fmtChunk, pos); err != nil {
+				return nil, fmt.Errorf("failed to read fmt chunk in %s: %w", path, err)
+			}
+			formatTag := binary.LittleEndian.Uint16(fmtChunk[0:2])
+			if formatTag == wavFormatExtensible && size >= 26 {
+				formatTag = binary.LittleEndian.Uint16(fmtChunk[24:26]) // SubFormat GUID 的前两个字节
+			}
+			if formatTag != wavFormatPCM {
+				return nil, fmt.Errorf("unsupported WAV format tag 0x%04x in %s", formatTag, path)
+			}
+			wav.Channels = int(binary.LittleEndian.Uint16(fmtChunk[2:4]))
+			wav.SampleRate = int(binary.LittleEndian.Uint32(fmtChunk[4:8]))
+			wav.BitsPerSample = int(binary.LittleEndian.Uint16(fmtChunk[14:16]))
+			hasFormat = true
+		case "data":
+			if !hasFormat {
+				return nil, fmt.Errorf("data chunk before fmt chunk in %s", path)
+			}
+			if wav.BlockAlign() == 0 {
+				return nil, fmt.Errorf("invalid WAV format in %s", path)
+			}
+			// 部分软件写入的 data 长度为 0 或超过文件实际大小 (例如流式写入)，以实际文件大小为准
+			if size == 0 || pos+size > info.Size() {
+				size = info.Size() - pos
+			}
+			size -= size % int64(wav.BlockAlign())
+			wav.DataOffset = pos
+			wav.DataSize = size
+			wav.TotalSamples = size / int64(wav.BlockAlign())
+			wav.ExactLength = true
+			return wav, nil
+		}
+		pos += size + size%2 // RIFF 块按偶数字节对齐
+	}
+}
+
+// CutWAV 将 src 中 [startSample, endSample) 区间的 PCM 数据原样复制为一个新的 WAV 文件。
+// endSample 为 0 表示到文件结尾。相邻区间的输出拼接后与原 data 块逐字节一致
+func CutWAV(src *WAVFile, dst string, startSample, endSample int64) error {
+	if endSample == 0 || endSample > src.TotalSamples {
+		endSample = src.TotalSamples
+	}
+	if startSample < 0 || startSample > endSample {
+		return fmt.Errorf("invalid sample range [%d, %d) for %s", startSample, endSample, src.Path)
+	}
+	in, err := os.Open(src.Path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	blockAlign := int64(src.BlockAlign())
+	dataSize := (endSample - startSample) * blockAlign
+	if err := WriteWAVHeader(out, src.Format, dataSize); err != nil {
+		out.Close()
+		return err
+	}
+	section := io.NewSectionReader(in, src.DataOffset+startSample*blockAlign, dataSize)
+	if _, err := io.Copy(out, section); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy samples from %s: %w", src.Path, err)
+	}
+	if dataSize%2 == 1 {
+		if _, err := out.Write([]byte{0}); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	return out.Close()
+}
+
+// WriteWAVHeader 写出一个 44 字节的标准 PCM WAV 文件头
+func WriteWAVHeader(w io.Writer, format Format, dataSize int64) error {
+	if dataSize > 0xFFFFFFFF-36 {
+		return errors.New("WAV data too large")
+	}
+	blockAlign := format.BlockAlign()
+	header := make([]byte, 44)
+	copy(header[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:8], uint32(36+dataSize+dataSize%2))
+	copy(header[8:16], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:20], 16)
+	binary.LittleEndian.PutUint16(header[20:22], wavFormatPCM)
+	binary.LittleEndian.PutUint16(header[22:24], uint16(format.Channels))
+	binary.LittleEndian.PutUint32(header[24:28], uint32(format.SampleRate))
+	binary.LittleEndian.PutUint32(header[28:32], uint32(format.SampleRate*blockAlign))
+	binary.LittleEndian.PutUint16(header[32:34], uint16(blockAlign))
+	binary.LittleEndian.PutUint16(header[34:36], uint16(format.BitsPerSample))
+	copy(header[36:40], "data")
+	binary.LittleEndian.PutUint32(header[40:44], uint32(dataSize))
+	_, err := w.Write(header)
+	return err
+}
@@ -0,0 +1,108 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yleoer/music/pkg/album"
+)
+
+// writeTestWAV 写出一个带有 LIST 块 (奇数长度，测试对齐) 的 WAV 文件，返回 data 块的内容
+func writeTestWAV(t *testing.T, path string, format Format, samples int64) []byte {
+	t.Helper()
+	data := make([]byte, samples*int64(format.BlockAlign()))
+	rand.New(rand.NewSource(1)).Read(data)
+
+	var buf bytes.Buffer
+	if err := WriteWAVHeader(&buf, format, int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	header := buf.Bytes()
+	list := []byte("LIST\x05\x00\x00\x00INFO\x00\x00")
+	riffSize := binary.LittleEndian.Uint32(header[4:8]) + uint32(len(list))
+	binary.LittleEndian.PutUint32(header[4:8], riffSize)
+
+	var file bytes.Buffer
+	file.Write(header[:36])
+	file.Write(list)
+	file.Write(header[36:])
+	file.Write(data)
+	if err := os.WriteFile(path, file.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestCutWAVRoundTrip(t *testing.T) {
+	formats := []Format{
+		{SampleRate: 44100, Channels: 2, BitsPerSample: 16},
+		{SampleRate: 48000, Channels: 2, BitsPerSample: 24},
+		{SampleRate: 96000, Channels: 1, BitsPerSample: 24},
+	}
+	// 音轨起点按 CUE 的帧 (MM:SS:FF) 给出，最后一条音轨到文件结尾
+	cueFrames := []album.Frames{0, 1, 75*2 + 37, 75*5 + 74}
+	for _, format := range formats {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "image.wav")
+		total := album.Frames(75*7+11).Samples(format.SampleRate) + 13 // 结尾不足一帧
+		data := writeTestWAV(t, src, format, total)
+
+		wav, err := ReadWAVHeader(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wav.Format.SampleRate != format.SampleRate || wav.Channels != format.Channels ||
+			wav.BitsPerSample != format.BitsPerSample || wav.TotalSamples != total || !wav.ExactLength {
+			t.Fatalf("ReadWAVHeader = %+v, want %+v with exactly %d samples", wav.Format, format, total)
+		}
+
+		var joined []byte
+		for i, start := range cueFrames {
+			startSample := start.Samples(format.SampleRate)
+			var endSample int64
+			if i+1 < len(cueFrames) {
+				endSample = cueFrames[i+1].Samples(format.SampleRate)
+			}
+			dst := filepath.Join(dir, "track.wav")
+			if err := CutWAV(wav, dst, startSample, endSample); err != nil {
+				t.Fatal(err)
+			}
+			cut, err := ReadWAVHeader(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantSamples := endSample - startSample
+			if endSample == 0 {
+				wantSamples = total - startSample
+			}
+			if cut.TotalSamples != wantSamples {
+				t.Errorf("%d Hz track %d has %d samples, want %d", format.SampleRate, i+1, cut.TotalSamples, wantSamples)
+			}
+			content, err := os.ReadFile(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			joined = append(joined, content[cut.DataOffset:cut.DataOffset+cut.DataSize]...)
+		}
+		if !bytes.Equal(joined, data) {
+			t.Errorf("%d Hz/%d bit: concatenated tracks differ from the source image", format.SampleRate, format.BitsPerSample)
+		}
+	}
+}
+
+func TestCutWAVInvalidRange(t *testing.T) {
+	format := Format{SampleRate: 44100, Channels: 2, BitsPerSample: 16}
+	src := filepath.Join(t.TempDir(), "image.wav")
+	writeTestWAV(t, src, format, 1000)
+	wav, err := ReadWAVHeader(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CutWAV(wav, filepath.Join(t.TempDir(), "out.wav"), 900, 100); err == nil {
+		t.Error("CutWAV accepted a range whose start is after its end")
+	}
+}
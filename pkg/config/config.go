@@ -1,29 +1,101 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/yleoer/music/pkg/naming"
 )
 
+// OutputConfig 是一个输出目标：编码配置名称及其音乐库根目录
+type OutputConfig struct {
+	Profile    string `json:"profile"`     // 编码配置，如 flac-8、alac、opus-128、mp3-v0、aac-256
+	LibraryDir string `json:"library_dir"` // 该输出的音乐库根目录
+}
+
+// SidecarRule 是用户定义的旁注文件 (Info.txt、.nfo 等文本文件) 解析规则，优先于内置规则。
+// Fields 的键为 artist、album、year、date、label、catalog 或 genre，值为依次尝试的正则表达式，取第一个捕获组；
+// Track 匹配曲目表中的一行，使用命名捕获组 number、title 以及可选的 disc、artist。
+// 设置 TrackSection 时只在其第一次匹配之后的内容中查找曲目
+type SidecarRule struct {
+	Name         string              `json:"name"`
+	Files        []string            `json:"files"` // 文件名通配符 (不区分大小写)，如 "*.nfo"，为空时匹配 .txt 和 .nfo
+	Fields       map[string][]string `json:"fields"`
+	Track        string              `json:"track"`
+	TrackSection string              `json:"track_section"`
+}
+
+// DirNameRule 是用户定义的专辑目录名解析规则，Pattern 匹配去掉噪声后的整个目录名，
+// 使用命名捕获组 artist、title、year、label、catalog，至少包含 title
+type DirNameRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
+
+// DirNameRules 是 DirNameRulesFile 的内容：Rules 优先于内置规则，Noise 是额外需要从目录名中去掉的正则表达式
+type DirNameRules struct {
+	Rules []DirNameRule `json:"rules"`
+	Noise []string      `json:"noise"`
+}
+
 type Config struct {
-	DownloadDir            string        `json:"download_dir"`             // 监听目录
-	MusicLibDir            string        `json:"music_lib_dir"`            // 刮削后的文件存放目录
-	DataDir                string        `json:"data_dir"`                 // SQLite数据库文件存放目录
-	DBFileName             string        `json:"db_file_name"`             // SQLite数据库文件名
-	DBPath                 string        `json:"-"`                        // 完整的数据库文件路径
-	StabilityCheckInterval time.Duration `json:"stability_check_interval"` // 每次检查的间隔
-	StabilityQuietDuration time.Duration `json:"stability_quiet_duration"` // 文件在多长时间内没有变化才算稳定
-	StabilityMaxWait       time.Duration `json:"stability_max_wait"`       // 最长等待文件稳定的时间
-	FFmpegPath             string        `json:"ffmpeg_path"`              // FFmpeg 可执行文件路径
-	NeteaseAPI             string        `json:"netease_api"`              // 网易云音乐 API 地址
-	HTTPTimeout            time.Duration `json:"http_timeout"`             // HTTP 请求超时
+	DownloadDir            string         `json:"download_dir"`             // 监听目录
+	ScanMaxDepth           int            `json:"scan_max_depth"`           // 专辑目录在监听目录下的最大层级，1 表示只有直接子目录
+	QuarantineDir          string         `json:"quarantine_dir"`           // 包含不安全路径的专辑被移到此目录 (需与 DOWNLOAD_DIR 在同一文件系统上)，为空时只拒绝处理
+	MusicLibDir            string         `json:"music_lib_dir"`            // 刮削后的文件存放目录
+	DataDir                string         `json:"data_dir"`                 // SQLite数据库文件存放目录
+	DBFileName             string         `json:"db_file_name"`             // SQLite数据库文件名
+	DBPath                 string         `json:"-"`                        // 完整的数据库文件路径
+	StabilityCheckInterval time.Duration  `json:"stability_check_interval"` // 每次检查的间隔
+	StabilityQuietDuration time.Duration  `json:"stability_quiet_duration"` // 文件在多长时间内没有变化才算稳定
+	StabilityMaxWait       time.Duration  `json:"stability_max_wait"`       // 最长等待文件稳定的时间
+	FFmpegPath             string         `json:"ffmpeg_path"`              // FFmpeg 可执行文件路径
+	FFprobePath            string         `json:"ffprobe_path"`             // ffprobe 可执行文件路径，用于读取镜像长度和音频参数
+	Processor              string         `json:"processor"`                // 专辑处理器: ffmpeg 或 native (纯 Go，仅支持 WAV 镜像)
+	Outputs                []OutputConfig `json:"outputs"`                  // 每张专辑生成的输出，默认为 MusicLibDir 下的 FLAC
+	PathTemplate           string         `json:"path_template"`            // 音乐库内的路径模板，语法见 naming.Template
+	MaxNameLength          int            `json:"max_name_length"`          // 每级目录名或文件名的最大字节数
+	AlbumWorkers           int            `json:"album_workers"`            // 同时处理的专辑数，等待文件稳定的专辑不占用名额
+	TranscodeWorkers       int            `json:"transcode_workers"`        // 每张专辑同时转码的音轨数，默认为 CPU 核数
+	FailurePolicy          string         `json:"failure_policy"`           // 音轨转码失败时的策略: fail、partial 或 retry
+	TrackRetries           int            `json:"track_retries"`            // retry 策略下单条音轨的重试次数
+	NeteaseAPI             string         `json:"netease_api"`              // 网易云音乐 API 地址
+	HTTPTimeout            time.Duration  `json:"http_timeout"`             // HTTP 请求超时
+	MetadataRequestGap     time.Duration  `json:"metadata_request_gap"`     // 两次在线元数据请求之间的最小间隔
+	ShutdownGracePeriod    time.Duration  `json:"shutdown_grace_period"`    // 退出时等待正在处理的专辑完成的最长时间
+	RetryMaxAttempts       int            `json:"retry_max_attempts"`       // 暂时性失败的专辑最多处理的次数，之后标记为失败
+	RetryBaseDelay         time.Duration  `json:"retry_base_delay"`         // 第一次重试前的等待时间，之后每次翻倍
+	RetryMaxDelay          time.Duration  `json:"retry_max_delay"`          // 两次重试之间的最长等待时间
+	SidecarRulesFile       string         `json:"sidecar_rules_file"`       // 旁注文件解析规则 (SidecarRule 数组) 的 JSON 文件，为空时只使用内置规则
+	SidecarRules           []SidecarRule  `json:"-"`                        // 从 SidecarRulesFile 读取的规则
+	DirNameRulesFile       string         `json:"dirname_rules_file"`       // 目录名解析规则 (DirNameRules) 的 JSON 文件，为空时只使用内置规则
+	DirNameRules           DirNameRules   `json:"-"`                        // 从 DirNameRulesFile 读取的规则
+	CoverMaxDimension      int            `json:"cover_max_dimension"`      // 封面的最大宽高 (像素)，更大的封面被缩小，0 表示不限制
+	CoverMaxBytes          int            `json:"cover_max_bytes"`          // 封面的最大字节数，更大的封面被重新压缩为 JPEG，0 表示不限制
+	WriteCoverFile         bool           `json:"write_cover_file"`         // 是否在音轨旁写入 cover.jpg (WebP 封面为 cover.webp)
 }
 
+// 可选的专辑处理器
+const (
+	ProcessorFFmpeg = "ffmpeg"
+	ProcessorNative = "native"
+)
+
+// 音轨转码失败时的策略
+const (
+	FailureFail    = "fail"    // 任一音轨失败则整张专辑失败，下次扫描时重新处理
+	FailurePartial = "partial" // 接受部分成功，失败的音轨只记录在数据库中
+	FailureRetry   = "retry"   // 失败的音轨立即重试，重试后仍失败则整张专辑失败
+)
+
 const (
 	downloadDir = "/app/download"
 	musicDir    = "/app/music"
@@ -31,6 +103,10 @@ const (
 
 	dbFileName = "music.db"
 	ffmpeg     = "ffmpeg"
+	ffprobe    = "ffprobe"
+	outputs    = "flac"
+	processor  = ProcessorFFmpeg
+	failure    = FailureFail
 	neteaseAPI = "http://music.163.com/api/search/get/web"
 
 	// 文件稳定性检查相关参数
@@ -38,7 +114,19 @@ const (
 	stabilityQuietDuration = 1 * time.Minute // 文件在多长时间内没有变化才算稳定
 	stabilityMaxWait       = 12 * time.Hour  // 最长等待文件稳定的时间
 
-	httpTimeout = 30 * time.Second
+	httpTimeout        = 30 * time.Second
+	metadataRequestGap = 1 * time.Second // 避免请求过快被网易云限流
+
+	retryMaxAttempts = 8 // 按默认的间隔，7 次重试最多跨越约 21 小时
+	retryBaseDelay   = 10 * time.Minute
+	retryMaxDelay    = 12 * time.Hour
+
+	shutdownGracePeriod = 8 * time.Second // Docker 默认 10 秒后发送 SIGKILL，留出关闭数据库的时间；调大时需同时调大 stop_grace_period
+
+	maxNameLength = 255 // 大多数文件系统单个文件名的上限
+	trackRetries  = 2
+	albumWorkers  = 2 // 每张专辑内部已经按 CPU 核数并发转码，同时处理少量专辑即可避免互相阻塞
+	scanMaxDepth  = 3 // 足够容纳 "艺术家/专辑" 和下载工具额外创建的一层目录
 )
 
 // LoadConfig 从环境变量或默认值加载配置
@@ -48,6 +136,7 @@ func LoadConfig() (*Config, error) {
 
 	cfg := &Config{
 		DownloadDir:            os.Getenv("DOWNLOAD_DIR"),
+		QuarantineDir:          os.Getenv("QUARANTINE_DIR"),
 		MusicLibDir:            os.Getenv("MUSIC_LIB_DIR"),
 		DataDir:                os.Getenv("DATA_DIR"),
 		DBFileName:             os.Getenv("DB_FILE_NAME"),
@@ -55,8 +144,25 @@ func LoadConfig() (*Config, error) {
 		StabilityQuietDuration: parseDurationOrDefault(os.Getenv("STABILITY_QUIET_DURATION"), stabilityQuietDuration),
 		StabilityMaxWait:       parseDurationOrDefault(os.Getenv("STABILITY_MAX_WAIT"), stabilityMaxWait),
 		FFmpegPath:             os.Getenv("FFMPEG_PATH"),
+		FFprobePath:            os.Getenv("FFPROBE_PATH"),
+		Processor:              os.Getenv("PROCESSOR"),
+		PathTemplate:           os.Getenv("PATH_TEMPLATE"),
+		FailurePolicy:          os.Getenv("FAILURE_POLICY"),
+		TrackRetries:           trackRetries,
+		MaxNameLength:          maxNameLength,
 		NeteaseAPI:             os.Getenv("NETEASE_API"),
 		HTTPTimeout:            parseDurationOrDefault(os.Getenv("HTTP_TIMEOUT"), httpTimeout),
+		MetadataRequestGap:     parseDurationOrDefault(os.Getenv("METADATA_REQUEST_GAP"), metadataRequestGap),
+		ShutdownGracePeriod:    parseDurationOrDefault(os.Getenv("SHUTDOWN_GRACE_PERIOD"), shutdownGracePeriod),
+		RetryMaxAttempts:       retryMaxAttempts,
+		RetryBaseDelay:         parseDurationOrDefault(os.Getenv("RETRY_BASE_DELAY"), retryBaseDelay),
+		RetryMaxDelay:          parseDurationOrDefault(os.Getenv("RETRY_MAX_DELAY"), retryMaxDelay),
+		SidecarRulesFile:       os.Getenv("SIDECAR_RULES_FILE"),
+		DirNameRulesFile:       os.Getenv("DIRNAME_RULES_FILE"),
+		AlbumWorkers:           albumWorkers,
+		ScanMaxDepth:           scanMaxDepth,
+		WriteCoverFile:         true,
+		TranscodeWorkers:       runtime.NumCPU(),
 	}
 
 	// 设置默认值
@@ -75,9 +181,125 @@ func LoadConfig() (*Config, error) {
 	if cfg.FFmpegPath == "" {
 		cfg.FFmpegPath = ffmpeg
 	}
+	if cfg.QuarantineDir != "" {
+		// 隔离目录不能位于监听目录内，否则移过去的专辑会被再次扫描
+		if rel, err := filepath.Rel(cfg.DownloadDir, cfg.QuarantineDir); err == nil && (rel == "." || filepath.IsLocal(rel)) {
+			return nil, fmt.Errorf("QUARANTINE_DIR %s must not be inside DOWNLOAD_DIR %s", cfg.QuarantineDir, cfg.DownloadDir)
+		}
+		if err := os.MkdirAll(cfg.QuarantineDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create quarantine directory %s: %w", cfg.QuarantineDir, err)
+		}
+	}
+	if cfg.FFprobePath == "" {
+		cfg.FFprobePath = ffprobe
+	}
+	if cfg.Processor == "" {
+		cfg.Processor = processor
+	}
+	if cfg.Processor != ProcessorFFmpeg && cfg.Processor != ProcessorNative {
+		return nil, fmt.Errorf("unknown processor %q, expected %q or %q", cfg.Processor, ProcessorFFmpeg, ProcessorNative)
+	}
+	if cfg.FailurePolicy == "" {
+		cfg.FailurePolicy = failure
+	}
+	if cfg.FailurePolicy != FailureFail && cfg.FailurePolicy != FailurePartial && cfg.FailurePolicy != FailureRetry {
+		return nil, fmt.Errorf("unknown failure policy %q, expected %q, %q or %q", cfg.FailurePolicy, FailureFail, FailurePartial, FailureRetry)
+	}
+	if s := os.Getenv("TRACK_RETRIES"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid TRACK_RETRIES %q, expected a non-negative integer", s)
+		}
+		cfg.TrackRetries = n
+	}
 	if cfg.NeteaseAPI == "" {
 		cfg.NeteaseAPI = neteaseAPI
 	}
+	if cfg.PathTemplate == "" {
+		cfg.PathTemplate = naming.DefaultTemplate
+	}
+	// 启动时校验路径模板，避免处理到一半才发现模板写错
+	if _, err := naming.Parse(cfg.PathTemplate); err != nil {
+		return nil, err
+	}
+	if s := os.Getenv("MAX_NAME_LENGTH"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 16 || n > maxNameLength {
+			return nil, fmt.Errorf("invalid MAX_NAME_LENGTH %q, expected 16-%d", s, maxNameLength)
+		}
+		cfg.MaxNameLength = n
+	}
+	if s := os.Getenv("TRANSCODE_WORKERS"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid TRANSCODE_WORKERS %q, expected a positive integer", s)
+		}
+		cfg.TranscodeWorkers = n
+	}
+	if s := os.Getenv("RETRY_MAX_ATTEMPTS"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid RETRY_MAX_ATTEMPTS %q, expected a positive integer", s)
+		}
+		cfg.RetryMaxAttempts = n
+	}
+	if cfg.RetryBaseDelay <= 0 || cfg.RetryMaxDelay < cfg.RetryBaseDelay {
+		return nil, fmt.Errorf("invalid retry delays: RETRY_BASE_DELAY must be positive and not exceed RETRY_MAX_DELAY")
+	}
+	if s := os.Getenv("ALBUM_WORKERS"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid ALBUM_WORKERS %q, expected a positive integer", s)
+		}
+		cfg.AlbumWorkers = n
+	}
+	if s := os.Getenv("SCAN_MAX_DEPTH"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid SCAN_MAX_DEPTH %q, expected a positive integer", s)
+		}
+		cfg.ScanMaxDepth = n
+	}
+	if s := os.Getenv("COVER_MAX_DIMENSION"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid COVER_MAX_DIMENSION %q, expected a non-negative integer", s)
+		}
+		cfg.CoverMaxDimension = n
+	}
+	if s := os.Getenv("COVER_MAX_BYTES"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid COVER_MAX_BYTES %q, expected a non-negative integer", s)
+		}
+		cfg.CoverMaxBytes = n
+	}
+	if s := os.Getenv("WRITE_COVER_FILE"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WRITE_COVER_FILE %q, expected true or false", s)
+		}
+		cfg.WriteCoverFile = b
+	}
+	outputs, err := parseOutputs(os.Getenv("OUTPUTS"), cfg.MusicLibDir)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Outputs = outputs
+	if cfg.SidecarRulesFile != "" {
+		rules, err := loadSidecarRules(cfg.SidecarRulesFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.SidecarRules = rules
+	}
+	if cfg.DirNameRulesFile != "" {
+		rules, err := loadDirNameRules(cfg.DirNameRulesFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.DirNameRules = rules
+	}
 	cfg.DBPath = filepath.Join(cfg.DataDir, cfg.DBFileName)
 	// 确认目录存在
 	if err := os.MkdirAll(cfg.DownloadDir, 0755); err != nil {
@@ -94,6 +316,52 @@ func LoadConfig() (*Config, error) {
 	return cfg, nil
 }
 
+// parseOutputs 解析形如 "flac-8,opus-128=/app/music-mobile" 的输出列表，未指定目录的输出使用 MusicLibDir
+func parseOutputs(s, musicLibDir string) ([]OutputConfig, error) {
+	if strings.TrimSpace(s) == "" {
+		s = outputs
+	}
+	var result []OutputConfig
+	for _, item := range strings.Split(s, ",") {
+		profile, dir, _ := strings.Cut(strings.TrimSpace(item), "=")
+		profile, dir = strings.TrimSpace(profile), strings.TrimSpace(dir)
+		if profile == "" {
+			return nil, fmt.Errorf("empty profile name in OUTPUTS %q", s)
+		}
+		if dir == "" {
+			dir = musicLibDir
+		}
+		result = append(result, OutputConfig{Profile: profile, LibraryDir: dir})
+	}
+	return result, nil
+}
+
+// loadSidecarRules 读取 JSON 格式的旁注文件解析规则，规则的正则表达式在创建解析器时校验
+func loadSidecarRules(path string) ([]SidecarRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SIDECAR_RULES_FILE %s: %w", path, err)
+	}
+	var rules []SidecarRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid SIDECAR_RULES_FILE %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// loadDirNameRules 读取 JSON 格式的目录名解析规则，规则的正则表达式在创建解析器时校验
+func loadDirNameRules(path string) (DirNameRules, error) {
+	var rules DirNameRules
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rules, fmt.Errorf("failed to read DIRNAME_RULES_FILE %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return rules, fmt.Errorf("invalid DIRNAME_RULES_FILE %s: %w", path, err)
+	}
+	return rules, nil
+}
+
 func parseDurationOrDefault(s string, defaultValue time.Duration) time.Duration {
 	if s == "" {
 		return defaultValue
@@ -1,8 +1,95 @@
 package database
 
+import "time"
+
+// 专辑处理结果状态
+const (
+	StatusSucceeded = "succeeded" // 所有音轨处理成功
+	StatusPartial   = "partial"   // 部分音轨失败，但按策略接受
+	StatusFailed    = "failed"    // 处理失败，专辑不会被标记为已处理
+	StatusRejected  = "rejected"  // 专辑包含指向专辑目录之外的路径，拒绝处理
+)
+
+// 任务队列中任务的状态
+const (
+	JobQueued  = "queued"  // 等待文件稳定，到 NextRunAt 时再检查
+	JobReady   = "ready"   // 文件已稳定，等待空闲的处理名额
+	JobRunning = "running" // 正在处理
+	JobDone    = "done"    // 处理完成 (包括已处理过而跳过的目录)
+	JobFailed  = "failed"  // 处理失败，只有 requeue 命令 (RequeueJob) 会重新排队
+)
+
+// Job 是任务队列中的一项，每个专辑目录最多一项
+type Job struct {
+	Path      string
+	State     string // JobQueued、JobReady、JobRunning、JobDone 或 JobFailed
+	Priority  int    // 数值越大越先处理
+	Attempts  int    // 自上次处理成功或手动重新排队以来开始处理的次数
+	NextRunAt time.Time
+	LastError string
+	Rerun     bool // 处理期间目录又发生了变化，结束后需要重新排队
+	UpdatedAt time.Time
+}
+
+// TrackRecord 是一条音轨在一个输出目标上的处理结果
+type TrackRecord struct {
+	Disc       int
+	Track      int
+	Title      string
+	Profile    string
+	OutputPath string
+
+	// 源镜像的音频参数，未知时为 0
+	SampleRate    int
+	BitsPerSample int
+	Channels      int
+
+	Succeeded bool
+	Error     string
+	Stderr    string // 失败时 FFmpeg 输出的末尾片段
+	Attempts  int
+}
+
+// AlbumRun 是一次专辑处理的结果
+type AlbumRun struct {
+	Path       string
+	Status     string // StatusSucceeded、StatusPartial、StatusFailed 或 StatusRejected
+	Error      string // 专辑级别的错误，如扫描或目录创建失败
+	FinishedAt time.Time
+	Tracks     []TrackRecord
+}
+
+// TrackProgress 是已完成音轨的校验信息，容器重启后据此跳过已经完成的音轨
+type TrackProgress struct {
+	AlbumPath string
+	Profile   string        // 输出的编码配置名称
+	RelPath   string        // 音轨在音乐库中的相对路径
+	Duration  time.Duration // 输出文件的时长，无法读取时为 0
+	Size      int64
+	Checksum  string // 输出文件的 SHA-256
+	UpdatedAt time.Time
+}
+
 // AlbumStore 定义专辑处理状态存储接口
 type AlbumStore interface {
-	AddProcessedAlbum(albumPath string) error        // 将专辑路径标记为已处理
-	IsAlbumProcessed(albumPath string) (bool, error) // 检查专辑路径是否已处理
-	Close() error                                    // 关闭数据库连接
+	AddProcessedAlbum(albumPath string) error                                  // 将专辑路径标记为已处理
+	IsAlbumProcessed(albumPath string) (bool, error)                           // 检查专辑路径是否已处理
+	RecordAlbumRun(run *AlbumRun) error                                        // 保存一次处理的结果及每条音轨的结果
+	SaveTrackProgress(p *TrackProgress) error                                  // 记录一条已完成的音轨
+	TrackProgress(albumPath, profile string) (map[string]TrackProgress, error) // 返回专辑在一个输出上已完成的音轨，以相对路径为键
+	ClearTrackProgress(albumPath string) error                                 // 专辑处理完成后清除其进度记录
+
+	EnqueueJob(path string, priority int, runAt time.Time) error         // 将目录排队，已排队的推迟到 runAt；正在处理的标记为结束后重新排队；失败的不变
+	RequeueJob(path string, priority int, runAt time.Time) (bool, error) // 将 JobFailed 任务重新排队并清零处理次数，不是失败的任务时返回 false
+	DueJobs(now time.Time) ([]Job, error)                                // 返回已到期的 JobQueued 任务，按优先级排序
+	DeferJob(path string, runAt time.Time) error                         // 将 JobQueued 任务推迟到 runAt
+	MarkJobReady(path string, now time.Time) (bool, error)               // 将仍然到期的 JobQueued 任务标记为 JobReady，期间被推迟时返回 false
+	ClaimReadyJob() (*Job, error)                                        // 取出优先级最高的 JobReady 任务并标记为 JobRunning，没有时返回 nil
+	FinishJob(path, state, lastError string, runAt time.Time) error      // 结束 JobRunning 任务；成功但处理期间目录有变化时改为在 runAt 重新排队
+	RemoveJob(path string) error                                         // 删除任务，用于已经不存在的目录
+	ResetInterruptedJobs(now time.Time) (int, error)                     // 将上次退出时未完成的 JobReady/JobRunning 任务重新排队
+	NextJobRunAt() (time.Time, bool, error)                              // 返回最早到期的 JobQueued 任务的时间
+	Job(path string) (*Job, error)                                       // 返回目录的任务，没有时返回 nil
+	ListJobs(states ...string) ([]Job, error)                            // 返回指定状态的任务，不指定时返回全部
+	Close() error                                                        // 关闭数据库连接
 }
@@ -0,0 +1,225 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// jobColumns 是读取任务时的列，其中 next_run_at 以 Unix 毫秒保存，便于比较和排序
+const jobColumns = "path, state, priority, attempts, next_run_at, last_error, rerun, updated_at"
+
+// EnqueueJob 将目录排队，在 runAt 之后检查文件是否稳定。已排队的任务推迟到 runAt (多次变化只处理一次)，
+// 但不会提前正在退避的重试，处理次数保留，优先级取较高者；正在处理的任务标记为结束后重新排队；
+// 已完成的任务重新排队并清零处理次数；失败的任务保持不变，只能通过 RequeueJob 重新排队
+func (s *sqliteStore) EnqueueJob(path string, priority int, runAt time.Time) error {
+	_, err := s.db.Exec(`INSERT INTO jobs (path, state, priority, attempts, next_run_at, updated_at)
+		VALUES (?, ?, ?, 0, ?, ?)
+		ON CONFLICT (path) DO UPDATE SET
+			state = CASE WHEN state IN (?, ?) THEN state ELSE ? END,
+			priority = CASE state WHEN ? THEN excluded.priority WHEN ? THEN priority ELSE MAX(priority, excluded.priority) END,
+			attempts = CASE WHEN state = ? THEN 0 ELSE attempts END,
+			next_run_at = CASE state WHEN ? THEN excluded.next_run_at WHEN ? THEN next_run_at WHEN ? THEN next_run_at
+				ELSE MAX(next_run_at, excluded.next_run_at) END,
+			rerun = state = ?,
+			updated_at = CASE WHEN state = ? THEN updated_at ELSE excluded.updated_at END`,
+		path, JobQueued, priority, runAt.UnixMilli(), time.Now(),
+		JobRunning, JobFailed, JobQueued,
+		JobDone, JobFailed,
+		JobDone,
+		JobDone, JobRunning, JobFailed,
+		JobRunning,
+		JobFailed)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue job for %s: %w", path, err)
+	}
+	return nil
+}
+
+// RequeueJob 将 JobFailed 任务以 priority 重新排队并清零处理次数，在 runAt 时检查。任务不是 JobFailed 时返回 false
+func (s *sqliteStore) RequeueJob(path string, priority int, runAt time.Time) (bool, error) {
+	res, err := s.db.Exec("UPDATE jobs SET state = ?, priority = ?, attempts = 0, next_run_at = ?, rerun = 0, updated_at = ? WHERE path = ? AND state = ?",
+		JobQueued, priority, runAt.UnixMilli(), time.Now(), path, JobFailed)
+	if err != nil {
+		return false, fmt.Errorf("failed to requeue job for %s: %w", path, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to requeue job for %s: %w", path, err)
+	}
+	return n > 0, nil
+}
+
+// DueJobs 返回 next_run_at 不晚于 now 的 JobQueued 任务，优先级高的在前
+func (s *sqliteStore) DueJobs(now time.Time) ([]Job, error) {
+	return s.queryJobs("SELECT "+jobColumns+" FROM jobs WHERE state = ? AND next_run_at <= ? ORDER BY priority DESC, next_run_at",
+		JobQueued, now.UnixMilli())
+}
+
+// DeferJob 将 JobQueued 任务推迟到 runAt，期间已被推迟得更晚的保持不变
+func (s *sqliteStore) DeferJob(path string, runAt time.Time) error {
+	_, err := s.db.Exec("UPDATE jobs SET next_run_at = MAX(next_run_at, ?), updated_at = ? WHERE path = ? AND state = ?",
+		runAt.UnixMilli(), time.Now(), path, JobQueued)
+	if err != nil {
+		return fmt.Errorf("failed to defer job for %s: %w", path, err)
+	}
+	return nil
+}
+
+// MarkJobReady 将到期的 JobQueued 任务标记为 JobReady。检查期间目录又发生变化而被推迟时不做修改并返回 false
+func (s *sqliteStore) MarkJobReady(path string, now time.Time) (bool, error) {
+	res, err := s.db.Exec("UPDATE jobs SET state = ?, updated_at = ? WHERE path = ? AND state = ? AND next_run_at <= ?",
+		JobReady, time.Now(), path, JobQueued, now.UnixMilli())
+	if err != nil {
+		return false, fmt.Errorf("failed to mark job for %s ready: %w", path, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to mark job for %s ready: %w", path, err)
+	}
+	return n > 0, nil
+}
+
+// ClaimReadyJob 在一个事务中取出优先级最高、等待最久的 JobReady 任务并标记为 JobRunning，没有时返回 nil
+func (s *sqliteStore) ClaimReadyJob() (*Job, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	job, err := scanJob(tx.QueryRow("SELECT "+jobColumns+" FROM jobs WHERE state = ? ORDER BY priority DESC, updated_at LIMIT 1", JobReady))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+	job.State = JobRunning
+	job.Attempts++
+	job.Rerun = false
+	job.UpdatedAt = time.Now()
+	if _, err := tx.Exec("UPDATE jobs SET state = ?, attempts = ?, rerun = 0, updated_at = ? WHERE path = ?",
+		job.State, job.Attempts, job.UpdatedAt, job.Path); err != nil {
+		return nil, fmt.Errorf("failed to claim job for %s: %w", job.Path, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to claim job for %s: %w", job.Path, err)
+	}
+	return &job, nil
+}
+
+// FinishJob 将 JobRunning 任务设为 state 并记录 lastError，state 为 JobQueued 时在 runAt 再次检查。
+// 处理成功但期间目录发生过变化时改为在 runAt 重新排队并清零处理次数；等待重试的任务保留处理次数，失败的任务保持失败
+func (s *sqliteStore) FinishJob(path, state, lastError string, runAt time.Time) error {
+	rerunState := state
+	if state == JobDone {
+		rerunState = JobQueued
+	}
+	_, err := s.db.Exec(`UPDATE jobs SET
+			state = CASE WHEN rerun THEN ? ELSE ? END,
+			attempts = CASE WHEN rerun AND ? THEN 0 ELSE attempts END,
+			next_run_at = ?,
+			last_error = ?,
+			rerun = 0,
+			updated_at = ?
+		WHERE path = ? AND state = ?`,
+		rerunState, state, state == JobDone, runAt.UnixMilli(), lastError, time.Now(), path, JobRunning)
+	if err != nil {
+		return fmt.Errorf("failed to finish job for %s: %w", path, err)
+	}
+	return nil
+}
+
+// RemoveJob 删除目录的任务
+func (s *sqliteStore) RemoveJob(path string) error {
+	if _, err := s.db.Exec("DELETE FROM jobs WHERE path = ?", path); err != nil {
+		return fmt.Errorf("failed to remove job for %s: %w", path, err)
+	}
+	return nil
+}
+
+// ResetInterruptedJobs 将上次退出时处于 JobReady 或 JobRunning 的任务重新排队，在 now 时检查，返回任务数
+func (s *sqliteStore) ResetInterruptedJobs(now time.Time) (int, error) {
+	res, err := s.db.Exec("UPDATE jobs SET state = ?, next_run_at = ?, updated_at = ? WHERE state IN (?, ?)",
+		JobQueued, now.UnixMilli(), time.Now(), JobReady, JobRunning)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reset interrupted jobs: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to reset interrupted jobs: %w", err)
+	}
+	return int(n), nil
+}
+
+// NextJobRunAt 返回最早到期的 JobQueued 任务的时间，没有排队的任务时第二个返回值为 false
+func (s *sqliteStore) NextJobRunAt() (time.Time, bool, error) {
+	var next sql.NullInt64
+	if err := s.db.QueryRow("SELECT MIN(next_run_at) FROM jobs WHERE state = ?", JobQueued).Scan(&next); err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to query next job: %w", err)
+	}
+	if !next.Valid {
+		return time.Time{}, false, nil
+	}
+	return time.UnixMilli(next.Int64), true, nil
+}
+
+// Job 返回目录的任务，没有时返回 nil
+func (s *sqliteStore) Job(path string) (*Job, error) {
+	job, err := scanJob(s.db.QueryRow("SELECT "+jobColumns+" FROM jobs WHERE path = ?", path))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job for %s: %w", path, err)
+	}
+	return &job, nil
+}
+
+// ListJobs 返回指定状态的任务，不指定状态时返回全部，优先级高的在前
+func (s *sqliteStore) ListJobs(states ...string) ([]Job, error) {
+	query := "SELECT " + jobColumns + " FROM jobs"
+	args := make([]interface{}, 0, len(states))
+	if len(states) > 0 {
+		query += " WHERE state IN (?" + strings.Repeat(", ?", len(states)-1) + ")"
+		for _, state := range states {
+			args = append(args, state)
+		}
+	}
+	return s.queryJobs(query+" ORDER BY priority DESC, next_run_at", args...)
+}
+
+func (s *sqliteStore) queryJobs(query string, args ...interface{}) ([]Job, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query jobs: %w", err)
+	}
+	defer rows.Close()
+	var jobs []Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// rowScanner 是 *sql.Row 和 *sql.Rows 共有的方法
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanJob 读取一行 jobColumns
+func scanJob(row rowScanner) (Job, error) {
+	var job Job
+	var nextRunAt int64
+	if err := row.Scan(&job.Path, &job.State, &job.Priority, &job.Attempts, &nextRunAt, &job.LastError, &job.Rerun, &job.UpdatedAt); err != nil {
+		return Job{}, err
+	}
+	job.NextRunAt = time.UnixMilli(nextRunAt)
+	return job, nil
+}
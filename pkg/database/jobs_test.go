@@ -0,0 +1,184 @@
+package database
+
+import (
+	"database/sql"
+	"io"
+	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestStore 在临时目录中创建数据库。没有 SQLite 驱动 (如 CGO_ENABLED=0 的构建) 时跳过测试
+func newTestStore(t *testing.T) *sqliteStore {
+	t.Helper()
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "music.db"), log.New(io.Discard, "", 0))
+	if err != nil {
+		if !slices.Contains(sql.Drivers(), "sqlite3") || strings.Contains(err.Error(), "CGO_ENABLED=0") {
+			t.Skipf("SQLite is not available: %v", err)
+		}
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store.(*sqliteStore)
+}
+
+// mustJob 返回目录的任务，不存在时终止测试
+func mustJob(t *testing.T, s *sqliteStore, path string) *Job {
+	t.Helper()
+	job, err := s.Job(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job == nil {
+		t.Fatalf("no job for %s", path)
+	}
+	return job
+}
+
+// startJob 将目录排队并立即开始处理，返回处理中的任务
+func startJob(t *testing.T, s *sqliteStore, path string, priority int) *Job {
+	t.Helper()
+	now := time.Now()
+	if err := s.EnqueueJob(path, priority, now.Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.MarkJobReady(path, now); err != nil || !ok {
+		t.Fatalf("MarkJobReady(%s) = %v, %v", path, ok, err)
+	}
+	job, err := s.ClaimReadyJob()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job == nil || job.Path != path {
+		t.Fatalf("ClaimReadyJob() = %+v, want %s", job, path)
+	}
+	return job
+}
+
+func TestEnqueueWhileRunningSetsRerun(t *testing.T) {
+	s := newTestStore(t)
+	startJob(t, s, "/downloads/a", 0)
+	if err := s.EnqueueJob("/downloads/a", 5, time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	job := mustJob(t, s, "/downloads/a")
+	if job.State != JobRunning || !job.Rerun || job.Attempts != 1 {
+		t.Errorf("job after enqueue while running = %+v, want running with rerun", job)
+	}
+
+	// 处理成功后按 runAt 重新排队，处理次数清零
+	runAt := time.Now().Add(time.Hour)
+	if err := s.FinishJob("/downloads/a", JobDone, "", runAt); err != nil {
+		t.Fatal(err)
+	}
+	job = mustJob(t, s, "/downloads/a")
+	if job.State != JobQueued || job.Rerun || job.Attempts != 0 || job.NextRunAt.UnixMilli() != runAt.UnixMilli() {
+		t.Errorf("job after finishing with rerun = %+v, want queued at %v", job, runAt)
+	}
+}
+
+func TestFailedJobStaysParked(t *testing.T) {
+	s := newTestStore(t)
+	startJob(t, s, "/downloads/a", 0)
+	if err := s.FinishJob("/downloads/a", JobFailed, "broken cue", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.EnqueueJob("/downloads/a", 10, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	job := mustJob(t, s, "/downloads/a")
+	if job.State != JobFailed || job.LastError != "broken cue" || job.Attempts != 1 || job.Priority != 0 || job.Rerun {
+		t.Errorf("failed job after enqueue = %+v, want it unchanged", job)
+	}
+	if due, err := s.DueJobs(time.Now().Add(time.Hour)); err != nil || len(due) != 0 {
+		t.Errorf("DueJobs() = %+v, %v, want no failed jobs", due, err)
+	}
+
+	if ok, err := s.RequeueJob("/downloads/a", 3, time.Now()); err != nil || !ok {
+		t.Fatalf("RequeueJob() = %v, %v", ok, err)
+	}
+	job = mustJob(t, s, "/downloads/a")
+	if job.State != JobQueued || job.Attempts != 0 || job.Priority != 3 {
+		t.Errorf("requeued job = %+v, want queued with attempts reset", job)
+	}
+	if ok, err := s.RequeueJob("/downloads/a", 3, time.Now()); err != nil || ok {
+		t.Errorf("RequeueJob() of a queued job = %v, %v, want false", ok, err)
+	}
+}
+
+func TestEnqueueKeepsBackoff(t *testing.T) {
+	s := newTestStore(t)
+	startJob(t, s, "/downloads/a", 0)
+	backoff := time.Now().Add(10 * time.Minute)
+	if err := s.FinishJob("/downloads/a", JobQueued, "connection reset", backoff); err != nil {
+		t.Fatal(err)
+	}
+
+	// 目录变化不会提前正在退避的重试，也不清零处理次数
+	if err := s.EnqueueJob("/downloads/a", 0, time.Now().Add(30*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	job := mustJob(t, s, "/downloads/a")
+	if job.NextRunAt.UnixMilli() != backoff.UnixMilli() || job.Attempts != 1 {
+		t.Errorf("job after enqueue during backoff = %+v, want next run at %v", job, backoff)
+	}
+
+	// 更晚的变化仍然推迟任务
+	later := backoff.Add(time.Minute)
+	if err := s.EnqueueJob("/downloads/a", 0, later); err != nil {
+		t.Fatal(err)
+	}
+	if job := mustJob(t, s, "/downloads/a"); job.NextRunAt.UnixMilli() != later.UnixMilli() {
+		t.Errorf("next run at %v, want %v", job.NextRunAt, later)
+	}
+}
+
+func TestEnqueueDoneJobStartsOver(t *testing.T) {
+	s := newTestStore(t)
+	startJob(t, s, "/downloads/a", 8)
+	if err := s.FinishJob("/downloads/a", JobDone, "", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	runAt := time.Now().Add(time.Minute)
+	if err := s.EnqueueJob("/downloads/a", 1, runAt); err != nil {
+		t.Fatal(err)
+	}
+	job := mustJob(t, s, "/downloads/a")
+	if job.State != JobQueued || job.Attempts != 0 || job.Priority != 1 || job.NextRunAt.UnixMilli() != runAt.UnixMilli() {
+		t.Errorf("done job after enqueue = %+v, want queued with the new priority", job)
+	}
+}
+
+func TestClaimReadyJobByPriority(t *testing.T) {
+	s := newTestStore(t)
+	now := time.Now()
+	for _, j := range []struct {
+		path     string
+		priority int
+	}{{"/downloads/low", 0}, {"/downloads/high", 10}, {"/downloads/mid", 5}, {"/downloads/waiting", 20}} {
+		if err := s.EnqueueJob(j.path, j.priority, now.Add(-time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, path := range []string{"/downloads/low", "/downloads/high", "/downloads/mid"} {
+		if ok, err := s.MarkJobReady(path, now); err != nil || !ok {
+			t.Fatalf("MarkJobReady(%s) = %v, %v", path, ok, err)
+		}
+	}
+	// waiting 优先级最高但还没有确认文件稳定，不会被取出
+	for _, want := range []string{"/downloads/high", "/downloads/mid", "/downloads/low"} {
+		job, err := s.ClaimReadyJob()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job == nil || job.Path != want || job.State != JobRunning || job.Attempts != 1 {
+			t.Fatalf("ClaimReadyJob() = %+v, want %s running", job, want)
+		}
+	}
+	if job, err := s.ClaimReadyJob(); err != nil || job != nil {
+		t.Errorf("ClaimReadyJob() = %+v, %v, want nil", job, err)
+	}
+}
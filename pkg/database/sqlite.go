@@ -21,18 +21,82 @@ const createTableSQL = `
 		path TEXT NOT NULL UNIQUE,
 		processed_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
+	CREATE TABLE IF NOT EXISTS album_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		path TEXT NOT NULL,
+		status TEXT NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		finished_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_album_runs_path ON album_runs (path);
+	CREATE TABLE IF NOT EXISTS track_results (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		run_id INTEGER NOT NULL REFERENCES album_runs (id) ON DELETE CASCADE,
+		disc INTEGER NOT NULL,
+		track INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		profile TEXT NOT NULL,
+		output_path TEXT NOT NULL,
+		sample_rate INTEGER NOT NULL DEFAULT 0,
+		bits_per_sample INTEGER NOT NULL DEFAULT 0,
+		channels INTEGER NOT NULL DEFAULT 0,
+		succeeded BOOLEAN NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		stderr TEXT NOT NULL DEFAULT '',
+		attempts INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_track_results_run ON track_results (run_id);
+	CREATE TABLE IF NOT EXISTS track_progress (
+		album_path TEXT NOT NULL,
+		profile TEXT NOT NULL,
+		rel_path TEXT NOT NULL,
+		duration_ms INTEGER NOT NULL,
+		size INTEGER NOT NULL,
+		checksum TEXT NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (album_path, profile, rel_path)
+	);
+	CREATE TABLE IF NOT EXISTS jobs (
+		path TEXT PRIMARY KEY,
+		state TEXT NOT NULL,
+		priority INTEGER NOT NULL DEFAULT 0,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_run_at INTEGER NOT NULL,
+		last_error TEXT NOT NULL DEFAULT '',
+		rerun BOOLEAN NOT NULL DEFAULT 0,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_jobs_state ON jobs (state, next_run_at);
 	`
 
+// migrations 是建表之后新增的列
+var migrations = []struct {
+	table, column, definition string
+}{
+	{"track_results", "sample_rate", "INTEGER NOT NULL DEFAULT 0"},
+	{"track_results", "bits_per_sample", "INTEGER NOT NULL DEFAULT 0"},
+	{"track_results", "channels", "INTEGER NOT NULL DEFAULT 0"},
+}
+
 // NewSQLiteStore 初始化 SQLite 数据库并返回 AlbumStore 接口实例
 func NewSQLiteStore(dataSourceName string, log *log.Logger) (AlbumStore, error) {
 	db, err := sql.Open("sqlite3", dataSourceName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open SQLite database: %w", err)
 	}
+	// 多张专辑和多条音轨会并发写入，SQLite 同一时间只允许一个写入者，使用单个连接让写入排队而不是返回 "database is locked"
+	db.SetMaxOpenConns(1)
 	// 尝试创建表，如果不存在
 	if _, err := db.Exec(createTableSQL); err != nil {
 		db.Close() // 创建表失败也要关闭连接
-		return nil, fmt.Errorf("failed to create processed_albums table: %w", err)
+		return nil, fmt.Errorf("failed to create tables: %w", err)
+	}
+	// 旧版本创建的表缺少后来加入的列
+	for _, m := range migrations {
+		if err := addColumnIfMissing(db, m.table, m.column, m.definition); err != nil {
+			db.Close()
+			return nil, err
+		}
 	}
 	log.Printf("SQLite database initialized at: %s", dataSourceName)
 	return &sqliteStore{db: db, logger: log}, nil
@@ -69,3 +133,116 @@ func (s *sqliteStore) IsAlbumProcessed(albumPath string) (bool, error) {
 	}
 	return count > 0, nil
 }
+
+// RecordAlbumRun 在一个事务中保存一次处理的结果及每条音轨的结果
+func (s *sqliteStore) RecordAlbumRun(run *AlbumRun) error {
+	finishedAt := run.FinishedAt
+	if finishedAt.IsZero() {
+		finishedAt = time.Now()
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("INSERT INTO album_runs (path, status, error, finished_at) VALUES (?, ?, ?, ?)",
+		run.Path, run.Status, run.Error, finishedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record run for %s: %w", run.Path, err)
+	}
+	runID, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to record run for %s: %w", run.Path, err)
+	}
+	stmt, err := tx.Prepare(`INSERT INTO track_results
+		(run_id, disc, track, title, profile, output_path, sample_rate, bits_per_sample, channels, succeeded, error, stderr, attempts)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare track result statement: %w", err)
+	}
+	defer stmt.Close()
+	for _, t := range run.Tracks {
+		if _, err := stmt.Exec(runID, t.Disc, t.Track, t.Title, t.Profile, t.OutputPath,
+			t.SampleRate, t.BitsPerSample, t.Channels, t.Succeeded, t.Error, t.Stderr, t.Attempts); err != nil {
+			return fmt.Errorf("failed to record track %d of %s: %w", t.Track, run.Path, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit run for %s: %w", run.Path, err)
+	}
+	s.logger.Printf("Recorded %s run for album %s (%d track results).", run.Status, run.Path, len(run.Tracks))
+	return nil
+}
+
+// SaveTrackProgress 记录一条已完成的音轨，同一路径的旧记录会被替换
+func (s *sqliteStore) SaveTrackProgress(p *TrackProgress) error {
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO track_progress
+		(album_path, profile, rel_path, duration_ms, size, checksum, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		p.AlbumPath, p.Profile, p.RelPath, p.Duration.Milliseconds(), p.Size, p.Checksum, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to save progress for %s: %w", p.RelPath, err)
+	}
+	return nil
+}
+
+// TrackProgress 返回专辑在一个输出上已完成的音轨，以相对路径为键
+func (s *sqliteStore) TrackProgress(albumPath, profile string) (map[string]TrackProgress, error) {
+	rows, err := s.db.Query(`SELECT rel_path, duration_ms, size, checksum, updated_at
+		FROM track_progress WHERE album_path = ? AND profile = ?`, albumPath, profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query progress for %s: %w", albumPath, err)
+	}
+	defer rows.Close()
+	progress := make(map[string]TrackProgress)
+	for rows.Next() {
+		p := TrackProgress{AlbumPath: albumPath, Profile: profile}
+		var durationMs int64
+		if err := rows.Scan(&p.RelPath, &durationMs, &p.Size, &p.Checksum, &p.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to read progress for %s: %w", albumPath, err)
+		}
+		p.Duration = time.Duration(durationMs) * time.Millisecond
+		progress[p.RelPath] = p
+	}
+	return progress, rows.Err()
+}
+
+// ClearTrackProgress 删除专辑的全部进度记录
+func (s *sqliteStore) ClearTrackProgress(albumPath string) error {
+	if _, err := s.db.Exec("DELETE FROM track_progress WHERE album_path = ?", albumPath); err != nil {
+		return fmt.Errorf("failed to clear progress for %s: %w", albumPath, err)
+	}
+	return nil
+}
+
+// addColumnIfMissing 在表中不存在该列时添加它
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to read schema of %s: %w", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return fmt.Errorf("failed to read schema of %s: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read schema of %s: %w", table, err)
+	}
+	rows.Close()
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package dirname
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/yleoer/music/pkg/config"
+)
+
+// Fields 是规则中可以使用的命名捕获组
+var Fields = []string{"artist", "title", "year", "label", "catalog"}
+
+// formatWord 是格式和来源的噪声词，其中 log、web、opus、cue、iso、ape 等也是常见的英文单词，
+// 只在括号中、全大写或用 +、/、& 连接时才作为噪声
+const formatWord = `flac|wav|ape|wv|tta|alac|aiff?|dsf|dff|iso|mp3|aac|m4a|ogg|opus|cue|log|web|lossless`
+
+// tagToken 是位深、采样率、介质以及整轨、无损等不会出现在专辑名中的噪声词
+const tagToken = `(?i:dsd(?:64|128|256)?|\d{2}\s*bits?|\d{2,3}(?:\.\d)?\s*k(?:hz)?|\d{2}[-/]\d{2,3}(?:\.\d)?(?:\s*k(?:hz)?)?|320k?|v0|` +
+	`hi-?res|sacd|xrcd\d*|k2hd|hdcd|shm-?cd|uhqcd|blu-?spec(?:\s*cd\d*)?|\d+\s*(?:cd|discs?)|` +
+	`无损|無損|整轨|整軌|分轨|分軌|镜像|鏡像)`
+
+const (
+	noiseToken     = `(?:(?i:` + formatWord + `)|` + tagToken + `)`
+	noiseSeparator = `[\s+_,/&.-]+`
+)
+
+// tagNoiseToken 是明显作为标签使用的噪声词：全大写的格式词 (FLAC、LOG) 或 tagToken
+var tagNoiseToken = `(?:` + strings.ToUpper(formatWord) + `|` + tagToken + `)`
+
+// builtinNoise 去掉只由噪声词组成的括号，如 [FLAC]、(WAV+CUE)、【24bit-96kHz】、(2CD)、(log)，以及目录名末尾明显是标签的噪声词，
+// 如 "WAV+CUE"、"FLAC 24bit"、"24bit flac"、"flac+cue"、"整轨"。末尾单独的小写或首字母大写的格式词保留，
+// 以免把 "Captain's Log"、"The Web"、"Opus" 这样的专辑名当作噪声
+var builtinNoise = []string{
+	`\s*[\[(【{]\s*` + noiseToken + `(?:` + noiseSeparator + noiseToken + `)*\s*[\])】}]`,
+	`(?:\s+|[-_])(?:` +
+		tagNoiseToken + `(?:` + noiseSeparator + tagNoiseToken + `)*|` +
+		tagToken + `(?:` + noiseSeparator + noiseToken + `)+|` +
+		noiseToken + `(?:\s*[+/&]\s*` + noiseToken + `)+` +
+		`)\s*$`,
+}
+
+const (
+	yearPrefix = `(?:[\[(](?P<year>(?:19|20)\d{2})[\])]\s*|(?P<year>(?:19|20)\d{2})(?:\s*[-.]\s+|\s+))`
+	yearSuffix = `(?:\s*[\[(](?P<year>(?:19|20)\d{2})[\])]|\s+(?P<year>(?:19|20)\d{2}))?`
+	// labelSuffix 匹配结尾的 "{Label CAT-001}"、"{CAT-001}" 或 "{Label}"
+	labelSuffix = `(?:\s*\{(?P<label>[^{}]*?)(?:\s*(?P<catalog>[A-Z]{2,}[A-Z0-9]*-?\d{2,}[A-Z0-9-]*))?\})?`
+)
+
+// builtinRules 是内置的规则，按顺序尝试，第一个匹配的规则生效；最后一条总能匹配，把整个目录名作为专辑名
+var builtinRules = []config.DirNameRule{
+	{Name: "year-artist-title", Pattern: `^` + yearPrefix + `(?P<artist>.+?)\s+[-–—]\s+(?P<title>.+?)` + labelSuffix + `$`},
+	{Name: "year-title", Pattern: `^` + yearPrefix + `(?P<title>.+?)` + labelSuffix + `$`},
+	{Name: "artist-book-title", Pattern: `^(?:(?P<artist>[^《]+?)\s*[-–—]?\s*)?《(?P<title>[^》]+)》` + yearSuffix + labelSuffix + `$`},
+	{Name: "artist-year-title", Pattern: `^(?P<artist>.+?)\s+[-–—]\s+[\[(]?(?P<year>(?:19|20)\d{2})[\])]?\s+[-–—]\s+(?P<title>.+?)` + labelSuffix + `$`},
+	{Name: "artist-title-year", Pattern: `^(?P<artist>.+?)\s+[-–—]\s+(?P<title>.+?)` + yearSuffix + labelSuffix + `$`},
+	// 没有空格的 "刘德华-笨小孩"，两侧不能是数字，以免拆开 "1993-1998"
+	{Name: "artist-title-compact", Pattern: `^(?P<artist>[^\s\d–—-][^-–—]*?[^\s\d–—-]|[^\s\d–—-])[-–—](?P<title>[^\s\d–—-].*?)` + yearSuffix + labelSuffix + `$`},
+	{Name: "title-year", Pattern: `^(?P<title>.+?)` + yearSuffix + labelSuffix + `$`},
+}
+
+// Result 是从目录名中解析出的专辑信息，未解析出的字段为空
+type Result struct {
+	Rule    string // 匹配的规则名
+	Cleaned string // 去掉噪声后的目录名
+	Artist  string
+	Title   string
+	Year    string
+	Label   string
+	Catalog string
+}
+
+type rule struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// Parser 按规则解析专辑目录名
+type Parser struct {
+	rules []rule
+	noise []*regexp.Regexp
+}
+
+// NewParser 创建解析器：用户定义的规则在内置规则之前，用户定义的噪声在内置噪声之后去除。
+// 规则的正则表达式无效、没有 title 捕获组或使用了未知的捕获组时返回错误
+func NewParser(rules []config.DirNameRule, noise []string) (*Parser, error) {
+	p := &Parser{}
+	for i, r := range append(append([]config.DirNameRule{}, rules...), builtinRules...) {
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("rule %d", i+1)
+		}
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid directory name rule %q: %w", name, err)
+		}
+		if err := checkGroups(re); err != nil {
+			return nil, fmt.Errorf("invalid directory name rule %q: %w", name, err)
+		}
+		p.rules = append(p.rules, rule{name: name, re: re})
+	}
+	for _, pattern := range append(append([]string{}, builtinNoise...), noise...) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid directory name noise pattern %q: %w", pattern, err)
+		}
+		p.noise = append(p.noise, re)
+	}
+	return p, nil
+}
+
+// checkGroups 确认规则包含 title 捕获组，且命名捕获组都在 Fields 中
+func checkGroups(re *regexp.Regexp) error {
+	if re.SubexpIndex("title") < 0 {
+		return fmt.Errorf("pattern %q has no named group title", re)
+	}
+	for _, name := range re.SubexpNames() {
+		known := name == ""
+		for _, f := range Fields {
+			known = known || name == f
+		}
+		if !known {
+			return fmt.Errorf("unknown group %q in pattern %q, available groups: %s", name, re, strings.Join(Fields, ", "))
+		}
+	}
+	return nil
+}
+
+// Clean 去掉目录名中的噪声，如 "[FLAC]"、"24bit"、"WAV+CUE"、"整轨"
+func (p *Parser) Clean(name string) string {
+	name = strings.TrimSpace(name)
+	for _, re := range p.noise {
+		name = strings.TrimSpace(re.ReplaceAllString(name, ""))
+	}
+	return name
+}
+
+// Parse 去掉噪声后依次尝试各规则，返回第一个匹配且 title 非空的规则解析出的信息，同名的捕获组取第一个非空的值。
+// 没有规则匹配时整个目录名作为专辑名
+func (p *Parser) Parse(name string) Result {
+	cleaned := p.Clean(name)
+	if cleaned == "" { // 目录名全是噪声
+		cleaned = strings.TrimSpace(name)
+	}
+	result := Result{Cleaned: cleaned, Title: cleaned}
+	for _, r := range p.rules {
+		m := r.re.FindStringSubmatch(cleaned)
+		if m == nil {
+			continue
+		}
+		values := make(map[string]string)
+		for i, group := range r.re.SubexpNames() {
+			if v := strings.TrimSpace(m[i]); group != "" && v != "" && values[group] == "" {
+				values[group] = v
+			}
+		}
+		if values["title"] == "" {
+			continue
+		}
+		return Result{
+			Rule:    r.name,
+			Cleaned: cleaned,
+			Artist:  values["artist"],
+			Title:   values["title"],
+			Year:    values["year"],
+			Label:   values["label"],
+			Catalog: values["catalog"],
+		}
+	}
+	return result
+}
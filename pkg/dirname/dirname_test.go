@@ -0,0 +1,68 @@
+package dirname
+
+import (
+	"testing"
+
+	"github.com/yleoer/music/pkg/config"
+)
+
+func TestParseBuiltinRules(t *testing.T) {
+	p, err := NewParser(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want Result // 不比较 Rule 和 Cleaned
+		rule string
+	}{
+		{"[1993] Artist - Title [FLAC]", Result{Artist: "Artist", Title: "Title", Year: "1993"}, "year-artist-title"},
+		{"1993 - Title", Result{Title: "Title", Year: "1993"}, "year-title"},
+		{"Artist《Title》", Result{Artist: "Artist", Title: "Title"}, "artist-book-title"},
+		{"陈奕迅《U87》[整轨][WAV+CUE]", Result{Artist: "陈奕迅", Title: "U87"}, "artist-book-title"},
+		{"Artist - 2001 - Title [WEB FLAC]", Result{Artist: "Artist", Title: "Title", Year: "2001"}, "artist-year-title"},
+		{"Artist - Title (1999) [24bit-96kHz FLAC]", Result{Artist: "Artist", Title: "Title", Year: "1999"}, "artist-title-year"},
+		{"劉德華 - 笨小孩 1993-1998 國語精選 WAV+CUE", Result{Artist: "劉德華", Title: "笨小孩 1993-1998 國語精選"}, "artist-title-year"},
+		{"Artist - Title FLAC 24bit", Result{Artist: "Artist", Title: "Title"}, "artist-title-year"},
+		{"Artist - Title 24bit flac", Result{Artist: "Artist", Title: "Title"}, "artist-title-year"},
+		{"Artist - Title flac+cue", Result{Artist: "Artist", Title: "Title"}, "artist-title-year"},
+		{"Taylor Swift - 1989", Result{Artist: "Taylor Swift", Title: "1989"}, "artist-title-year"},
+		{"Jay-Z - The Blueprint", Result{Artist: "Jay-Z", Title: "The Blueprint"}, "artist-title-year"},
+		{"刘德华-笨小孩 整轨", Result{Artist: "刘德华", Title: "笨小孩"}, "artist-title-compact"},
+		{"Title (2CD) {Label CAT-001}", Result{Title: "Title", Label: "Label", Catalog: "CAT-001"}, "title-year"},
+		{"Title {VICL-60185}", Result{Title: "Title", Catalog: "VICL-60185"}, "title-year"},
+		{"Album Name 2005", Result{Title: "Album Name", Year: "2005"}, "title-year"},
+		{"笨小孩 1993-1998 国语精选", Result{Title: "笨小孩 1993-1998 国语精选"}, "title-year"},
+		{"[FLAC]", Result{Title: "[FLAC]"}, "title-year"}, // 全是噪声时保留原名
+
+		// 末尾的普通单词不是噪声
+		{"Artist - Captain's Log", Result{Artist: "Artist", Title: "Captain's Log"}, "artist-title-year"},
+		{"Pink Floyd - The Web", Result{Artist: "Pink Floyd", Title: "The Web"}, "artist-title-year"},
+		{"Artist - Opus", Result{Artist: "Artist", Title: "Opus"}, "artist-title-year"},
+		{"Artist - Opus (FLAC)", Result{Artist: "Artist", Title: "Opus"}, "artist-title-year"},
+		{"Artist - Captain's Log (log)", Result{Artist: "Artist", Title: "Captain's Log"}, "artist-title-year"},
+	}
+	for _, tt := range tests {
+		got := p.Parse(tt.name)
+		if got.Artist != tt.want.Artist || got.Title != tt.want.Title || got.Year != tt.want.Year ||
+			got.Label != tt.want.Label || got.Catalog != tt.want.Catalog || got.Rule != tt.rule {
+			t.Errorf("Parse(%q) = %+v, want %+v with rule %q", tt.name, got, tt.want, tt.rule)
+		}
+	}
+}
+
+func TestParseUserRules(t *testing.T) {
+	p, err := NewParser([]config.DirNameRule{{Name: "by", Pattern: `^(?P<title>.+) by (?P<artist>.+)$`}}, []string{`\s*\(Remaster\)`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Parse("Song by Someone (Remaster) [FLAC]"); got.Rule != "by" || got.Artist != "Someone" || got.Title != "Song" {
+		t.Errorf("Parse() = %+v", got)
+	}
+	if _, err := NewParser([]config.DirNameRule{{Pattern: `(?P<album>.+)`}}, nil); err == nil {
+		t.Error("NewParser accepted a rule without a title group")
+	}
+	if _, err := NewParser(nil, []string{`(`}); err == nil {
+		t.Error("NewParser accepted an invalid noise pattern")
+	}
+}
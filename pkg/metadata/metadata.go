@@ -1,6 +1,8 @@
 package metadata
 
 import (
+	"context"
+
 	"github.com/yleoer/music/pkg/album"
 )
 
@@ -11,5 +13,7 @@ const (
 
 // Fetcher 定义获取元数据和歌词的接口
 type Fetcher interface {
-	FetchMetadataAndUpdateTrack(track *album.Track)
+	// FetchMetadataAndUpdateTrack 搜索音轨并补充在线 ID 和歌词。ctx 取消时放弃尚未完成的请求，
+	// 网络错误等可以稍后重试的错误满足 retry.IsTransient
+	FetchMetadataAndUpdateTrack(ctx context.Context, track *album.Track) error
 }
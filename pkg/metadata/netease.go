@@ -1,6 +1,7 @@
 package metadata
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"github.com/yleoer/music/pkg/album"
+	"github.com/yleoer/music/pkg/retry"
 )
 
 const NeteaseSearchAPI = "http://music.163.com/api/search/get/web"
@@ -39,11 +41,12 @@ type NeteaseLyricResult struct {
 type NeteaseClient struct {
 	baseURL    string
 	httpClient *http.Client
+	limiter    *rateLimiter // 限制请求频率，所有请求共享
 	logger     *log.Logger
 }
 
-// NewNeteaseClient 创建一个新的 NeteaseClient 实例
-func NewNeteaseClient(baseURL string, timeout time.Duration, logger *log.Logger) Fetcher {
+// NewNeteaseClient 创建一个新的 NeteaseClient 实例，相邻两次请求至少间隔 requestGap
+func NewNeteaseClient(baseURL string, timeout, requestGap time.Duration, logger *log.Logger) Fetcher {
 	if baseURL == "" {
 		baseURL = "http://music.163.com" // Default to Netease's base URL
 	}
@@ -52,12 +55,13 @@ func NewNeteaseClient(baseURL string, timeout time.Duration, logger *log.Logger)
 		httpClient: &http.Client{
 			Timeout: timeout,
 		},
-		logger: logger,
+		limiter: newRateLimiter(requestGap),
+		logger:  logger,
 	}
 }
 
-// FetchMetadataAndUpdateTrack 搜索并更新 Track 信息
-func (c *NeteaseClient) FetchMetadataAndUpdateTrack(track *album.Track) {
+// FetchMetadataAndUpdateTrack 搜索并更新 Track 信息，没有搜索结果不算错误
+func (c *NeteaseClient) FetchMetadataAndUpdateTrack(ctx context.Context, track *album.Track) error {
 	log.Printf("    -> Searching online for: [%s - %s]", track.Artist, track.Title)
 
 	query := fmt.Sprintf("%s %s", track.Title, track.Artist)
@@ -66,18 +70,14 @@ func (c *NeteaseClient) FetchMetadataAndUpdateTrack(track *album.Track) {
 	params.Add("type", "1") // 1 for songs
 	params.Add("limit", "5")
 
-	resp, err := http.Get(NeteaseSearchAPI + "?" + params.Encode())
+	body, err := c.get(ctx, NeteaseSearchAPI+"?"+params.Encode())
 	if err != nil {
-		log.Printf("    -> ERROR: Failed to search: %v", err)
-		return
+		return fmt.Errorf("search for '%s' failed: %w", query, err)
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
 	var result NeteaseSearchResult
 	if json.Unmarshal(body, &result) != nil || len(result.Result.Songs) == 0 {
 		log.Printf("    -> WARN: No results found for '%s'.", query)
-		return
+		return nil
 	}
 
 	// 简单匹配：选择第一个结果
@@ -86,25 +86,47 @@ func (c *NeteaseClient) FetchMetadataAndUpdateTrack(track *album.Track) {
 	log.Printf("    -> Matched song: %s (ID: %d)", bestMatch.Name, bestMatch.ID)
 
 	// 获取歌词
-	c.fetchLyrics(track)
+	return c.fetchLyrics(ctx, track)
 }
 
-func (c *NeteaseClient) fetchLyrics(track *album.Track) {
-	if track.OnlineID == 0 {
-		return
+// fetchLyrics 下载匹配到的歌曲的歌词，源文件标签中已有歌词时不覆盖
+func (c *NeteaseClient) fetchLyrics(ctx context.Context, track *album.Track) error {
+	if track.OnlineID == 0 || track.Lyrics != "" {
+		return nil
 	}
 	lyricURL := fmt.Sprintf("http://music.163.com/api/song/lyric?id=%d&lv=1&kv=1&tv=-1", track.OnlineID)
-	resp, err := http.Get(lyricURL)
+	body, err := c.get(ctx, lyricURL)
 	if err != nil {
-		log.Printf("    -> ERROR: Failed to get lyrics: %v", err)
-		return
+		return fmt.Errorf("failed to get lyrics: %w", err)
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
 	var lyricResult NeteaseLyricResult
 	if json.Unmarshal(body, &lyricResult) == nil {
 		track.Lyrics = lyricResult.Lrc.Lyric
 		log.Println("    -> Lyrics downloaded successfully.")
 	}
+	return nil
+}
+
+// get 在限流之后发出 GET 请求并返回响应内容，ctx 取消时中止等待和请求。
+// 服务端错误和限流 (5xx、429) 返回暂时性错误，可以稍后重试
+func (c *NeteaseClient) get(ctx context.Context, rawURL string) ([]byte, error) {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+		return nil, retry.Transient(fmt.Errorf("unexpected HTTP status %s", resp.Status))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
 }
@@ -0,0 +1,38 @@
+package metadata
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter 保证相邻两次请求之间至少间隔 gap，可被多个 goroutine 共享
+type rateLimiter struct {
+	gap  time.Duration
+	mu   sync.Mutex
+	next time.Time // 下一次允许请求的时间
+}
+
+func newRateLimiter(gap time.Duration) *rateLimiter {
+	return &rateLimiter{gap: gap}
+}
+
+// Wait 阻塞直到允许发出下一次请求，ctx 先被取消时返回 ctx.Err()
+func (r *rateLimiter) Wait(ctx context.Context) error {
+	r.mu.Lock()
+	now := time.Now()
+	wait := r.next.Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+	r.next = now.Add(wait + r.gap)
+	r.mu.Unlock()
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,316 @@
+package naming
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yleoer/music/pkg/util"
+)
+
+// DefaultTemplate 是默认的音乐库路径模板，年份缺失时省略 " (年份)"，单碟专辑不建 Disc 目录
+const DefaultTemplate = `{albumartist|artist|"Unknown Artist"}/{album}[ ({year})]/[Disc {disc:cond}/]{track:02} - {title}`
+
+// Fields 是模板中可以使用的字段
+var Fields = []string{
+	"albumartist", "artist", "album", "title", "year", "genre", "composer",
+	"track", "tracks", "disc", "discs", "catalog", "label",
+}
+
+// Template 是解析后的路径模板。语法：
+//
+//	{field}              字段值，经过 util.SanitizeFileName 清理，不会引入新的目录层级
+//	{a|b|"text"}         依次尝试字段 a、b，都为空时使用文本 "text" (同样经过清理)
+//	{field:02}           数字补零到指定宽度
+//	{field:.40}          最多保留 40 个字符
+//	{field:cond}         字段无意义时视为空，例如单碟专辑的 disc
+//	[ ... ]              可选片段，其中任一字段为空时整段省略，可以嵌套
+//	/                    目录分隔符
+//	\x                   转义字符 x
+type Template struct {
+	source string
+	nodes  []node
+}
+
+type node interface{}
+
+type textNode string
+
+type fieldNode struct {
+	alternatives []alternative
+	pad          int  // 补零宽度，0 表示不补零
+	maxLen       int  // 最多保留的字符数，0 表示不限制
+	cond         bool // 是否应用 :cond
+}
+
+type alternative struct {
+	field   string
+	literal string
+}
+
+type optionalNode []node
+
+// Values 是渲染模板时使用的字段值
+type Values struct {
+	Fields map[string]string
+	Hidden map[string]bool // 带 :cond 时视为空的字段
+}
+
+// Parse 解析并校验路径模板
+func Parse(source string) (*Template, error) {
+	p := &templateParser{src: []rune(source)}
+	nodes, err := p.parseNodes(false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path template %q: %w", source, err)
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("invalid path template %q: empty template", source)
+	}
+	return &Template{source: source, nodes: nodes}, nil
+}
+
+// String 返回模板原文
+func (t *Template) String() string {
+	return t.source
+}
+
+// Render 渲染模板并返回带扩展名 ext (不含点) 的相对路径。每一级目录名或文件名 (含扩展名)
+// 都会被截断到 maxComponentBytes 字节以内，为空的一级会被替换为 "_"
+func (t *Template) Render(values Values, ext string, maxComponentBytes int) string {
+	rendered, _ := renderNodes(t.nodes, values)
+	components := strings.Split(rendered, "/")
+	for i, c := range components {
+		limit := maxComponentBytes
+		if i == len(components)-1 && ext != "" {
+			limit -= len(ext) + 1
+			if maxComponentBytes > 0 {
+				limit = max(limit, 1) // 限制小于扩展名时也要截断，而不是视为不限制
+			}
+		}
+		c = strings.TrimSpace(c)
+		c = strings.TrimRight(truncateBytes(c, limit), ". ") // Windows/SMB 不允许以点或空格结尾
+		if c == "" {
+			c = "_"
+		}
+		components[i] = c
+	}
+	if ext != "" {
+		components[len(components)-1] += "." + ext
+	}
+	return filepath.Join(components...)
+}
+
+// renderNodes 渲染节点列表，第二个返回值表示其中是否有字段为空
+func renderNodes(nodes []node, values Values) (string, bool) {
+	var sb strings.Builder
+	missing := false
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case textNode:
+			sb.WriteString(string(n))
+		case fieldNode:
+			v := n.render(values)
+			if v == "" {
+				missing = true
+			}
+			sb.WriteString(v)
+		case optionalNode:
+			if s, m := renderNodes(n, values); !m {
+				sb.WriteString(s)
+			}
+		}
+	}
+	return sb.String(), missing
+}
+
+func (f fieldNode) render(values Values) string {
+	value := ""
+	for _, alt := range f.alternatives {
+		if alt.field == "" {
+			value = util.SanitizeFileName(alt.literal)
+			break
+		}
+		if f.cond && values.Hidden[alt.field] {
+			continue
+		}
+		if v := util.SanitizeFileName(values.Fields[alt.field]); v != "" {
+			value = v
+			break
+		}
+	}
+	if value == "" {
+		return ""
+	}
+	if f.pad > 0 {
+		if n, err := strconv.Atoi(value); err == nil {
+			value = fmt.Sprintf("%0*d", f.pad, n)
+		}
+	}
+	if f.maxLen > 0 && utf8.RuneCountInString(value) > f.maxLen {
+		value = strings.TrimSpace(string([]rune(value)[:f.maxLen]))
+	}
+	return value
+}
+
+// truncateBytes 在不拆分 UTF-8 字符的前提下截断到 max 字节
+func truncateBytes(s string, max int) string {
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return strings.TrimSpace(s[:cut])
+}
+
+type templateParser struct {
+	src []rune
+	pos int
+}
+
+func (p *templateParser) parseNodes(inOptional bool) ([]node, error) {
+	var nodes []node
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			nodes = append(nodes, textNode(text.String()))
+			text.Reset()
+		}
+	}
+	for p.pos < len(p.src) {
+		r := p.src[p.pos]
+		p.pos++
+		switch r {
+		case '\\':
+			if p.pos >= len(p.src) {
+				return nil, fmt.Errorf("dangling escape at end of template")
+			}
+			text.WriteRune(p.src[p.pos])
+			p.pos++
+		case '{':
+			flush()
+			field, err := p.parseField()
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, field)
+		case '}':
+			return nil, fmt.Errorf("unexpected '}' at position %d", p.pos)
+		case '[':
+			flush()
+			children, err := p.parseNodes(true)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, optionalNode(children))
+		case ']':
+			if !inOptional {
+				return nil, fmt.Errorf("unexpected ']' at position %d", p.pos)
+			}
+			flush()
+			return nodes, nil
+		default:
+			text.WriteRune(r)
+		}
+	}
+	if inOptional {
+		return nil, fmt.Errorf("unclosed '['")
+	}
+	flush()
+	return nodes, nil
+}
+
+// parseField 解析 '{' 之后直到 '}' 的字段表达式
+func (p *templateParser) parseField() (fieldNode, error) {
+	start := p.pos
+	var parts []string
+	var current strings.Builder
+	inQuotes := false
+	for {
+		if p.pos >= len(p.src) {
+			return fieldNode{}, fmt.Errorf("unclosed '{' at position %d", start)
+		}
+		r := p.src[p.pos]
+		p.pos++
+		if r == '"' {
+			inQuotes = !inQuotes
+			current.WriteRune(r)
+			continue
+		}
+		if inQuotes {
+			current.WriteRune(r)
+			continue
+		}
+		if r == '}' {
+			parts = append(parts, current.String())
+			break
+		}
+		if r == ':' {
+			parts = append(parts, current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteRune(r)
+	}
+
+	var f fieldNode
+	for _, alt := range splitAlternatives(parts[0]) {
+		alt = strings.TrimSpace(alt)
+		if len(alt) >= 2 && strings.HasPrefix(alt, `"`) && strings.HasSuffix(alt, `"`) {
+			f.alternatives = append(f.alternatives, alternative{literal: alt[1 : len(alt)-1]})
+			continue
+		}
+		if !isKnownField(alt) {
+			return fieldNode{}, fmt.Errorf("unknown field %q, available fields: %s", alt, strings.Join(Fields, ", "))
+		}
+		f.alternatives = append(f.alternatives, alternative{field: alt})
+	}
+	for _, mod := range parts[1:] {
+		mod = strings.TrimSpace(mod)
+		switch {
+		case mod == "cond":
+			f.cond = true
+		case strings.HasPrefix(mod, "."):
+			n, err := strconv.Atoi(mod[1:])
+			if err != nil || n <= 0 {
+				return fieldNode{}, fmt.Errorf("invalid length limit %q", mod)
+			}
+			f.maxLen = n
+		default:
+			n, err := strconv.Atoi(mod)
+			if err != nil || n <= 0 {
+				return fieldNode{}, fmt.Errorf("unknown modifier %q", mod)
+			}
+			f.pad = n
+		}
+	}
+	return f, nil
+}
+
+// splitAlternatives 按 '|' 拆分字段表达式中的备选项，引号内的 '|' 属于文本
+func splitAlternatives(expr string) []string {
+	var alts []string
+	inQuotes, start := false, 0
+	for i, r := range expr {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case r == '|' && !inQuotes:
+			alts = append(alts, expr[start:i])
+			start = i + 1
+		}
+	}
+	return append(alts, expr[start:])
+}
+
+func isKnownField(name string) bool {
+	for _, f := range Fields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
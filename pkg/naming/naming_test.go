@@ -0,0 +1,146 @@
+package naming
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// testValues 返回一张单碟专辑中第 3 首音轨的字段值，fields 中的值覆盖默认值
+func testValues(fields map[string]string) Values {
+	v := Values{
+		Fields: map[string]string{
+			"artist": "Artist", "album": "Album", "title": "Title", "year": "1993",
+			"track": "3", "tracks": "12", "disc": "1", "discs": "1",
+		},
+		Hidden: map[string]bool{"disc": true},
+	}
+	for k, value := range fields {
+		v.Fields[k] = value
+	}
+	return v
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		template string
+		fields   map[string]string
+		want     string
+	}{
+		{DefaultTemplate, nil, "Artist/Album (1993)/03 - Title.flac"},
+		{DefaultTemplate, map[string]string{"year": ""}, "Artist/Album/03 - Title.flac"},
+		{DefaultTemplate, map[string]string{"albumartist": "Various Artists"}, "Various Artists/Album (1993)/03 - Title.flac"},
+		{DefaultTemplate, map[string]string{"artist": ""}, "Unknown Artist/Album (1993)/03 - Title.flac"},
+
+		// 备选项和引号中的文本
+		{`{composer|artist}/{title}`, nil, "Artist/Title.flac"},
+		{`{genre|"No Genre"}/{title}`, nil, "No Genre/Title.flac"},
+		{`{genre|"Rock | Pop: Live"}/{title}`, nil, "Rock Pop Live/Title.flac"}, // 引号内的 | 和 : 不是分隔符，文本同样被清理
+		{`{genre|"a/b"}`, nil, "a_b.flac"},
+
+		// 补零和长度限制
+		{`{track:03}`, nil, "003.flac"},
+		{`{track:02}`, map[string]string{"track": "A1"}, "A1.flac"}, // 非数字不补零
+		{`{title:.5}`, map[string]string{"title": "Hello World"}, "Hello.flac"},
+		{`{title:.6}`, map[string]string{"title": "Hello World"}, "Hello.flac"}, // 截断后去掉末尾空格
+		{`{title:.3}`, map[string]string{"title": "一二三四五"}, "一二三.flac"},
+		{`{title:.20}`, nil, "Title.flac"},
+
+		// :cond
+		{`[Disc {disc:cond}/]{title}`, nil, "Title.flac"},
+		{`[Disc {disc:cond}/]{title}`, map[string]string{"disc": "2", "discs": "2"}, "Title.flac"}, // Hidden 仍为 true
+		{`[Disc {disc}/]{title}`, nil, "Disc 1/Title.flac"},
+
+		// 可选片段
+		{`{album}[ [{catalog} ]({year})]`, nil, "Album (1993).flac"}, // 内层为空不影响外层
+		{`{album}[ \[{catalog}\]]`, map[string]string{"catalog": "VICL-1"}, "Album [VICL-1].flac"},
+		{`{album}[ \[{catalog}\]]`, nil, "Album.flac"},
+		{`{album}[ {label} {catalog}]`, map[string]string{"label": "Label"}, "Album.flac"}, // 任一字段为空时整段省略
+
+		// 清理字段值和路径的每一级
+		{`{artist}/{album}`, map[string]string{"artist": "AC/DC", "album": `What? "Live"`}, "AC_DC/What Live.flac"},
+		{`{genre}/{title}`, nil, "_/Title.flac"},
+		{`{album}/{title}`, map[string]string{"album": "Vol. 1..."}, "Vol. 1/Title.flac"},
+	}
+	for _, tt := range tests {
+		tmpl, err := Parse(tt.template)
+		if err != nil {
+			t.Errorf("Parse(%q) = %v", tt.template, err)
+			continue
+		}
+		values := testValues(tt.fields)
+		if got, want := tmpl.Render(values, "flac", 255), filepath.FromSlash(tt.want); got != want {
+			t.Errorf("%s with %v: Render() = %q, want %q", tt.template, tt.fields, got, want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, template := range []string{
+		"",
+		"{unknown}",
+		"{}",
+		"{album|}",
+		"{album",
+		"album}",
+		"[{album}",
+		"{album}]",
+		`{album}\`,
+		`{"unclosed}`,
+		"{album:xx}",
+		"{album:0}",
+		"{album:-2}",
+		"{album:.0}",
+		"{album:.x}",
+	} {
+		if tmpl, err := Parse(template); err == nil {
+			t.Errorf("Parse(%q) = %v, want an error", template, tmpl)
+		}
+	}
+}
+
+func TestTruncateBytes(t *testing.T) {
+	s := "a中b𝄞文 cd" // 1、3、1、4、3 字节的字符混合
+	for n := 1; n <= len(s)+1; n++ {
+		got := truncateBytes(s, n)
+		if len(got) > n || !utf8.ValidString(got) || !strings.HasPrefix(s, got) {
+			t.Errorf("truncateBytes(%q, %d) = %q, want a valid prefix of at most %d bytes", s, n, got, n)
+		}
+	}
+	if got := truncateBytes(s, 0); got != s {
+		t.Errorf("truncateBytes(%q, 0) = %q, want no limit", s, got)
+	}
+}
+
+func TestRenderTruncatesComponents(t *testing.T) {
+	tmpl, err := Parse(DefaultTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := testValues(map[string]string{
+		"artist": strings.Repeat("周杰伦", 40),
+		"album":  strings.Repeat("𝄞", 70),
+		"title":  strings.Repeat("晴天", 50) + " (Live)",
+	})
+	for _, maxBytes := range []int{1, 4, 7, 20, 100, 255} {
+		rendered := tmpl.Render(values, "flac", maxBytes)
+		components := strings.Split(rendered, string(filepath.Separator))
+		if len(components) != 3 {
+			t.Errorf("Render(max %d) = %q, want 3 components", maxBytes, rendered)
+			continue
+		}
+		for i, c := range components {
+			limit := maxBytes
+			if i == len(components)-1 {
+				limit = max(maxBytes, len("_.flac")) // 扩展名总是保留
+			}
+			if len(c) > limit || !utf8.ValidString(c) {
+				t.Errorf("Render(max %d) component %q has %d bytes or splits a character", maxBytes, c, len(c))
+			}
+		}
+		if !strings.HasSuffix(rendered, ".flac") {
+			t.Errorf("Render(max %d) = %q, want the extension kept", maxBytes, rendered)
+		}
+	}
+}
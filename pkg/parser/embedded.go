@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/yleoer/music/pkg/album"
+	"github.com/yleoer/music/pkg/pathsafe"
+	"github.com/yleoer/music/pkg/tag"
+)
+
+// ErrNoEmbeddedCue 表示音频镜像中没有内嵌的 CUE
+var ErrNoEmbeddedCue = errors.New("no embedded cue sheet")
+
+// ProcessEmbeddedCue 读取音频镜像中内嵌的 CUE 并返回 Disc 对象，与 ProcessCueFile 走相同的处理流程。
+// 查找顺序：Vorbis comment / APEv2 中的 CUESHEET 文本标签 (包含标题等信息)，其次是 FLAC 的 CUESHEET 块
+func (c CueParser) ProcessEmbeddedCue(ctx context.Context, imagePath string, a *album.Album, discNumber int) (*album.Disc, error) {
+	root, err := pathsafe.NewRoot(a.Path)
+	if err != nil {
+		return nil, err
+	}
+	if imagePath, err = root.Check(imagePath); err != nil {
+		return nil, err
+	}
+	cueSheet, err := c.readEmbeddedCue(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	// 内嵌 CUE 的 FILE 通常是制作镜像前的文件名，统一指向镜像本身
+	files := make(map[string]bool)
+	for _, f := range cueSheet.Files {
+		files[f.Name] = true
+	}
+	if len(files) > 1 {
+		return nil, fmt.Errorf("embedded cue sheet in %s references %d files", imagePath, len(files))
+	}
+	name := filepath.Base(imagePath)
+	cueSheet.Files = []CueFile{{Name: name, Type: "WAVE"}}
+	for i := range cueSheet.Tracks {
+		track := &cueSheet.Tracks[i]
+		track.SourcePath = name
+		for num, idx := range track.Indexes {
+			idx.File = name
+			track.Indexes[num] = idx
+		}
+	}
+	return c.processCueSheet(ctx, cueSheet, root, imagePath, a, discNumber)
+}
+
+// readEmbeddedCue 根据扩展名从 FLAC 或 APEv2 标签中读取 CUE
+func (c CueParser) readEmbeddedCue(imagePath string) (*CueSheet, error) {
+	var content string
+	var block *tag.CueSheetBlock
+	sampleRate := 0
+	switch strings.ToLower(filepath.Ext(imagePath)) {
+	case ".flac":
+		meta, err := tag.ReadFLACMetadata(imagePath)
+		if err != nil {
+			return nil, err
+		}
+		content = meta.Comments.Get("CUESHEET")
+		block = meta.CueSheet
+		sampleRate = meta.StreamInfo.SampleRate
+	case ".ape", ".wv", ".tta":
+		apeTag, err := tag.ReadAPETag(imagePath)
+		if errors.Is(err, tag.ErrNoTag) {
+			return nil, ErrNoEmbeddedCue
+		} else if err != nil {
+			return nil, err
+		}
+		content = apeTag.Items.Get("CUESHEET")
+	default:
+		return nil, ErrNoEmbeddedCue
+	}
+
+	if strings.TrimSpace(content) != "" {
+		cueSheet, err := c.parseCueContent(content)
+		if err != nil {
+			return nil, fmt.Errorf("%w in embedded cue sheet of '%s'", err, imagePath)
+		}
+		return cueSheet, nil
+	}
+	if block != nil && sampleRate > 0 {
+		return cueSheetFromBlock(block, sampleRate)
+	}
+	return nil, ErrNoEmbeddedCue
+}
+
+// cueSheetFromBlock 将 FLAC CUESHEET 块转换为 CueSheet。块中只有采样偏移和 ISRC，没有标题等文本信息。
+// CD 来源的 CUESHEET 块中偏移总是 588 采样 (一帧) 的整数倍，换算为帧是精确的
+func cueSheetFromBlock(block *tag.CueSheetBlock, sampleRate int) (*CueSheet, error) {
+	toFrames := func(samples uint64) album.Frames {
+		return album.Frames(samples * album.FramesPerSecond / uint64(sampleRate))
+	}
+	cue := &CueSheet{
+		Catalog: block.CatalogNumber,
+		Rem:     make(map[string]string),
+	}
+	for _, t := range block.Tracks {
+		// lead-out 音轨 (CD 为 170，其他为 255) 只标记结束位置
+		if t.Number == 170 || t.Number == 255 || !t.IsAudio {
+			continue
+		}
+		track := album.Track{
+			Number:  t.Number,
+			ISRC:    t.ISRC,
+			Indexes: make(map[int]album.Index, len(t.Indexes)),
+			Rem:     make(map[string]string),
+		}
+		if t.PreEmphasis {
+			track.Flags = append(track.Flags, "PRE")
+		}
+		for _, idx := range t.Indexes {
+			track.Indexes[idx.Number] = album.Index{Offset: toFrames(t.Offset + idx.Offset)}
+		}
+		if _, ok := track.Indexes[1]; !ok {
+			return nil, fmt.Errorf("track %02d in CUESHEET block has no INDEX 01", t.Number)
+		}
+		cue.Tracks = append(cue.Tracks, track)
+	}
+	if len(cue.Tracks) == 0 {
+		return nil, ErrNoEmbeddedCue
+	}
+	return cue, nil
+}
@@ -2,47 +2,92 @@ package parser
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/yleoer/music/pkg/album"
+	"github.com/yleoer/music/pkg/audio"
 	"github.com/yleoer/music/pkg/converter"
+	"github.com/yleoer/music/pkg/pathsafe"
+	"github.com/yleoer/music/pkg/probe"
 	"github.com/yleoer/music/pkg/util"
 )
 
 // CueParser 负责解析 CUE 文件和 Info.txt
 type CueParser struct {
 	converter converter.TextConverter
+	prober    probe.Prober
 	logger    *log.Logger
 }
 
-// NewCueParser 创建一个新的 CueParser 实例
-func NewCueParser(tc converter.TextConverter, logger *log.Logger) *CueParser {
-	return &CueParser{converter: tc, logger: logger}
+// NewCueParser 创建一个新的 CueParser 实例，prober 用于读取镜像的音频参数和长度
+func NewCueParser(tc converter.TextConverter, prober probe.Prober, logger *log.Logger) *CueParser {
+	return &CueParser{converter: tc, prober: prober, logger: logger}
 }
 
+// CueSheet 是 CUE 文件解析后的结构，保留光盘级和音轨级的全部命令
 type CueSheet struct {
-	WavFile string
-	Tracks  []album.Track
+	Files      []CueFile // 按出现顺序排列的 FILE 命令
+	Catalog    string
+	CDTextFile string
+	Title      string
+	Performer  string
+	Songwriter string
+	Rem        map[string]string // 光盘级 REM 字段，键为大写
+	Tracks     []album.Track
 }
 
-// parseCueTime 将 MM:SS:FF 格式的时间字符串转换为 time.Duration
-func (c CueParser) parseCueTime(timeStr string) (time.Duration, error) {
+// CueFile 对应 CUE 中的一条 FILE 命令
+type CueFile struct {
+	Name string // CUE 中记录的文件名，通常是相对路径
+	Type string // 文件类型，如 WAVE、MP3、AIFF、BINARY
+}
+
+// parseCueTime 将 MM:SS:FF 格式的时间字符串转换为 CD 帧数，不做任何舍入
+func (c CueParser) parseCueTime(timeStr string) (album.Frames, error) {
 	parts := strings.Split(timeStr, ":")
 	if len(parts) != 3 {
 		return 0, fmt.Errorf("invalid time format: %s", timeStr)
 	}
-	minutes, _ := strconv.Atoi(parts[0])
-	seconds, _ := strconv.Atoi(parts[1])
-	frames, _ := strconv.Atoi(parts[2])
-	totalMilliseconds := int64(minutes*60*1000 + seconds*1000 + (frames*1000)/75)
-	return time.Duration(totalMilliseconds) * time.Millisecond, nil
+	minutes, err1 := strconv.Atoi(parts[0])
+	seconds, err2 := strconv.Atoi(parts[1])
+	frames, err3 := strconv.Atoi(parts[2])
+	if err1 != nil || err2 != nil || err3 != nil || seconds >= 60 || frames >= 75 {
+		return 0, fmt.Errorf("invalid time format: %s", timeStr)
+	}
+	return album.Frames((minutes*60+seconds)*album.FramesPerSecond + frames), nil
+}
+
+// tokenizeCueLine 将一行 CUE 命令拆分为参数，双引号内的空格不作为分隔符
+func tokenizeCueLine(line string) []string {
+	var tokens []string
+	var current strings.Builder
+	inQuotes, hasToken := false, false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			hasToken = true // 允许空字符串 ""
+		case (r == ' ' || r == '\t') && !inQuotes:
+			if hasToken {
+				tokens = append(tokens, current.String())
+				current.Reset()
+				hasToken = false
+			}
+		default:
+			current.WriteRune(r)
+			hasToken = true
+		}
+	}
+	if hasToken {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
 }
 
 // parseCueFile 解析 .cue 文件并返回一个 CueSheet 结构体
@@ -52,34 +97,98 @@ func (c CueParser) parseCueFile(cuePath string) (*CueSheet, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to read CUE file with encoding detection: %w", err)
 	}
+	cue, err := c.parseCueContent(content)
+	if err != nil {
+		return nil, fmt.Errorf("%w in cue file '%s'", err, cuePath)
+	}
+	return cue, nil
+}
 
-	cue := &CueSheet{}
+// parseCueContent 按行分词解析 CUE 内容。第一个 TRACK 之前的命令属于光盘级，之后的属于当前音轨
+func (c CueParser) parseCueContent(content string) (*CueSheet, error) {
+	cue := &CueSheet{Rem: make(map[string]string)}
 	var currentTrack *album.Track
-
-	fileRegex := regexp.MustCompile(`(?i)FILE "([^"]+)"`) // (?i) for case-insensitive
-	trackRegex := regexp.MustCompile(`(?i)TRACK (\d+) AUDIO`)
-	titleRegex := regexp.MustCompile(`(?i)TITLE "([^"]+)"`)
-	indexRegex := regexp.MustCompile(`(?i)INDEX 01 (\d{2}:\d{2}:\d{2})`)
+	currentFile := ""
 
 	// 使用 bufio.NewScanner 处理已经解码为 UTF-8 的内容
 	scanner := bufio.NewScanner(strings.NewReader(content))
+	lineNo := 0
 	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if matches := fileRegex.FindStringSubmatch(line); len(matches) > 1 {
-			cue.WavFile = matches[1]
-		} else if matches := trackRegex.FindStringSubmatch(line); len(matches) > 1 {
+		lineNo++
+		tokens := tokenizeCueLine(strings.TrimSpace(scanner.Text()))
+		if len(tokens) == 0 {
+			continue
+		}
+		command := strings.ToUpper(tokens[0])
+		args := tokens[1:]
+		arg := func(i int) string {
+			if i < len(args) {
+				return args[i]
+			}
+			return ""
+		}
+
+		switch command {
+		case "FILE":
+			currentFile = arg(0)
+			cue.Files = append(cue.Files, CueFile{Name: currentFile, Type: strings.ToUpper(arg(1))})
+		case "CATALOG":
+			cue.Catalog = arg(0)
+		case "CDTEXTFILE":
+			cue.CDTextFile = arg(0)
+		case "TRACK":
 			if currentTrack != nil {
 				cue.Tracks = append(cue.Tracks, *currentTrack)
 			}
-			num, _ := strconv.Atoi(matches[1])
-			currentTrack = &album.Track{Number: num}
-		} else if currentTrack != nil {
-			if matches := titleRegex.FindStringSubmatch(line); len(matches) > 1 {
-				currentTrack.Title = matches[1]
-			} else if matches := indexRegex.FindStringSubmatch(line); len(matches) > 1 {
-				startTime, _ := c.parseCueTime(matches[1])
-				currentTrack.StartTime = startTime
+			num, err := strconv.Atoi(arg(0))
+			if err != nil {
+				return nil, fmt.Errorf("invalid TRACK number '%s' at line %d", arg(0), lineNo)
+			}
+			currentTrack = &album.Track{
+				Number:     num,
+				SourcePath: currentFile,
+				Indexes:    make(map[int]album.Index),
+				Rem:        make(map[string]string),
+			}
+		case "TITLE":
+			if currentTrack != nil {
+				currentTrack.Title = arg(0)
+			} else {
+				cue.Title = arg(0)
+			}
+		case "PERFORMER":
+			if currentTrack != nil {
+				currentTrack.Artist = arg(0)
+			} else {
+				cue.Performer = arg(0)
+			}
+		case "SONGWRITER":
+			if currentTrack != nil {
+				currentTrack.Songwriter = arg(0)
+			} else {
+				cue.Songwriter = arg(0)
+			}
+		case "REM":
+			if len(args) == 0 {
+				continue
+			}
+			key := strings.ToUpper(args[0])
+			value := strings.Join(args[1:], " ")
+			if currentTrack != nil {
+				currentTrack.Rem[key] = value
+			} else {
+				cue.Rem[key] = value
+			}
+		case "ISRC", "FLAGS", "INDEX", "PREGAP", "POSTGAP":
+			if currentTrack == nil {
+				c.logger.Printf("Warning: %s outside of TRACK at line %d, ignored.", command, lineNo)
+				continue
 			}
+			if err := c.applyTrackCommand(currentTrack, currentFile, command, args); err != nil {
+				return nil, fmt.Errorf("%v at line %d", err, lineNo)
+			}
+		default:
+			c.logger.Printf("Warning: Unknown CUE command '%s' at line %d, ignored.", tokens[0], lineNo)
 		}
 	}
 	if currentTrack != nil {
@@ -90,65 +199,206 @@ func (c CueParser) parseCueFile(cuePath string) (*CueSheet, error) {
 		return nil, err
 	}
 	if len(cue.Tracks) == 0 {
-		return nil, fmt.Errorf("no tracks found in cue file '%s'", cuePath)
+		return nil, fmt.Errorf("no tracks found")
+	}
+	for _, track := range cue.Tracks {
+		if _, ok := track.Indexes[1]; !ok {
+			return nil, fmt.Errorf("track %02d has no INDEX 01", track.Number)
+		}
+		if track.SourcePath == "" {
+			return nil, fmt.Errorf("track %02d is not preceded by a FILE command", track.Number)
+		}
 	}
 
 	return cue, nil
 }
 
+// applyTrackCommand 处理只在音轨范围内有效的命令。currentFile 是最近一条 FILE 命令的文件名，
+// INDEX 的位置总是相对于它
+func (c CueParser) applyTrackCommand(track *album.Track, currentFile, command string, args []string) error {
+	switch command {
+	case "ISRC":
+		if len(args) > 0 {
+			track.ISRC = args[0]
+		}
+	case "FLAGS":
+		for _, flag := range args {
+			track.Flags = append(track.Flags, strings.ToUpper(flag))
+		}
+	case "INDEX":
+		if len(args) < 2 {
+			return fmt.Errorf("malformed INDEX command")
+		}
+		num, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid INDEX number '%s'", args[0])
+		}
+		pos, err := c.parseCueTime(args[1])
+		if err != nil {
+			return err
+		}
+		track.Indexes[num] = album.Index{File: currentFile, Offset: pos}
+		if num == 1 {
+			// 音轨的音频来自 INDEX 01 所在的文件 ("gaps appended" 布局中 INDEX 00 可能在上一个文件里)
+			track.SourcePath = currentFile
+		}
+	case "PREGAP", "POSTGAP":
+		if len(args) < 1 {
+			return fmt.Errorf("malformed %s command", command)
+		}
+		gap, err := c.parseCueTime(args[0])
+		if err != nil {
+			return err
+		}
+		if command == "PREGAP" {
+			track.Pregap = gap
+		} else {
+			track.Postgap = gap
+		}
+	}
+	return nil
+}
+
 // ProcessCueFile 读取并解析 CUE 文件，返回 Disc 对象（此函数在 scanner.go 中被调用，需要确保能访问到 parser.go 中的函数）
 // 这里是其简化版本，确保它能正确调用 parseCueFile
-func (c CueParser) ProcessCueFile(cuePath string, a *album.Album, discNumber int) (*album.Disc, error) {
+func (c CueParser) ProcessCueFile(ctx context.Context, cuePath string, a *album.Album, discNumber int) (*album.Disc, error) {
+	root, err := pathsafe.NewRoot(a.Path)
+	if err != nil {
+		return nil, err
+	}
+	if cuePath, err = root.Check(cuePath); err != nil {
+		return nil, err
+	}
 	cueSheet, err := c.parseCueFile(cuePath)
 	if err != nil {
 		return nil, err
 	}
+	return c.processCueSheet(ctx, cueSheet, root, cuePath, a, discNumber)
+}
+
+// processCueSheet 将解析后的 CueSheet 转换为 Disc。cuePath 用于定位 FILE 引用的音频文件，
+// 对于内嵌 CUE 则是镜像文件本身。FILE 引用的文件必须位于专辑目录 root 内
+func (c CueParser) processCueSheet(ctx context.Context, cueSheet *CueSheet, root *pathsafe.Root, cuePath string, a *album.Album, discNumber int) (*album.Disc, error) {
+	// 确定每个 FILE 对应音频文件的路径。CUE 文件中的文件名可能是相对路径。
+	// 引用的文件不存在时，会尝试同名的其他无损格式，替换记录在 Disc.Substitutions 中
+	sourcePaths := make(map[string]string, len(cueSheet.Files))
+	substitutions := make(map[string]string)
+	var files []string
+	for _, f := range cueSheet.Files {
+		if _, ok := sourcePaths[f.Name]; ok {
+			continue
+		}
+		sourcePath, substituted, err := c.resolveSourceFile(root, cuePath, f.Name, len(cueSheet.Files) == 1)
+		if err != nil {
+			return nil, err
+		}
+		if substituted {
+			c.logger.Printf("Warning: File '%s' specified in CUE %s not found, using '%s' instead.", f.Name, cuePath, sourcePath)
+			substitutions[f.Name] = sourcePath
+		}
+		sourcePaths[f.Name] = sourcePath
+		files = append(files, sourcePath)
+	}
+	formats := make(map[string]audio.Format, len(files))
+	for _, sourcePath := range files {
+		formats[sourcePath] = c.readFormat(ctx, sourcePath)
+	}
+	if err := validateIndexes(cueSheet, sourcePaths, formats); err != nil {
+		return nil, fmt.Errorf("invalid cue sheet '%s': %w", cuePath, err)
+	}
 
-	// 确定 WAV 文件的路径。CUE 文件中的 WAV 文件名可能是相对路径。
-	wavFileInCue := cueSheet.WavFile
-	sourceWavPath := filepath.Join(filepath.Dir(cuePath), wavFileInCue)
-	if _, err := os.Stat(sourceWavPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("source WAV file '%s' specified in CUE not found", sourceWavPath)
+	// 专辑信息缺失时，用 CUE 光盘级的 PERFORMER/TITLE/REM DATE 补全
+	if (a.Artist == "" || a.Artist == "Unknown Artist") && cueSheet.Performer != "" {
+		a.Artist = c.converter.TradToSim(cueSheet.Performer)
+	}
+	if a.Title == "" && cueSheet.Title != "" {
+		a.Title = c.converter.TradToSim(cueSheet.Title)
 	}
+	if a.Year == "" {
+		a.Year = yearFromDate(cueSheet.Rem["DATE"])
+	}
+	// CUE 中也没有的，用镜像文件自身的标签补全
+	c.fillAlbumFromTags(a, c.readTags(files[0]))
 
 	disc := &album.Disc{
-		DiscNumber: discNumber,
-		CuePath:    cuePath,
-		WavPath:    sourceWavPath,
-		Tracks:     make([]*album.Track, 0, len(cueSheet.Tracks)),
+		DiscNumber:    discNumber,
+		CuePath:       cuePath,
+		ImagePath:     files[0],
+		Files:         files,
+		Substitutions: substitutions,
+		Tracks:        make([]*album.Track, 0, len(cueSheet.Tracks)),
+		Catalog:       cueSheet.Catalog,
+		Title:         c.converter.TradToSim(cueSheet.Title),
+		Performer:     c.converter.TradToSim(cueSheet.Performer),
+		Songwriter:    c.converter.TradToSim(cueSheet.Songwriter),
+		Genre:         cueSheet.Rem["GENRE"],
+		Date:          cueSheet.Rem["DATE"],
+		DiscID:        cueSheet.Rem["DISCID"],
+		Comment:       cueSheet.Rem["COMMENT"],
+		Rem:           cueSheet.Rem,
 	}
 
-	// 填充轨道信息，计算 EndTime
+	// 填充轨道信息，计算每个音轨的采样区间
 	for i, cueTrack := range cueSheet.Tracks {
 		track := &album.Track{
 			Number:      cueTrack.Number,
+			DiscNumber:  discNumber,
 			Title:       c.converter.TradToSim(cueTrack.Title), // CUE 中的标题也可能需要繁转简
 			Album:       a.Title,
 			AlbumArtist: a.Artist,
 			Artist:      a.Artist, // 默认与专辑艺术家相同，之后可能被网络元数据覆盖
 			Year:        a.Year,
-			StartTime:   cueTrack.StartTime,
+			Songwriter:  c.converter.TradToSim(firstNonEmpty(cueTrack.Songwriter, cueSheet.Songwriter)),
+			ISRC:        cueTrack.ISRC,
+			Flags:       cueTrack.Flags,
+			Pregap:      cueTrack.Pregap,
+			Postgap:     cueTrack.Postgap,
+			Indexes:     make(map[int]album.Index, len(cueTrack.Indexes)),
+			Genre:       firstNonEmpty(cueTrack.Rem["GENRE"], cueSheet.Rem["GENRE"]),
+			Comment:     firstNonEmpty(cueTrack.Rem["COMMENT"], cueSheet.Rem["COMMENT"]),
+			Rem:         make(map[string]string, len(cueSheet.Rem)+len(cueTrack.Rem)),
 		}
-
-		// 分离合唱艺术家 (根据CUE标题解析) - 简单示例
-		if strings.Contains(track.Title, " （与") || strings.Contains(track.Title, " (与") {
-			// 示例： "笨小孩（与柯受良、吴宗宪合唱）"
-			reFt := regexp.MustCompile(`(.+)[ （](?:与|feat\.)(.+)[）)]`)
-			if matches := reFt.FindStringSubmatch(track.Title); len(matches) > 2 {
-				track.Title = strings.TrimSpace(matches[1])
-				track.Artist = fmt.Sprintf("%s, %s", a.Artist, c.converter.TradToSim(matches[2])) // 歌曲艺术家
-			}
+		// 音轨级 PERFORMER 优先 (合唱曲目通常在此列出全部艺术家)，否则沿用专辑艺术家。
+		// CUE 没有提供的标题 (例如来自 FLAC CUESHEET 块的音轨) 和艺术家由扫描器在确定光盘编号后用旁注文件的曲目表替换
+		if cueTrack.Artist != "" {
+			track.Artist = c.converter.TradToSim(cueTrack.Artist)
 		} else {
-			track.Artist = a.Artist // 默认与专辑艺术家相同
+			track.GuessedArtist = true
+		}
+		if track.Title == "" {
+			track.Title = fmt.Sprintf("Track %02d", track.Number)
+			track.GuessedTitle = true
+		}
+		if track.Year == "" {
+			track.Year = yearFromDate(firstNonEmpty(cueTrack.Rem["DATE"], cueSheet.Rem["DATE"]))
+		}
+		for num, idx := range cueTrack.Indexes {
+			track.Indexes[num] = album.Index{File: sourcePaths[idx.File], Offset: idx.Offset}
+		}
+		for k, v := range cueSheet.Rem {
+			track.Rem[k] = v
+		}
+		for k, v := range cueTrack.Rem {
+			track.Rem[k] = v
 		}
 
-		// 计算当前轨道的结束时间
-		if i+1 < len(cueSheet.Tracks) {
-			track.EndTime = cueSheet.Tracks[i+1].StartTime
-		} else {
-			// 最后一个轨道的结束时间无法从CUE直接获得，需要额外处理，
-			// 比如通过解析WAV文件时长或在FFmpeg中省略-to参数（切割到文件结尾）
-			// 目前，我们让FFmpeg默认切割到文件末尾即可（不提供-to）
+		// 计算当前轨道所在的文件及起止位置
+		source, start, end := trackBounds(cueSheet.Tracks, i)
+		track.SourcePath = sourcePaths[source]
+		format := formats[track.SourcePath]
+		track.SampleRate = format.SampleRate
+		track.BitsPerSample = format.BitsPerSample
+		track.Channels = format.Channels
+		track.StartSample = start.Samples(track.SampleRate)
+		// 文件的最后一轨切割到文件结尾。长度未知或只是估算值时结束位置为 0，由转码器读到文件结尾，
+		// 避免按不准确的长度截断音轨或校验输出的采样数
+		if end > 0 {
+			track.EndSample = end.Samples(track.SampleRate)
+		} else if format.ExactLength {
+			track.EndSample = format.TotalSamples
+		}
+		if track.EndSample > 0 && track.EndSample <= track.StartSample {
+			return nil, fmt.Errorf("track %02d in '%s' ends before it starts", track.Number, cuePath)
 		}
 
 		disc.Tracks = append(disc.Tracks, track)
@@ -156,3 +406,152 @@ func (c CueParser) ProcessCueFile(cuePath string, a *album.Album, discNumber int
 
 	return disc, nil
 }
+
+// resolveSourceFile 确定 CUE 中 FILE 对应的音频文件路径，按以下顺序查找：
+//  1. CUE 所在目录下的同名文件 (文件名大小写不敏感)；
+//  2. 同名但扩展名为其他无损格式的文件，如 CUE 写 album.wav 而实际是 album.flac/album.ape；
+//  3. 仅当 CUE 只有一个 FILE 时：与 CUE 同名的无损镜像，或目录中唯一的无损镜像。
+//
+// 第二个返回值表示是否使用了与 CUE 记录不同的文件。指向专辑目录之外 (绝对路径、".."、符号链接) 的文件会被拒绝，
+// 返回的错误满足 errors.Is(err, pathsafe.ErrUnsafePath)
+func (c CueParser) resolveSourceFile(root *pathsafe.Root, cuePath, name string, singleFile bool) (string, bool, error) {
+	sourcePath, err := root.Join(filepath.Dir(cuePath), name)
+	if err != nil {
+		return "", false, err
+	}
+	checked := func(path string, substituted bool) (string, bool, error) {
+		path, err := root.Check(path)
+		if err != nil {
+			return "", false, err
+		}
+		return path, substituted, nil
+	}
+	if _, err := os.Stat(sourcePath); err == nil {
+		return checked(sourcePath, false)
+	}
+	entries, err := os.ReadDir(filepath.Dir(sourcePath))
+	if err != nil {
+		return "", false, fmt.Errorf("source file '%s' specified in CUE not found: %w", sourcePath, err)
+	}
+	findFile := func(fileName string) string {
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.EqualFold(entry.Name(), fileName) {
+				return filepath.Join(filepath.Dir(sourcePath), entry.Name())
+			}
+		}
+		return ""
+	}
+	if found := findFile(filepath.Base(sourcePath)); found != "" {
+		return checked(found, false)
+	}
+	baseName := strings.TrimSuffix(filepath.Base(sourcePath), filepath.Ext(sourcePath))
+	for _, ext := range util.LosslessImageExts {
+		if found := findFile(baseName + ext); found != "" {
+			return checked(found, true)
+		}
+	}
+	if singleFile {
+		cueBaseName := strings.TrimSuffix(filepath.Base(cuePath), filepath.Ext(cuePath))
+		for _, ext := range util.LosslessImageExts {
+			if found := findFile(cueBaseName + ext); found != "" {
+				return checked(found, true)
+			}
+		}
+		var images []string
+		for _, entry := range entries {
+			if !entry.IsDir() && util.IsLosslessImageFile(entry.Name()) {
+				images = append(images, filepath.Join(filepath.Dir(sourcePath), entry.Name()))
+			}
+		}
+		if len(images) == 1 {
+			return checked(images[0], true)
+		}
+	}
+	return "", false, fmt.Errorf("source file '%s' specified in CUE not found", sourcePath)
+}
+
+// readFormat 读取音频文件的参数，用于将 CUE 帧换算为采样偏移并确定最后一个音轨的结束位置。
+// 无法读取时按 CD 的 44100Hz 换算，其他参数和长度未知
+func (c CueParser) readFormat(ctx context.Context, path string) audio.Format {
+	format, err := c.prober.Probe(ctx, path)
+	if err != nil || format.SampleRate <= 0 {
+		c.logger.Printf("Warning: Could not read audio format of %s, assuming %dHz with unknown length: %v", path, album.CDSampleRate, err)
+		return audio.Format{SampleRate: album.CDSampleRate}
+	}
+	if format.TotalSamples == 0 {
+		c.logger.Printf("Warning: Could not determine the length of %s, the last track will be cut to the end of the file.", path)
+	} else if !format.ExactLength {
+		c.logger.Printf("Warning: The length of %s is only estimated, the last track will be cut to the end of the file.", path)
+	}
+	return format
+}
+
+// validateIndexes 拒绝 INDEX 位置超出镜像长度的 CUE，这通常意味着 CUE 与镜像不匹配 (如不同版本的抓轨)
+func validateIndexes(cueSheet *CueSheet, sourcePaths map[string]string, formats map[string]audio.Format) error {
+	for _, track := range cueSheet.Tracks {
+		for num, idx := range track.Indexes {
+			format := formats[sourcePaths[idx.File]]
+			if format.TotalSamples == 0 {
+				continue
+			}
+			if idx.Offset.Samples(format.SampleRate) >= format.TotalSamples {
+				length := album.Frames(format.TotalSamples * album.FramesPerSecond / int64(format.SampleRate))
+				return fmt.Errorf("track %02d INDEX %02d at %s is beyond the end of '%s' (%s)",
+					track.Number, num, formatCueTime(idx.Offset), idx.File, formatCueTime(length))
+			}
+		}
+	}
+	return nil
+}
+
+// formatCueTime 将 CD 帧数格式化为 CUE 使用的 MM:SS:FF
+func formatCueTime(f album.Frames) string {
+	return fmt.Sprintf("%02d:%02d:%02d", f/album.FramesPerSecond/60, f/album.FramesPerSecond%60, f%album.FramesPerSecond)
+}
+
+// trackBounds 计算第 i 个音轨在其音频文件中的区间，兼容单文件、"gaps appended" 和 "noncompliant" 布局：
+//   - 音轨总是从 INDEX 01 所在的文件中切割；
+//   - 下一个音轨的 INDEX 01 在同一文件中时，以它作为结束位置；否则切割到文件结尾 (end 为 0)，
+//     "gaps appended" 布局中附加在文件末尾的下一轨间隙因此归入当前音轨；
+//   - 若音轨的 INDEX 00 与 INDEX 01 在同一文件中，而上一音轨位于其他文件 ("noncompliant"/间隙前置布局)，
+//     则从 INDEX 00 开始切割，避免文件开头的间隙被丢弃。
+func trackBounds(tracks []album.Track, i int) (source string, start, end album.Frames) {
+	track := tracks[i]
+	index01 := track.Indexes[1]
+	source, start = index01.File, index01.Offset
+	if i > 0 && tracks[i-1].Indexes[1].File != source {
+		if index00, ok := track.Indexes[0]; ok && index00.File == source {
+			start = index00.Offset
+		}
+	}
+	if i+1 < len(tracks) {
+		next := tracks[i+1].Indexes[1]
+		if next.File == source {
+			end = next.Offset
+		}
+	}
+	// 最后一个轨道的结束时间无法从CUE直接获得，需要额外处理，
+	// 比如通过解析WAV文件时长或在FFmpeg中省略-to参数（切割到文件结尾）
+	// 目前，我们让FFmpeg默认切割到文件末尾即可（不提供-to）
+	return source, start, end
+}
+
+// yearFromDate 从 REM DATE (如 "1993" 或 "1993/05/01") 中提取四位年份
+func yearFromDate(date string) string {
+	date = strings.TrimSpace(date)
+	if len(date) >= 4 {
+		if _, err := strconv.Atoi(date[:4]); err == nil {
+			return date[:4]
+		}
+	}
+	return ""
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,355 @@
+package parser
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yleoer/music/pkg/album"
+	"github.com/yleoer/music/pkg/audio"
+	"github.com/yleoer/music/pkg/pathsafe"
+)
+
+// identityConverter 不做任何转换
+type identityConverter struct{}
+
+func (identityConverter) TradToSim(text string) string { return text }
+
+// fakeProber 按文件名返回固定的音频参数
+type fakeProber map[string]audio.Format
+
+func (p fakeProber) Probe(_ context.Context, path string) (audio.Format, error) {
+	return p[filepath.Base(path)], nil
+}
+
+func newTestParser(formats fakeProber) *CueParser {
+	return NewCueParser(identityConverter{}, formats, log.New(io.Discard, "", 0))
+}
+
+// cueLines 将每行 CUE 命令拼接为文件内容
+func cueLines(lines ...string) string {
+	return strings.Join(lines, "\n")
+}
+
+func TestTokenizeCueLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{`FILE "My Album.wav" WAVE`, []string{"FILE", "My Album.wav", "WAVE"}},
+		{`PERFORMER "Simon & Garfunkel"`, []string{"PERFORMER", "Simon & Garfunkel"}},
+		{`TITLE ""`, []string{"TITLE", ""}},
+		{`TITLE "He said "hi""`, []string{"TITLE", "He said hi"}}, // 引号只切换引用状态，不出现在结果中
+		{`REM COMMENT "ExactAudioCopy v1.0b3"`, []string{"REM", "COMMENT", "ExactAudioCopy v1.0b3"}},
+		{"INDEX\t01   00:00:00", []string{"INDEX", "01", "00:00:00"}},
+		{`TITLE "  两侧的空格  "`, []string{"TITLE", "  两侧的空格  "}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := tokenizeCueLine(tt.line); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokenizeCueLine(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseCueContent(t *testing.T) {
+	content := cueLines(
+		`REM GENRE "J-Pop"`,
+		`REM DATE 1993`,
+		`PERFORMER "Disc Artist"`,
+		`TITLE "Disc Title"`,
+		`SONGWRITER "Disc Writer"`,
+		`CATALOG 4988002000000`,
+		`FILE "CD Image.wav" WAVE`,
+		`  TRACK 01 AUDIO`,
+		`    TITLE "First Song"`,
+		`    PERFORMER "Track Artist"`,
+		`    REM COMPOSER "Some One"`,
+		`    INDEX 01 00:00:00`,
+		`  TRACK 02 AUDIO`,
+		`    TITLE "Second"`,
+		`    FLAGS dcp PRE`,
+		`    ISRC JPXX09300001`,
+		`    PREGAP 00:01:00`,
+		`    INDEX 00 03:58:70`,
+		`    INDEX 01 04:00:00`,
+	)
+	cue, err := newTestParser(nil).parseCueContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cue.Title != "Disc Title" || cue.Performer != "Disc Artist" || cue.Songwriter != "Disc Writer" || cue.Catalog != "4988002000000" {
+		t.Errorf("disc fields = %q, %q, %q, %q", cue.Title, cue.Performer, cue.Songwriter, cue.Catalog)
+	}
+	if want := map[string]string{"GENRE": "J-Pop", "DATE": "1993"}; !reflect.DeepEqual(cue.Rem, want) {
+		t.Errorf("disc REM = %v, want %v", cue.Rem, want)
+	}
+	if want := []CueFile{{Name: "CD Image.wav", Type: "WAVE"}}; !reflect.DeepEqual(cue.Files, want) {
+		t.Errorf("files = %+v, want %+v", cue.Files, want)
+	}
+	if len(cue.Tracks) != 2 {
+		t.Fatalf("got %d tracks, want 2", len(cue.Tracks))
+	}
+
+	first, second := cue.Tracks[0], cue.Tracks[1]
+	if first.Title != "First Song" || first.Artist != "Track Artist" || first.Rem["COMPOSER"] != "Some One" {
+		t.Errorf("track 01 = %q by %q, REM %v", first.Title, first.Artist, first.Rem)
+	}
+	if second.Artist != "" || len(second.Rem) != 0 {
+		t.Errorf("track 02 inherited track 01 fields: artist %q, REM %v", second.Artist, second.Rem)
+	}
+	if second.ISRC != "JPXX09300001" || !reflect.DeepEqual(second.Flags, []string{"DCP", "PRE"}) || second.Pregap != 75 {
+		t.Errorf("track 02 ISRC %q, flags %v, pregap %d", second.ISRC, second.Flags, second.Pregap)
+	}
+	wantIndexes := map[int]album.Index{
+		0: {File: "CD Image.wav", Offset: (3*60+58)*75 + 70},
+		1: {File: "CD Image.wav", Offset: 4 * 60 * 75},
+	}
+	if !reflect.DeepEqual(second.Indexes, wantIndexes) {
+		t.Errorf("track 02 indexes = %v, want %v", second.Indexes, wantIndexes)
+	}
+}
+
+func TestParseCueContentErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"no tracks", cueLines(`FILE "a.wav" WAVE`, `TITLE "x"`)},
+		{"no INDEX 01", cueLines(`FILE "a.wav" WAVE`, `TRACK 01 AUDIO`, `INDEX 00 00:00:00`)},
+		{"track before FILE", cueLines(`TRACK 01 AUDIO`, `INDEX 01 00:00:00`)},
+		{"invalid track number", cueLines(`FILE "a.wav" WAVE`, `TRACK one AUDIO`, `INDEX 01 00:00:00`)},
+		{"seconds out of range", cueLines(`FILE "a.wav" WAVE`, `TRACK 01 AUDIO`, `INDEX 01 00:60:00`)},
+		{"frames out of range", cueLines(`FILE "a.wav" WAVE`, `TRACK 01 AUDIO`, `INDEX 01 00:00:75`)},
+		{"malformed time", cueLines(`FILE "a.wav" WAVE`, `TRACK 01 AUDIO`, `INDEX 01 00:00`)},
+		{"malformed INDEX", cueLines(`FILE "a.wav" WAVE`, `TRACK 01 AUDIO`, `INDEX 01`)},
+	}
+	for _, tt := range tests {
+		if cue, err := newTestParser(nil).parseCueContent(tt.content); err == nil {
+			t.Errorf("%s: parseCueContent() = %+v, want an error", tt.name, cue)
+		}
+	}
+}
+
+func TestTrackBounds(t *testing.T) {
+	index := func(file string, offset album.Frames) album.Index { return album.Index{File: file, Offset: offset} }
+	track := func(indexes ...album.Index) album.Track {
+		m := make(map[int]album.Index)
+		for i, idx := range indexes {
+			if idx.File != "" {
+				m[i] = idx
+			}
+		}
+		return album.Track{Indexes: m}
+	}
+	type bounds struct {
+		source     string
+		start, end album.Frames
+	}
+	tests := []struct {
+		name   string
+		tracks []album.Track
+		want   []bounds
+	}{
+		{
+			name: "single file",
+			tracks: []album.Track{
+				track(album.Index{}, index("a.wav", 0)),
+				track(index("a.wav", 900), index("a.wav", 1000)),
+			},
+			want: []bounds{{"a.wav", 0, 1000}, {"a.wav", 1000, 0}},
+		},
+		{
+			// 间隙附加在上一个文件末尾，归入上一音轨
+			name: "gaps appended",
+			tracks: []album.Track{
+				track(album.Index{}, index("01.wav", 0)),
+				track(index("01.wav", 5000), index("02.wav", 0)),
+				track(index("02.wav", 3000), index("03.wav", 0)),
+			},
+			want: []bounds{{"01.wav", 0, 0}, {"02.wav", 0, 0}, {"03.wav", 0, 0}},
+		},
+		{
+			// 间隙在每个文件开头，从 INDEX 00 开始切割
+			name: "noncompliant",
+			tracks: []album.Track{
+				track(album.Index{}, index("01.wav", 0)),
+				track(index("02.wav", 0), index("02.wav", 150)),
+				track(index("03.wav", 0), index("03.wav", 75)),
+			},
+			want: []bounds{{"01.wav", 0, 0}, {"02.wav", 0, 0}, {"03.wav", 0, 0}},
+		},
+	}
+	for _, tt := range tests {
+		for i, want := range tt.want {
+			source, start, end := trackBounds(tt.tracks, i)
+			if got := (bounds{source, start, end}); got != want {
+				t.Errorf("%s: trackBounds(%d) = %+v, want %+v", tt.name, i, got, want)
+			}
+		}
+	}
+}
+
+func TestFramesToSamples(t *testing.T) {
+	tests := []struct {
+		frames     album.Frames
+		sampleRate int
+		want       int64
+	}{
+		{1, 44100, 588},
+		{75, 44100, 44100},
+		{(4*60+0)*75 + 1, 44100, 240*44100 + 588},
+		{1, 48000, 640},
+		{1, 96000, 1280},
+		{1, 88200, 1176},
+		{3, 22050, 882},
+	}
+	for _, tt := range tests {
+		if got := tt.frames.Samples(tt.sampleRate); got != tt.want {
+			t.Errorf("Frames(%d).Samples(%d) = %d, want %d", tt.frames, tt.sampleRate, got, tt.want)
+		}
+	}
+}
+
+func TestProcessCueSheetLayouts(t *testing.T) {
+	const minute = 60 * 44100
+	type span struct {
+		source     string
+		start, end int64
+	}
+	tests := []struct {
+		name    string
+		cue     string
+		formats fakeProber
+		want    []span
+	}{
+		{
+			name: "single file",
+			cue: cueLines(
+				`FILE "image.wav" WAVE`,
+				`TRACK 01 AUDIO`, `INDEX 01 00:00:00`,
+				`TRACK 02 AUDIO`, `INDEX 00 03:58:70`, `INDEX 01 04:00:00`,
+				`TRACK 03 AUDIO`, `INDEX 01 07:30:01`,
+			),
+			formats: fakeProber{"image.wav": {SampleRate: 44100, TotalSamples: 10 * minute, ExactLength: true}},
+			want: []span{
+				{"image.wav", 0, 4 * minute},
+				{"image.wav", 4 * minute, 7*minute + 30*44100 + 588},
+				{"image.wav", 7*minute + 30*44100 + 588, 10 * minute},
+			},
+		},
+		{
+			name: "single file at 48kHz",
+			cue: cueLines(
+				`FILE "image.flac" WAVE`,
+				`TRACK 01 AUDIO`, `INDEX 01 00:00:00`,
+				`TRACK 02 AUDIO`, `INDEX 01 01:00:01`,
+			),
+			formats: fakeProber{"image.flac": {SampleRate: 48000, TotalSamples: 2 * 60 * 48000, ExactLength: true}},
+			want: []span{
+				{"image.flac", 0, 60*48000 + 640},
+				{"image.flac", 60*48000 + 640, 2 * 60 * 48000},
+			},
+		},
+		{
+			name: "gaps appended",
+			cue: cueLines(
+				`FILE "01.wav" WAVE`,
+				`TRACK 01 AUDIO`, `INDEX 01 00:00:00`,
+				`TRACK 02 AUDIO`, `INDEX 00 03:58:00`,
+				`FILE "02.wav" WAVE`, `INDEX 01 00:00:00`,
+				`TRACK 03 AUDIO`, `INDEX 00 02:00:00`,
+				`FILE "03.wav" WAVE`, `INDEX 01 00:00:00`,
+			),
+			formats: fakeProber{
+				"01.wav": {SampleRate: 44100, TotalSamples: 4 * minute, ExactLength: true},
+				"02.wav": {SampleRate: 44100, TotalSamples: 2*minute + 2*44100, ExactLength: true},
+				"03.wav": {SampleRate: 44100, TotalSamples: 3 * minute, ExactLength: true},
+			},
+			want: []span{
+				{"01.wav", 0, 4 * minute}, // 包含附加在末尾的下一轨间隙
+				{"02.wav", 0, 2*minute + 2*44100},
+				{"03.wav", 0, 3 * minute},
+			},
+		},
+		{
+			name: "noncompliant",
+			cue: cueLines(
+				`FILE "01.wav" WAVE`,
+				`TRACK 01 AUDIO`, `INDEX 01 00:00:00`,
+				`FILE "02.wav" WAVE`,
+				`TRACK 02 AUDIO`, `INDEX 00 00:00:00`, `INDEX 01 00:02:00`,
+				`FILE "03.wav" WAVE`,
+				`TRACK 03 AUDIO`, `INDEX 01 00:00:00`,
+			),
+			formats: fakeProber{
+				"01.wav": {SampleRate: 44100, TotalSamples: 4 * minute, ExactLength: true},
+				"02.wav": {SampleRate: 44100, TotalSamples: 3 * minute, ExactLength: true},
+				"03.wav": {SampleRate: 44100, TotalSamples: 2 * minute, ExactLength: true},
+			},
+			want: []span{
+				{"01.wav", 0, 4 * minute},
+				{"02.wav", 0, 3 * minute}, // 从 INDEX 00 开始，保留文件开头的间隙
+				{"03.wav", 0, 2 * minute},
+			},
+		},
+		{
+			name: "unknown length",
+			cue: cueLines(
+				`FILE "image.wav" WAVE`,
+				`TRACK 01 AUDIO`, `INDEX 01 00:00:00`,
+				`TRACK 02 AUDIO`, `INDEX 01 01:00:00`,
+			),
+			formats: fakeProber{"image.wav": {SampleRate: 44100}},
+			want:    []span{{"image.wav", 0, minute}, {"image.wav", minute, 0}}, // 最后一轨切割到文件结尾
+		},
+		{
+			name: "estimated length",
+			cue: cueLines(
+				`FILE "image.ape" WAVE`,
+				`TRACK 01 AUDIO`, `INDEX 01 00:00:00`,
+				`TRACK 02 AUDIO`, `INDEX 01 01:00:00`,
+			),
+			formats: fakeProber{"image.ape": {SampleRate: 44100, TotalSamples: 2*minute - 7}}, // 按 ffprobe 给出的秒数换算
+			want:    []span{{"image.ape", 0, minute}, {"image.ape", minute, 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name := range tt.formats {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte("audio"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			root, err := pathsafe.NewRoot(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := newTestParser(tt.formats)
+			cue, err := c.parseCueContent(tt.cue)
+			if err != nil {
+				t.Fatal(err)
+			}
+			disc, err := c.processCueSheet(context.Background(), cue, root, filepath.Join(root.Dir(), "album.cue"), &album.Album{Path: dir}, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(disc.Tracks) != len(tt.want) {
+				t.Fatalf("got %d tracks, want %d", len(disc.Tracks), len(tt.want))
+			}
+			for i, want := range tt.want {
+				track := disc.Tracks[i]
+				got := span{filepath.Base(track.SourcePath), track.StartSample, track.EndSample}
+				if got != want {
+					t.Errorf("track %02d = %+v, want %+v", track.Number, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package parser
+
+import (
+	"errors"
+
+	"github.com/yleoer/music/pkg/album"
+	"github.com/yleoer/music/pkg/tag"
+)
+
+// readTags 读取音频文件中已有的标签，没有标签或读取失败时返回 nil (nil 的 Tags 可以正常查询)
+func (c CueParser) readTags(path string) tag.Tags {
+	tags, err := tag.ReadTags(path)
+	if err != nil && !errors.Is(err, tag.ErrNoTag) {
+		c.logger.Printf("Warning: Could not read tags of %s: %v", path, err)
+	}
+	return tags
+}
+
+// fillAlbumFromTags 用音频文件标签中的专辑艺术家 (没有时为艺术家)、专辑名和日期补全专辑中仍为空的字段
+func (c CueParser) fillAlbumFromTags(a *album.Album, tags tag.Tags) {
+	if a.Artist == "" || a.Artist == "Unknown Artist" {
+		if artist := firstNonEmpty(tags.Get("ALBUMARTIST"), tags.Get("ARTIST")); artist != "" {
+			a.Artist = c.converter.TradToSim(artist)
+		}
+	}
+	if a.Title == "" && tags.Get("ALBUM") != "" {
+		a.Title = c.converter.TradToSim(tags.Get("ALBUM"))
+	}
+	if a.Year == "" {
+		a.Year = yearFromDate(tags.Get("DATE"))
+	}
+}
@@ -0,0 +1,198 @@
+package parser
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yleoer/music/pkg/album"
+	"github.com/yleoer/music/pkg/pathsafe"
+	"github.com/yleoer/music/pkg/tag"
+)
+
+var (
+	// numberedTitlePattern 匹配 "01 - 标题"、"01. 标题"、"01 标题" 以及带光盘编号的 "1-01 标题"
+	numberedTitlePattern = regexp.MustCompile(`^(?:(\d{1,2})[-.])?(\d{1,3})(?:\s*[-._)\]]\s*|\s+)(.+)$`)
+	// artistNumberTitlePattern 匹配 "艺术家 - 01 - 标题"
+	artistNumberTitlePattern = regexp.MustCompile(`^(.+?)\s+-\s+(\d{1,3})\s+-\s+(.+)$`)
+)
+
+// trackFileName 是从已分轨文件的文件名中推断出的音轨信息，无法推断的字段为零值
+type trackFileName struct {
+	disc   int
+	number int
+	artist string
+	title  string
+}
+
+// parseTrackFileName 从不含扩展名的文件名中推断光盘编号、音轨号、艺术家和标题，无法识别时整个文件名作为标题
+func parseTrackFileName(name string) trackFileName {
+	if m := artistNumberTitlePattern.FindStringSubmatch(name); m != nil {
+		number, _ := strconv.Atoi(m[2])
+		return trackFileName{number: number, artist: strings.TrimSpace(m[1]), title: strings.TrimSpace(m[3])}
+	}
+	if m := numberedTitlePattern.FindStringSubmatch(name); m != nil {
+		disc, _ := strconv.Atoi(m[1])
+		number, _ := strconv.Atoi(m[2])
+		return trackFileName{disc: disc, number: number, title: strings.TrimSpace(m[3])}
+	}
+	return trackFileName{title: strings.TrimSpace(name)}
+}
+
+// parsePosition 解析 "3" 或 "3/12" 形式的编号及总数，无法解析的部分为 0
+func parsePosition(value string) (number, total int) {
+	n, t, _ := strings.Cut(value, "/")
+	number, _ = strconv.Atoi(strings.TrimSpace(n))
+	total, _ = strconv.Atoi(strings.TrimSpace(t))
+	return max(number, 0), max(total, 0)
+}
+
+// ProcessTrackFiles 将已经分轨的音频文件 (每个文件一首音轨) 构建为 Disc，按文件的 DISCNUMBER 标签或文件名中
+// "1-01" 形式的前缀分为多张光盘，光盘编号记录在 Disc.Rem["DISCNUMBER"] 中。音轨信息优先取自文件中的标签，
+// 否则从文件名推断 (旁注文件的曲目表由扫描器在确定光盘编号后应用)；一张光盘内的音轨号缺失或重复时按 paths 中的顺序编号。文件必须位于专辑目录内
+func (c CueParser) ProcessTrackFiles(ctx context.Context, paths []string, a *album.Album) ([]*album.Disc, error) {
+	root, err := pathsafe.NewRoot(a.Path)
+	if err != nil {
+		return nil, err
+	}
+	checked := make([]string, 0, len(paths))
+	fileTags := make([]tag.Tags, 0, len(paths))
+	for _, path := range paths {
+		path, err := root.Check(path)
+		if err != nil {
+			return nil, err
+		}
+		checked = append(checked, path)
+		fileTags = append(fileTags, c.readTags(path))
+	}
+	// Info.txt 和 CUE 都没有提供的专辑信息，用文件标签补全
+	for _, tags := range fileTags {
+		c.fillAlbumFromTags(a, tags)
+	}
+
+	discs := make(map[int]*album.Disc)
+	var discNumbers []int
+	for i, path := range checked {
+		tags := fileTags[i]
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		fromName := parseTrackFileName(name)
+		number, _ := parsePosition(tags.Get("TRACKNUMBER"))
+		if number == 0 {
+			number = fromName.number
+		}
+		discNumber, totalDiscs := parsePosition(tags.Get("DISCNUMBER"))
+		if discNumber == 0 {
+			discNumber = fromName.disc
+		}
+		totalDiscs = max(totalDiscs, parseInt(tags.Get("DISCTOTAL")), parseInt(tags.Get("TOTALDISCS")))
+		disc, ok := discs[discNumber]
+		if !ok {
+			disc = &album.Disc{
+				DiscNumber: max(discNumber, 1),
+				ImagePath:  path,
+				Genre:      tags.Get("GENRE"),
+				Date:       tags.Get("DATE"),
+				Rem:        make(map[string]string),
+			}
+			if discNumber > 0 {
+				disc.Rem["DISCNUMBER"] = strconv.Itoa(discNumber)
+			}
+			discs[discNumber] = disc
+			discNumbers = append(discNumbers, discNumber)
+		}
+		if totalDiscs > 0 {
+			disc.Rem["TOTALDISCS"] = strconv.Itoa(totalDiscs)
+		}
+		disc.Files = append(disc.Files, path)
+		disc.Tracks = append(disc.Tracks, c.trackFromFile(ctx, path, tags, fromName, number, disc.DiscNumber, a))
+	}
+
+	sort.Ints(discNumbers)
+	result := make([]*album.Disc, 0, len(discNumbers))
+	for _, n := range discNumbers {
+		disc := discs[n]
+		c.numberTracks(disc)
+		result = append(result, disc)
+	}
+	return result, nil
+}
+
+// trackFromFile 根据文件标签和文件名 (按此优先级) 构建一首覆盖整个文件的音轨。标题和艺术家不是取自标签时
+// 标记为推测的，由扫描器在确定光盘编号后用旁注文件的曲目表替换
+func (c CueParser) trackFromFile(ctx context.Context, path string, tags tag.Tags, fromName trackFileName, number, discNumber int, a *album.Album) *album.Track {
+	format := c.readFormat(ctx, path)
+	track := &album.Track{
+		Number:        number,
+		DiscNumber:    discNumber,
+		Title:         c.converter.TradToSim(firstNonEmpty(tags.Get("TITLE"), fromName.title)),
+		Artist:        a.Artist,
+		Album:         a.Title,
+		AlbumArtist:   a.Artist,
+		Year:          a.Year,
+		SourcePath:    path,
+		SampleRate:    format.SampleRate,
+		BitsPerSample: format.BitsPerSample,
+		Channels:      format.Channels,
+		// 切割到文件结尾，不依赖探测到的长度 (有损格式的长度可能只是估算)
+		StartSample: 0,
+		EndSample:   0,
+		Indexes:     map[int]album.Index{1: {File: path}},
+		Songwriter:  c.converter.TradToSim(tags.Get("COMPOSER")),
+		ISRC:        tags.Get("ISRC"),
+		Genre:       tags.Get("GENRE"),
+		Comment:     tags.Get("COMMENT"),
+		Rem:         make(map[string]string),
+	}
+	if artist := firstNonEmpty(tags.Get("ARTIST"), fromName.artist); artist != "" {
+		track.Artist = c.converter.TradToSim(artist)
+	}
+	track.GuessedTitle = tags.Get("TITLE") == ""
+	track.GuessedArtist = tags.Get("ARTIST") == ""
+	if track.Year == "" {
+		track.Year = yearFromDate(tags.Get("DATE"))
+	}
+	track.Lyrics = tags.Get("LYRICS")
+	for key, values := range tags {
+		if strings.HasPrefix(key, "REPLAYGAIN_") && len(values) > 0 {
+			track.Rem[key] = values[0]
+		}
+	}
+	return track
+}
+
+// numberTracks 按音轨号排序光盘中的音轨；音轨号缺失或重复时保持文件顺序并重新编号为 1..n
+func (c CueParser) numberTracks(disc *album.Disc) {
+	seen := make(map[int]bool)
+	valid := true
+	for _, track := range disc.Tracks {
+		if track.Number <= 0 || seen[track.Number] {
+			valid = false
+			break
+		}
+		seen[track.Number] = true
+	}
+	if !valid {
+		c.logger.Printf("Warning: Track numbers in %s are missing or duplicated, numbering %d tracks in file order.", filepath.Dir(disc.ImagePath), len(disc.Tracks))
+		for i, track := range disc.Tracks {
+			track.Number = i + 1
+		}
+		return
+	}
+	sort.SliceStable(disc.Tracks, func(i, j int) bool {
+		return disc.Tracks[i].Number < disc.Tracks[j].Number
+	})
+	disc.Files = disc.Files[:0]
+	for _, track := range disc.Tracks {
+		disc.Files = append(disc.Files, track.SourcePath)
+	}
+	disc.ImagePath = disc.Files[0]
+}
+
+// parseInt 解析整数，无法解析时返回 0
+func parseInt(s string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(s))
+	return n
+}
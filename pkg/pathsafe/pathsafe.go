@@ -0,0 +1,99 @@
+package pathsafe
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnsafePath 表示来自下载内容的路径指向专辑目录之外
+var ErrUnsafePath = errors.New("unsafe path")
+
+// UnsafePathError 描述一个被拒绝的路径，可以用 errors.Is(err, ErrUnsafePath) 判断
+type UnsafePathError struct {
+	Path   string // 被拒绝的路径
+	Root   string // 专辑目录
+	Reason string
+}
+
+func (e *UnsafePathError) Error() string {
+	return fmt.Sprintf("unsafe path %q in album directory %s: %s", e.Path, e.Root, e.Reason)
+}
+
+func (e *UnsafePathError) Unwrap() error {
+	return ErrUnsafePath
+}
+
+// Root 将来自下载内容的路径 (CUE 的 FILE、封面、Info.txt 等) 限制在专辑目录内
+type Root struct {
+	dir  string // 专辑目录的绝对路径
+	real string // 解析符号链接后的专辑目录
+}
+
+// NewRoot 创建以 dir 为根的 Root，dir 本身可以是符号链接
+func NewRoot(dir string) (*Root, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve album directory %s: %w", abs, err)
+	}
+	return &Root{dir: abs, real: real}, nil
+}
+
+// Dir 返回专辑目录的绝对路径
+func (r *Root) Dir() string {
+	return r.dir
+}
+
+// Join 将下载内容中的相对路径 name 拼接到 base 目录下，拒绝绝对路径和跳出专辑目录的 ".."。
+// 反斜杠按 Windows 风格视为目录分隔符。只做字符串检查，返回的路径不一定存在，使用前仍需 Check
+func (r *Root) Join(base, name string) (string, error) {
+	slashed := strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(slashed, "/") || filepath.IsAbs(slashed) || hasDriveLetter(slashed) {
+		return "", &UnsafePathError{Path: name, Root: r.dir, Reason: "absolute paths are not allowed"}
+	}
+	path := filepath.Join(base, filepath.FromSlash(slashed))
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if !within(r.dir, abs) {
+		return "", &UnsafePathError{Path: name, Root: r.dir, Reason: "path escapes the album directory"}
+	}
+	return abs, nil
+}
+
+// Check 校验一个已存在的路径：它必须位于专辑目录内，且解析符号链接后仍位于专辑目录内
+func (r *Root) Check(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if !within(r.dir, abs) {
+		return "", &UnsafePathError{Path: path, Root: r.dir, Reason: "path is outside of the album directory"}
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", err
+	}
+	if !within(r.real, real) {
+		return "", &UnsafePathError{Path: path, Root: r.dir, Reason: fmt.Sprintf("symlink resolves to %s", real)}
+	}
+	return abs, nil
+}
+
+// within 判断 path 是否等于 root 或位于 root 之下
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && (rel == "." || filepath.IsLocal(rel))
+}
+
+// hasDriveLetter 判断路径是否以 "C:" 这样的盘符开头
+func hasDriveLetter(path string) bool {
+	return len(path) >= 2 && path[1] == ':' &&
+		(path[0] >= 'a' && path[0] <= 'z' || path[0] >= 'A' && path[0] <= 'Z')
+}
@@ -0,0 +1,131 @@
+package pathsafe
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestRoot 创建包含 sub 子目录的专辑目录，以及专辑目录之外的 outside 目录
+func newTestRoot(t *testing.T) (root *Root, outside string) {
+	t.Helper()
+	base := t.TempDir()
+	dir, outside := filepath.Join(base, "album"), filepath.Join(base, "outside")
+	for _, d := range []string{filepath.Join(dir, "sub"), outside} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root, err := NewRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root, outside
+}
+
+func TestJoin(t *testing.T) {
+	root, _ := newTestRoot(t)
+	sub := filepath.Join(root.Dir(), "sub")
+	tests := []struct {
+		base, name string
+		want       string // 为空表示应被拒绝
+	}{
+		{root.Dir(), "image.wav", filepath.Join(root.Dir(), "image.wav")},
+		{root.Dir(), "sub/image.wav", filepath.Join(sub, "image.wav")},
+		{root.Dir(), `sub\image.wav`, filepath.Join(sub, "image.wav")},
+		{root.Dir(), "sub/../image.wav", filepath.Join(root.Dir(), "image.wav")},
+		{sub, "../image.wav", filepath.Join(root.Dir(), "image.wav")},
+		{root.Dir(), ".", root.Dir()},
+		{root.Dir(), "../image.wav", ""},
+		{root.Dir(), "../../etc/passwd", ""},
+		{root.Dir(), "sub/../../image.wav", ""},
+		{sub, "../../image.wav", ""},
+		{root.Dir(), `..\..\etc\passwd`, ""},
+		{root.Dir(), `sub\..\..\image.wav`, ""},
+		{root.Dir(), "/etc/passwd", ""},
+		{root.Dir(), `\\server\share\image.wav`, ""},
+		{root.Dir(), `C:\Music\image.wav`, ""},
+		{root.Dir(), "c:image.wav", ""},
+	}
+	for _, tt := range tests {
+		got, err := root.Join(tt.base, tt.name)
+		if tt.want == "" {
+			if !errors.Is(err, ErrUnsafePath) {
+				t.Errorf("Join(%q, %q) = %q, %v, want ErrUnsafePath", tt.base, tt.name, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Join(%q, %q) = %q, %v, want %q", tt.base, tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	root, outside := newTestRoot(t)
+	write := func(path string) {
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := func(target, path string) {
+		if err := os.Symlink(target, path); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+	write(filepath.Join(root.Dir(), "image.wav"))
+	write(filepath.Join(outside, "secret.wav"))
+	link("image.wav", filepath.Join(root.Dir(), "inside.wav"))
+	link(filepath.Join(outside, "secret.wav"), filepath.Join(root.Dir(), "escape.wav"))
+	link("../outside/secret.wav", filepath.Join(root.Dir(), "relative.wav"))
+	link(outside, filepath.Join(root.Dir(), "scans"))
+
+	tests := []struct {
+		path string
+		safe bool
+	}{
+		{filepath.Join(root.Dir(), "image.wav"), true},
+		{filepath.Join(root.Dir(), "inside.wav"), true},
+		{filepath.Join(root.Dir(), "sub"), true},
+		{filepath.Join(root.Dir(), "escape.wav"), false},
+		{filepath.Join(root.Dir(), "relative.wav"), false},
+		{filepath.Join(root.Dir(), "scans", "secret.wav"), false},
+		{filepath.Join(outside, "secret.wav"), false},
+		{filepath.Join(root.Dir(), "..", "outside", "secret.wav"), false},
+	}
+	for _, tt := range tests {
+		got, err := root.Check(tt.path)
+		if tt.safe {
+			if err != nil || got != filepath.Clean(tt.path) {
+				t.Errorf("Check(%q) = %q, %v, want the path unchanged", tt.path, got, err)
+			}
+		} else if !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("Check(%q) = %q, %v, want ErrUnsafePath", tt.path, got, err)
+		}
+	}
+
+	// 不存在的文件不是不安全的路径，调用方据此区分缺失和越界
+	if _, err := root.Check(filepath.Join(root.Dir(), "missing.wav")); err == nil || errors.Is(err, ErrUnsafePath) {
+		t.Errorf("Check(missing) = %v, want a not-exist error", err)
+	}
+}
+
+func TestCheckSymlinkedRoot(t *testing.T) {
+	root, _ := newTestRoot(t)
+	if err := os.WriteFile(filepath.Join(root.Dir(), "image.wav"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 下载目录中的专辑目录本身可以是符号链接
+	linked := filepath.Join(t.TempDir(), "linked")
+	if err := os.Symlink(root.Dir(), linked); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	r, err := NewRoot(linked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Check(filepath.Join(linked, "image.wav")); err != nil {
+		t.Errorf("Check() in a symlinked album directory = %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/yleoer/music/pkg/audio"
+)
+
+// ffprobeProber 是 Prober 的 ffprobe 实现，支持 FFmpeg 能解码的所有格式 (APE/WV/TTA 等)
+type ffprobeProber struct {
+	ffprobePath string
+}
+
+// NewFFprobeProber 创建一个调用 ffprobe 的 Prober
+func NewFFprobeProber(ffprobePath string) Prober {
+	return &ffprobeProber{ffprobePath: ffprobePath}
+}
+
+// ffprobeOutput 是 ffprobe -of json 输出中用到的字段
+type ffprobeOutput struct {
+	Streams []struct {
+		SampleRate       string `json:"sample_rate"`
+		Channels         int    `json:"channels"`
+		SampleFmt        string `json:"sample_fmt"`
+		BitsPerSample    int    `json:"bits_per_sample"`
+		BitsPerRawSample string `json:"bits_per_raw_sample"`
+		TimeBase         string `json:"time_base"`
+		DurationTS       int64  `json:"duration_ts"`
+		Duration         string `json:"duration"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+// Probe 调用 ffprobe 读取第一条音频流的参数，ctx 被取消时结束 ffprobe 进程
+func (p *ffprobeProber) Probe(ctx context.Context, path string) (audio.Format, error) {
+	cmd := exec.CommandContext(ctx, p.ffprobePath,
+		"-v", "error",
+		"-select_streams", "a:0",
+		"-show_entries", "stream=sample_rate,channels,sample_fmt,bits_per_sample,bits_per_raw_sample,time_base,duration_ts,duration:format=duration",
+		"-of", "json",
+		path,
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return audio.Format{}, fmt.Errorf("ffprobe failed for %s: %w: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+	var out ffprobeOutput
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return audio.Format{}, fmt.Errorf("failed to parse ffprobe output for %s: %w", path, err)
+	}
+	if len(out.Streams) == 0 {
+		return audio.Format{}, fmt.Errorf("no audio stream found in %s", path)
+	}
+	s := out.Streams[0]
+	sampleRate, err := strconv.Atoi(s.SampleRate)
+	if err != nil || sampleRate <= 0 {
+		return audio.Format{}, fmt.Errorf("invalid sample rate %q in %s", s.SampleRate, path)
+	}
+	format := audio.Format{
+		SampleRate:    sampleRate,
+		Channels:      s.Channels,
+		BitsPerSample: bitsPerSample(s.BitsPerRawSample, s.BitsPerSample, s.SampleFmt),
+	}
+	// 时间基为 1/采样率 时 duration_ts 就是精确的采样数，否则按秒数换算，只是估算值
+	if s.TimeBase == fmt.Sprintf("1/%d", sampleRate) && s.DurationTS > 0 {
+		format.TotalSamples = s.DurationTS
+		format.ExactLength = true
+	} else if seconds, err := strconv.ParseFloat(firstNonEmpty(s.Duration, out.Format.Duration), 64); err == nil {
+		format.TotalSamples = int64(math.Round(seconds * float64(sampleRate)))
+	}
+	return format, nil
+}
+
+// bitsPerSample 按 bits_per_raw_sample、bits_per_sample、sample_fmt 的顺序确定位深
+func bitsPerSample(raw string, bits int, sampleFmt string) int {
+	if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+		return n
+	}
+	if bits > 0 {
+		return bits
+	}
+	switch strings.TrimSuffix(sampleFmt, "p") {
+	case "u8":
+		return 8
+	case "s16":
+		return 16
+	case "s32", "flt":
+		return 32
+	case "s64", "dbl":
+		return 64
+	}
+	return 0
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
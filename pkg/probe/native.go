@@ -0,0 +1,23 @@
+package probe
+
+import (
+	"context"
+
+	"github.com/yleoer/music/pkg/audio"
+)
+
+// nativeProber 是 Prober 的纯 Go 实现，只支持 WAV 和 FLAC
+type nativeProber struct{}
+
+// NewNativeProber 创建一个不依赖外部工具的 Prober
+func NewNativeProber() Prober {
+	return nativeProber{}
+}
+
+// Probe 读取 WAV/FLAC 文件头中的音频参数，其他格式返回 audio.ErrUnsupportedFormat
+func (nativeProber) Probe(ctx context.Context, path string) (audio.Format, error) {
+	if err := ctx.Err(); err != nil {
+		return audio.Format{}, err
+	}
+	return audio.ReadFormat(path)
+}
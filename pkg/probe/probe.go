@@ -0,0 +1,44 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+
+	"github.com/yleoer/music/pkg/audio"
+)
+
+// Prober 定义读取音频文件参数的接口
+type Prober interface {
+	Probe(ctx context.Context, path string) (audio.Format, error) // ctx 被取消时终止读取。返回采样率、位深、声道数和总采样数，总采样数未知时为 0
+}
+
+// NewProber 返回默认的 Prober：优先使用 ffprobe，失败或找不到 ffprobe 时退回纯 Go 的 WAV/FLAC 文件头读取
+func NewProber(ffprobePath string, logger *log.Logger) Prober {
+	native := NewNativeProber()
+	if _, err := exec.LookPath(ffprobePath); err != nil {
+		logger.Printf("Warning: ffprobe not found at '%s', only WAV/FLAC images can be probed: %v", ffprobePath, err)
+		return native
+	}
+	return &chainProber{probers: []Prober{NewFFprobeProber(ffprobePath), native}}
+}
+
+// chainProber 依次尝试多个 Prober，返回第一个成功的结果
+type chainProber struct {
+	probers []Prober
+}
+
+// Probe 依次尝试每个 Prober，全部失败时返回合并后的错误
+func (c *chainProber) Probe(ctx context.Context, path string) (audio.Format, error) {
+	var errs []error
+	for _, p := range c.probers {
+		format, err := p.Probe(ctx, path)
+		if err == nil {
+			return format, nil
+		}
+		errs = append(errs, err)
+	}
+	return audio.Format{}, fmt.Errorf("failed to probe %s: %w", path, errors.Join(errs...))
+}
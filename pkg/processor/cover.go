@@ -0,0 +1,193 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png" // 注册 PNG 解码器
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/yleoer/music/pkg/album"
+	"github.com/yleoer/music/pkg/audio"
+	"github.com/yleoer/music/pkg/tag"
+)
+
+// coverExtensions 是支持的封面格式对应的扩展名，其他格式 (如 GIF、BMP) 不作为封面
+var coverExtensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/webp": "webp",
+}
+
+// coverQuality 是重新压缩封面时的 JPEG 质量
+const coverQuality = 90
+
+// coverArt 是准备嵌入音轨并写入专辑目录的封面
+type coverArt struct {
+	data     []byte
+	mimeType string
+	ext      string // 扩展名，不含点
+	width    int    // 无法解码的格式 (WebP) 为 0
+	height   int
+}
+
+// loadCover 读取专辑封面 (CoverEmbedded 时从源文件中提取)，超过 opts 中的尺寸或大小限制时缩小并重新压缩为 JPEG。
+// 专辑没有封面时返回 nil
+func loadCover(a *album.Album, opts Options, logger *log.Logger) (*coverArt, error) {
+	if a.CoverArt == "" {
+		return nil, nil
+	}
+	var data []byte
+	var err error
+	if a.CoverEmbedded {
+		data, err = tag.ReadEmbeddedCover(a.CoverArt)
+	} else {
+		data, err = os.ReadFile(a.CoverArt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cover, err := newCoverArt(data)
+	if err != nil {
+		return nil, err
+	}
+	fitted, err := fitCover(cover, opts.CoverMaxDimension, opts.CoverMaxBytes)
+	if err != nil {
+		logger.Printf("  -> WARN: Could not resize cover art, using it unchanged: %v", err)
+		fitted = cover
+	} else if fitted != cover {
+		logger.Printf("  Cover art resized from %dx%d (%d bytes) to %dx%d (%d bytes)",
+			cover.width, cover.height, len(cover.data), fitted.width, fitted.height, len(fitted.data))
+	}
+	return fitted, nil
+}
+
+// newCoverArt 识别图片格式并读取尺寸
+func newCoverArt(data []byte) (*coverArt, error) {
+	mimeType := http.DetectContentType(data)
+	ext, ok := coverExtensions[mimeType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported cover image type %s", mimeType)
+	}
+	cover := &coverArt{data: data, mimeType: mimeType, ext: ext}
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		cover.width, cover.height = cfg.Width, cfg.Height
+	} else if mimeType != "image/webp" {
+		return nil, fmt.Errorf("invalid %s cover image: %w", mimeType, err)
+	}
+	return cover, nil
+}
+
+// fitCover 在封面超过最大宽高或字节数时缩小并压缩为 JPEG (透明部分以白色填充)，限制为 0 表示不限制。
+// 压缩质量降到 50 仍超过字节数限制时继续缩小尺寸。不需要处理时返回 cover 本身
+func fitCover(cover *coverArt, maxDimension, maxBytes int) (*coverArt, error) {
+	tooLarge := maxDimension > 0 && (cover.width > maxDimension || cover.height > maxDimension)
+	tooBig := maxBytes > 0 && len(cover.data) > maxBytes
+	if !tooLarge && !tooBig {
+		return cover, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(cover.data))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode %s cover: %w", cover.mimeType, err)
+	}
+	rgba := flattenImage(img)
+	if tooLarge {
+		rgba = scaleImage(rgba, maxDimension)
+	}
+	var buf bytes.Buffer
+	for {
+		for quality := coverQuality; quality >= 50; quality -= 10 {
+			buf.Reset()
+			if err := jpeg.Encode(&buf, rgba, &jpeg.Options{Quality: quality}); err != nil {
+				return nil, err
+			}
+			if maxBytes == 0 || buf.Len() <= maxBytes {
+				break
+			}
+		}
+		size := rgba.Bounds().Size()
+		if maxBytes == 0 || buf.Len() <= maxBytes || max(size.X, size.Y) <= 100 {
+			return &coverArt{data: buf.Bytes(), mimeType: "image/jpeg", ext: "jpg", width: size.X, height: size.Y}, nil
+		}
+		rgba = scaleImage(rgba, max(size.X, size.Y)*3/4)
+	}
+}
+
+// fileCover 返回写入专辑目录的 cover.jpg：JPEG 原样使用，PNG 转换为 JPEG (透明部分以白色填充)，嵌入音轨的仍是原图。
+// WebP 无法解码，保持原格式写为 cover.webp
+func fileCover(cover *coverArt) (*coverArt, error) {
+	if cover.mimeType != "image/png" {
+		return cover, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(cover.data))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode %s cover: %w", cover.mimeType, err)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, flattenImage(img), &jpeg.Options{Quality: coverQuality}); err != nil {
+		return nil, err
+	}
+	return &coverArt{data: buf.Bytes(), mimeType: "image/jpeg", ext: "jpg", width: cover.width, height: cover.height}, nil
+}
+
+// flattenImage 将图片绘制到白色背景上，去掉 JPEG 无法表示的透明度
+func flattenImage(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	return dst
+}
+
+// scaleImage 按比例缩小图片使宽高都不超过 maxDimension，每个目标像素取其覆盖的源像素的平均值 (box 滤波)
+func scaleImage(src *image.RGBA, maxDimension int) *image.RGBA {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	if w <= maxDimension && h <= maxDimension {
+		return src
+	}
+	dw, dh := maxDimension, maxDimension
+	if w > h {
+		dh = max(1, h*maxDimension/w)
+	} else {
+		dw = max(1, w*maxDimension/h)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0 := y * h / dh
+		y1 := max((y+1)*h/dh, y0+1)
+		for x := 0; x < dw; x++ {
+			x0 := x * w / dw
+			x1 := max((x+1)*w/dw, x0+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += int(row[sx*4+c])
+					}
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			for c := 0; c < 4; c++ {
+				dst.Pix[y*dst.Stride+x*4+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// picture 返回写入 FLAC PICTURE 块的封面 (类型 3)
+func (c *coverArt) picture() audio.Picture {
+	return audio.Picture{
+		Type:     3,
+		MIMEType: c.mimeType,
+		Width:    c.width,
+		Height:   c.height,
+		Depth:    24,
+		Data:     c.data,
+	}
+}
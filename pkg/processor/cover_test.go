@@ -0,0 +1,119 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"testing"
+)
+
+// testCover 生成一张指定尺寸的 PNG 封面，noisy 为 true 时填充随机像素 (难以压缩)
+func testCover(t *testing.T, width, height int, noisy bool) *coverArt {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	rng := rand.New(rand.NewSource(1))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255}
+			if noisy {
+				c = color.NRGBA{R: uint8(rng.Intn(256)), G: uint8(rng.Intn(256)), B: uint8(rng.Intn(256)), A: 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	cover, err := newCoverArt(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cover
+}
+
+func TestFitCover(t *testing.T) {
+	small := testCover(t, 64, 48, false)
+	if fitted, err := fitCover(small, 100, 1<<20); err != nil || fitted != small {
+		t.Errorf("fitCover changed a cover within limits: %v", err)
+	}
+	if fitted, err := fitCover(small, 0, 0); err != nil || fitted != small {
+		t.Errorf("fitCover changed a cover without limits: %v", err)
+	}
+
+	large := testCover(t, 400, 200, false)
+	fitted, err := fitCover(large, 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fitted.mimeType != "image/jpeg" || fitted.ext != "jpg" || fitted.width != 100 || fitted.height != 50 {
+		t.Errorf("fitted cover = %s %dx%d, want image/jpeg 100x50", fitted.mimeType, fitted.width, fitted.height)
+	}
+	if cfg, err := jpeg.DecodeConfig(bytes.NewReader(fitted.data)); err != nil || cfg.Width != 100 || cfg.Height != 50 {
+		t.Errorf("fitted data is not a 100x50 JPEG: %v", err)
+	}
+
+	noisy := testCover(t, 300, 300, true)
+	const maxBytes = 20 << 10
+	fitted, err = fitCover(noisy, 0, maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fitted.data) > maxBytes || fitted.width >= 300 {
+		t.Errorf("fitted cover is %dx%d with %d bytes, want smaller than 300x300 and at most %d bytes",
+			fitted.width, fitted.height, len(fitted.data), maxBytes)
+	}
+}
+
+func TestScaleImage(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	// 左半边黑，右半边白，缩小一半后每个像素是 2x2 的平均值
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			v := uint8(0)
+			if x >= 2 {
+				v = 255
+			}
+			src.SetRGBA(x, y, color.RGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+	dst := scaleImage(src, 2)
+	if size := dst.Bounds().Size(); size.X != 2 || size.Y != 1 {
+		t.Fatalf("scaled to %v, want 2x1", size)
+	}
+	if c := dst.RGBAAt(0, 0); c.R != 0 || c.A != 255 {
+		t.Errorf("left pixel = %v, want black", c)
+	}
+	if c := dst.RGBAAt(1, 0); c.R != 255 || c.A != 255 {
+		t.Errorf("right pixel = %v, want white", c)
+	}
+	if scaleImage(src, 4) != src {
+		t.Error("scaleImage copied an image already within the limit")
+	}
+	if size := scaleImage(image.NewRGBA(image.Rect(0, 0, 1000, 3)), 100).Bounds().Size(); size.X != 100 || size.Y != 1 {
+		t.Errorf("thin image scaled to %v, want 100x1", size)
+	}
+}
+
+func TestFileCover(t *testing.T) {
+	cover := testCover(t, 32, 16, false)
+	file, err := fileCover(cover)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.ext != "jpg" || file.mimeType != "image/jpeg" {
+		t.Errorf("PNG cover written as %s (%s), want jpg", file.ext, file.mimeType)
+	}
+	if cfg, err := jpeg.DecodeConfig(bytes.NewReader(file.data)); err != nil || cfg.Width != 32 || cfg.Height != 16 {
+		t.Errorf("cover file is not a 32x16 JPEG: %v", err)
+	}
+	if cover.mimeType != "image/png" {
+		t.Error("fileCover modified the embedded cover")
+	}
+	if again, err := fileCover(file); err != nil || again != file {
+		t.Errorf("fileCover re-encoded a JPEG cover: %v", err)
+	}
+}
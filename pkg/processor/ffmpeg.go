@@ -0,0 +1,176 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/yleoer/music/pkg/album"
+	"github.com/yleoer/music/pkg/retry"
+)
+
+// FFmpegProcessor 负责通过 FFmpeg 处理音乐文件
+type FFmpegProcessor struct {
+	ffmpegPath string
+	outputs    []Output
+	opts       Options
+	logger     *log.Logger
+}
+
+// NewFFmpegProcessor 创建一个新的 FFmpegProcessor 实例
+func NewFFmpegProcessor(ffmpegPath string, outputs []Output, opts Options, logger *log.Logger) *FFmpegProcessor {
+	return &FFmpegProcessor{ffmpegPath: ffmpegPath, outputs: outputs, opts: opts, logger: logger}
+}
+
+// ProcessAlbum 调用 FFmpeg 处理整张专辑，依次生成每个输出目标 (如无损归档和有损的移动端副本)。
+// 单条音轨的失败记录在返回的结果中，只有无法继续处理整张专辑 (包括 ctx 被取消) 时才返回错误
+func (p *FFmpegProcessor) ProcessAlbum(ctx context.Context, album *album.Album) (*AlbumResult, error) {
+	result := &AlbumResult{}
+	cover, err := loadCover(album, p.opts, p.logger)
+	if err != nil {
+		p.logger.Printf("  -> WARN: Could not load cover art %s: %v", album.CoverArt, err)
+	}
+	for _, output := range p.outputs {
+		p.logger.Printf("  Output profile %s -> %s", output.Profile.Name, output.LibraryDir)
+		tracks, err := p.processOutput(ctx, album, output, cover)
+		result.Tracks = append(result.Tracks, tracks...)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// DiscardStaged 删除专辑在各输出目标中的暂存目录
+func (p *FFmpegProcessor) DiscardStaged(albumPath string) error {
+	return discardStaged(p.outputs, albumPath)
+}
+
+// processOutput 为一个输出目标生成整张专辑的文件：先写入暂存目录并校验，全部完成后再移入音乐库。
+// 处理被取消时不移入音乐库，保留暂存目录以便续传
+func (p *FFmpegProcessor) processOutput(ctx context.Context, album *album.Album, output Output, cover *coverArt) ([]TrackResult, error) {
+	stage, err := newStagedOutput(album, output, p.opts.Progress)
+	if err != nil {
+		return nil, err
+	}
+	if cover != nil && p.opts.WriteCoverFile {
+		if err := stage.writeCover(cover); err != nil {
+			p.logger.Printf("  -> WARN: %v", err)
+		}
+	}
+	var coverPath string
+	if cover != nil && output.Profile.CoverArt {
+		if coverPath, err = stage.coverInput(cover); err != nil {
+			p.logger.Printf("  -> WARN: %v", err)
+		}
+	}
+	jobs := stage.jobs(album)
+	results := runTrackJobs(ctx, jobs, output.Profile, p.opts, p.logger, func(job trackJob, logs *jobLog) (string, error) {
+		track := job.track
+		logs.Printf("  Processing Track %02d: %s", track.Number, track.Title)
+		logs.Printf("  -> Source: %s (%s)", track.SourcePath, formatDescription(track))
+		cmd, err := p.buildFFmpegCommand(ctx, track.SourcePath, job.output, track, coverPath, output.Profile)
+		if err != nil {
+			logs.Printf("  -> ERROR: Could not build ffmpeg command for track %s: %v", track.Title, err)
+			return "", err
+		}
+		logs.Printf("  -> Executing FFmpeg... Command: %s %s", p.ffmpegPath, strings.Join(cmd.Args[1:], " "))
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			logs.Printf("  -> ERROR: FFmpeg execution failed for track %s: %v", track.Title, err)
+			logs.Printf("  -> FFmpeg output:\n%s", stderrExcerpt(stderr.String()))
+			err = fmt.Errorf("ffmpeg failed: %w", err)
+			if strings.Contains(stderr.String(), "No space left on device") {
+				err = retry.Transient(err) // 清理出空间后重试即可成功
+			}
+			return stderr.String(), err
+		}
+		logs.Printf("  -> Successfully encoded %s", job.output)
+		return "", nil
+	})
+	if err := ctx.Err(); err != nil {
+		return results, fmt.Errorf("processing interrupted, staged tracks kept in %s for resume: %w", stage.dir, err)
+	}
+	return results, stage.commit(jobs, results, p.opts.AcceptPartial, p.logger)
+}
+
+// buildFFmpegCommand 构建一条包含了切割、转码和元数据写入的命令，ctx 被取消时终止 FFmpeg 进程
+func (p *FFmpegProcessor) buildFFmpegCommand(ctx context.Context, inputFile, outputFile string, track *album.Track, coverArtPath string, profile *Profile) (*exec.Cmd, error) {
+	if !profile.CoverArt {
+		coverArtPath = ""
+	}
+	var args []string
+	args = append(args, "-y")
+	inputArg, err := fileArg(inputFile)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, "-i", inputArg)
+	if coverArtPath != "" {
+		coverArg, err := fileArg(coverArtPath)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "-i", coverArg)
+	}
+	args = append(args, "-map", "0:a")
+	// 不使用 -ss/-to 输入定位 (按时间定位会有舍入误差)，而是用 atrim 按采样精确切割，
+	// 保证相邻音轨拼接后与原镜像逐采样一致
+	args = append(args, "-af", trimFilter(track))
+	if coverArtPath != "" {
+		// JPEG 和 PNG 原样嵌入，其他格式 (如 WebP) 转换为 JPEG，MP4 和 ID3v2 都不支持
+		codec := "mjpeg"
+		if ext := strings.ToLower(filepath.Ext(coverArtPath)); ext == ".jpg" || ext == ".png" {
+			codec = "copy"
+		}
+		args = append(args,
+			"-map", "1:v",
+			"-c:v", codec,
+			"-disposition:v", "attached_pic",
+			"-vsync", "0",
+		)
+	}
+	args = append(args, profile.Codec...)
+	args = append(args, profile.Muxer...)
+	// 源文件中的标签不带入输出，只写入按容器映射后的标签
+	args = append(args, "-map_metadata", "-1")
+	for _, field := range ffmpegTags(profile.Tags, track) {
+		p.addMetadata(&args, field.Name, field.Value)
+	}
+	outputArg, err := fileArg(outputFile)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, outputArg)
+	return exec.CommandContext(ctx, p.ffmpegPath, args...), nil
+}
+
+// fileArg 将文件路径转换为 FFmpeg 参数。下载内容中的文件名可能以 "-" 开头或形如 "concat:"、"http:"，
+// 使用绝对路径并加上 file: 前缀，确保 FFmpeg 只把它当作本地文件
+func fileArg(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return "file:" + abs, nil
+}
+
+// trimFilter 构建按采样切割音轨的 atrim 滤镜
+func trimFilter(track *album.Track) string {
+	filter := fmt.Sprintf("atrim=start_sample=%d", track.StartSample)
+	if track.EndSample > 0 { // 只有非最后一个轨道才设置结束位置
+		filter += fmt.Sprintf(":end_sample=%d", track.EndSample)
+	}
+	return filter + ",asetpts=PTS-STARTPTS"
+}
+
+func (p *FFmpegProcessor) addMetadata(args *[]string, key, value string) {
+	if value != "" {
+		*args = append(*args, "-metadata", fmt.Sprintf("%s=%s", key, value))
+	}
+}
@@ -0,0 +1,152 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/yleoer/music/pkg/album"
+	"github.com/yleoer/music/pkg/audio"
+)
+
+// NativeProcessor 是不依赖 FFmpeg 的纯 Go 处理器，按采样偏移切割 PCM WAV 镜像并编码为 FLAC
+type NativeProcessor struct {
+	outputs []Output
+	opts    Options
+	logger  *log.Logger
+}
+
+// NewNativeProcessor 创建一个新的 NativeProcessor 实例，只支持 FLAC 输出 (压缩等级参数会被忽略)
+func NewNativeProcessor(outputs []Output, opts Options, logger *log.Logger) (*NativeProcessor, error) {
+	for _, o := range outputs {
+		if o.Profile.Extension != "flac" {
+			return nil, fmt.Errorf("native processor cannot produce profile %q, only FLAC is supported", o.Profile.Name)
+		}
+	}
+	return &NativeProcessor{outputs: outputs, opts: opts, logger: logger}, nil
+}
+
+// ProcessAlbum 切割并编码整张专辑，只支持 PCM WAV 镜像。单条音轨的失败记录在返回的结果中
+func (p *NativeProcessor) ProcessAlbum(ctx context.Context, album *album.Album) (*AlbumResult, error) {
+	result := &AlbumResult{}
+	cover, err := loadCover(album, p.opts, p.logger)
+	if err != nil {
+		p.logger.Printf("  -> WARN: Could not load cover art %s: %v", album.CoverArt, err)
+	}
+	for _, output := range p.outputs {
+		p.logger.Printf("  Output profile %s -> %s", output.Profile.Name, output.LibraryDir)
+		tracks, err := p.processOutput(ctx, album, output, cover)
+		result.Tracks = append(result.Tracks, tracks...)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// DiscardStaged 删除专辑在各输出目标中的暂存目录
+func (p *NativeProcessor) DiscardStaged(albumPath string) error {
+	return discardStaged(p.outputs, albumPath)
+}
+
+// processOutput 为一个输出目标生成整张专辑的文件：先写入暂存目录并校验，全部完成后再移入音乐库。
+// 处理被取消时不移入音乐库，保留暂存目录以便续传
+func (p *NativeProcessor) processOutput(ctx context.Context, album *album.Album, output Output, cover *coverArt) ([]TrackResult, error) {
+	stage, err := newStagedOutput(album, output, p.opts.Progress)
+	if err != nil {
+		return nil, err
+	}
+	if cover != nil && p.opts.WriteCoverFile {
+		if err := stage.writeCover(cover); err != nil {
+			p.logger.Printf("  -> WARN: %v", err)
+		}
+	}
+	var pictures []audio.Picture
+	if cover != nil {
+		pictures = append(pictures, cover.picture())
+	}
+	// 并发编码前先读取所有镜像的 WAV 头，各任务只读共享
+	sources := make(map[string]*audio.WAVFile)
+	sourceErrs := make(map[string]error)
+	for _, disc := range album.Discs {
+		for _, track := range disc.Tracks {
+			if _, ok := sources[track.SourcePath]; ok {
+				continue
+			}
+			if _, ok := sourceErrs[track.SourcePath]; ok {
+				continue
+			}
+			src, err := audio.ReadWAVHeader(track.SourcePath)
+			if err != nil {
+				sourceErrs[track.SourcePath] = err
+				continue
+			}
+			sources[track.SourcePath] = src
+		}
+	}
+	jobs := stage.jobs(album)
+	results := runTrackJobs(ctx, jobs, output.Profile, p.opts, p.logger, func(job trackJob, logs *jobLog) (string, error) {
+		track := job.track
+		logs.Printf("  Processing Track %02d: %s", track.Number, track.Title)
+		logs.Printf("  -> Source: %s (%s)", track.SourcePath, formatDescription(track))
+		src, ok := sources[track.SourcePath]
+		if !ok {
+			err := sourceErrs[track.SourcePath]
+			logs.Printf("  -> ERROR: Native processor only supports PCM WAV images: %v", err)
+			return "", err
+		}
+		if err := p.encodeTrack(ctx, src, job.output, track, pictures); err != nil {
+			logs.Printf("  -> ERROR: Encoding failed for track %s: %v", track.Title, err)
+			return "", err
+		}
+		logs.Printf("  -> Successfully encoded %s", job.output)
+		return "", nil
+	})
+	if err := ctx.Err(); err != nil {
+		return results, fmt.Errorf("processing interrupted, staged tracks kept in %s for resume: %w", stage.dir, err)
+	}
+	return results, stage.commit(jobs, results, p.opts.AcceptPartial, p.logger)
+}
+
+// encodeTrack 将 src 中音轨对应的采样区间编码为 FLAC 文件，ctx 被取消时中止编码
+func (p *NativeProcessor) encodeTrack(ctx context.Context, src *audio.WAVFile, outputFile string, track *album.Track, pictures []audio.Picture) error {
+	end := track.EndSample
+	if end == 0 || end > src.TotalSamples {
+		end = src.TotalSamples
+	}
+	if track.StartSample >= end {
+		return fmt.Errorf("sample range [%d, %d) is outside of %s", track.StartSample, end, src.Path)
+	}
+	in, err := os.Open(src.Path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	blockAlign := int64(src.BlockAlign())
+	section := io.NewSectionReader(in, src.DataOffset+track.StartSample*blockAlign, (end-track.StartSample)*blockAlign)
+
+	out, err := os.Create(outputFile)
+	if err != nil {
+		return err
+	}
+	if err := audio.EncodeFLAC(out, contextReader{ctx: ctx, r: section}, src.Format, end-track.StartSample, vorbisComments(track), pictures); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// contextReader 在 ctx 被取消后让读取返回 ctx.Err()，用于中止长时间的编码
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,144 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yleoer/music/pkg/album"
+	"github.com/yleoer/music/pkg/audio"
+	"github.com/yleoer/music/pkg/naming"
+	"github.com/yleoer/music/pkg/tag"
+)
+
+// writeTestImage 写出一个由随机 PCM 数据组成的 WAV 镜像，返回 data 块的内容
+func writeTestImage(t *testing.T, path string, format audio.Format, samples int64) []byte {
+	t.Helper()
+	data := make([]byte, samples*int64(format.BlockAlign()))
+	rand.New(rand.NewSource(1)).Read(data)
+	var buf bytes.Buffer
+	if err := audio.WriteWAVHeader(&buf, format, int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(data)
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestNativeProcessorRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	format := audio.Format{SampleRate: 44100, Channels: 2, BitsPerSample: 16}
+	source := filepath.Join(dir, "image.wav")
+	total := album.Frames(75*3).Samples(format.SampleRate) + 17
+	data := writeTestImage(t, source, format, total)
+
+	coverPath := filepath.Join(dir, "cover.png")
+	var cover bytes.Buffer
+	if err := png.Encode(&cover, image.NewRGBA(image.Rect(0, 0, 4, 3))); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(coverPath, cover.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &album.Album{Path: dir, Artist: "Artist", Title: "Album", Year: "2001", CoverArt: coverPath}
+	disc := &album.Disc{DiscNumber: 1, TotalDiscs: 1, ImagePath: source}
+	starts := []album.Frames{0, 75 + 13, 75*2 + 7}
+	for i, start := range starts {
+		track := &album.Track{
+			Number:        i + 1,
+			DiscNumber:    1,
+			TotalDiscs:    1,
+			Title:         []string{"One", "Two", "Three"}[i],
+			Artist:        "Artist",
+			SourcePath:    source,
+			SampleRate:    format.SampleRate,
+			BitsPerSample: format.BitsPerSample,
+			Channels:      format.Channels,
+			StartSample:   start.Samples(format.SampleRate),
+			Album:         a.Title,
+			AlbumArtist:   a.Artist,
+			Year:          a.Year,
+		}
+		if i+1 < len(starts) {
+			track.EndSample = starts[i+1].Samples(format.SampleRate)
+		}
+		disc.Tracks = append(disc.Tracks, track)
+	}
+	a.Discs = []*album.Disc{disc}
+
+	layout, err := naming.Parse(naming.DefaultTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile, err := ProfileByName("flac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	library := filepath.Join(dir, "library")
+	outputs := []Output{{Profile: profile, LibraryDir: library, Layout: layout, MaxNameLength: 255}}
+	p, err := NewNativeProcessor(outputs, Options{Workers: 2, WriteCoverFile: true}, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := p.ProcessAlbum(context.Background(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed := result.Failed(); len(failed) > 0 {
+		t.Fatalf("%d track(s) failed: %v", len(failed), failed[0].Err)
+	}
+
+	blockAlign := int64(format.BlockAlign())
+	for i, track := range disc.Tracks {
+		r := result.Tracks[i]
+		want := filepath.Join(library, "Artist", "Album (2001)", []string{"01 - One", "02 - Two", "03 - Three"}[i]+".flac")
+		if r.OutputPath != want {
+			t.Errorf("track %d written to %s, want %s", i+1, r.OutputPath, want)
+			continue
+		}
+		end := track.EndSample
+		if end == 0 {
+			end = total
+		}
+		meta, err := tag.ReadFLACMetadata(r.OutputPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta.StreamInfo.TotalSamples != end-track.StartSample {
+			t.Errorf("track %d has %d samples, want %d", i+1, meta.StreamInfo.TotalSamples, end-track.StartSample)
+		}
+		if got := meta.Comments.Get("TITLE"); got != track.Title {
+			t.Errorf("track %d TITLE = %q, want %q", i+1, got, track.Title)
+		}
+		if len(meta.Pictures) != 1 || !bytes.Equal(meta.Pictures[0].Data, cover.Bytes()) {
+			t.Errorf("track %d does not embed the cover", i+1)
+		}
+		// STREAMINFO 的 MD5 是解码后 PCM 的摘要，与源镜像对应区间一致说明切割和编码都是无损且采样精确的
+		content, err := os.ReadFile(r.OutputPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := md5.Sum(data[track.StartSample*blockAlign : end*blockAlign])
+		if !bytes.Equal(content[8+18:8+34], sum[:]) {
+			t.Errorf("track %d MD5 %x does not match source samples %x", i+1, content[8+18:8+34], sum)
+		}
+	}
+	// PNG 封面原样嵌入音轨，专辑目录中写入的是转换后的 cover.jpg
+	if matches, _ := filepath.Glob(filepath.Join(library, "Artist", "Album (2001)", "cover.*")); len(matches) != 1 || filepath.Base(matches[0]) != "cover.jpg" {
+		t.Errorf("cover files in library: %v, want cover.jpg", matches)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(library, stagingDirName)); len(entries) != 0 {
+		t.Errorf("staging directory not cleaned up: %d entries", len(entries))
+	}
+}
@@ -1,108 +1,106 @@
 package processor
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"log"
-	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/yleoer/music/pkg/album"
-	"github.com/yleoer/music/pkg/util"
+	"github.com/yleoer/music/pkg/naming"
+	"github.com/yleoer/music/pkg/probe"
 )
 
-// FFmpegProcessor 负责通过 FFmpeg 处理音乐文件
-type FFmpegProcessor struct {
-	ffmpegPath string
-	logger     *log.Logger
+// Processor 定义专辑处理器接口：切割音轨、转码并写入标签
+type Processor interface {
+	// ProcessAlbum 处理整张专辑，按构造时指定的输出目标分别生成文件并返回每条音轨的结果。
+	// ctx 被取消时终止正在进行的转码，已完成的音轨留在暂存目录中供下次续传，音乐库不受影响
+	ProcessAlbum(ctx context.Context, album *album.Album) (*AlbumResult, error)
+	// DiscardStaged 删除源目录为 albumPath 的专辑留在暂存目录中的已完成音轨，任务永久失败、不再续传时调用
+	DiscardStaged(albumPath string) error
 }
 
-// NewFFmpegProcessor 创建一个新的 FFmpegProcessor 实例
-func NewFFmpegProcessor(ffmpegPath string, logger *log.Logger) *FFmpegProcessor {
-	return &FFmpegProcessor{ffmpegPath: ffmpegPath, logger: logger}
+// Options 是各处理器共用的参数
+type Options struct {
+	Workers       int  // 同时转码的音轨数
+	Retries       int  // 单条音轨失败后的重试次数
+	AcceptPartial bool // 有音轨失败时是否仍将成功的音轨移入音乐库
+
+	CoverMaxDimension int  // 封面的最大宽高 (像素)，超过时缩小，0 表示不限制
+	CoverMaxBytes     int  // 封面的最大字节数，超过时重新压缩，0 表示不限制
+	WriteCoverFile    bool // 是否在专辑目录中写入 cover.jpg (WebP 封面为 cover.webp)
+
+	Progress ProgressStore // 按音轨保存进度，为 nil 时不支持续传
+	Prober   probe.Prober  // 读取有损输出的时长用于校验 (ffprobe)，为 nil 时有损输出只检查非空
 }
 
-// ProcessAlbum 调用 FFmpeg 处理整张专辑
-func (p *FFmpegProcessor) ProcessAlbum(album *album.Album, targetDir string) error {
-	sanitizedArtist := util.SanitizeFileName(album.Artist)
-	sanitizedAlbumTitle := util.SanitizeFileName(album.Title)
-	sanitizedAlbumYear := album.Year // 年份通常是数字
-	artistDir := filepath.Join(targetDir, sanitizedArtist)
-	albumOutputDir := filepath.Join(artistDir, fmt.Sprintf("%s (%s)", sanitizedAlbumTitle, sanitizedAlbumYear))
-	if err := os.MkdirAll(albumOutputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create album output directory %s: %v", albumOutputDir, err)
-	}
-	for _, disc := range album.Discs {
-		discOutputDir := albumOutputDir
-		if len(album.Discs) > 1 {
-			discOutputDir = filepath.Join(albumOutputDir, fmt.Sprintf("Disc %d", disc.DiscNumber))
-			if err := os.MkdirAll(discOutputDir, 0755); err != nil {
-				return fmt.Errorf("failed to create disc output directory %s: %v", discOutputDir, err)
-			}
-		}
+// planOutputPaths 按输出目标的路径模板计算每条音轨在音乐库中的相对路径。
+// 两条音轨渲染出相同路径时返回错误，避免互相覆盖
+func planOutputPaths(a *album.Album, output Output) (map[*album.Track]string, error) {
+	paths := make(map[*album.Track]string)
+	owners := make(map[string]*album.Track)
+	for _, disc := range a.Discs {
 		for _, track := range disc.Tracks {
-			time.Sleep(1 * time.Second) // 避免API请求过快或磁盘IO过载
-			p.logger.Printf("  Processing Track %02d: %s", track.Number, track.Title)
-			trackFileName := fmt.Sprintf("%02d - %s.%s", track.Number, util.SanitizeFileName(track.Title), "flac")
-			convertedFilePath := filepath.Join(discOutputDir, trackFileName)
-			cmd, err := p.buildFFmpegCommand(disc.WavPath, convertedFilePath, track, album.CoverArt)
-			if err != nil {
-				p.logger.Printf("  -> ERROR: Could not build ffmpeg command for track %s: %v", track.Title, err)
-				continue
+			rel := output.Layout.Render(namingValues(a, disc, track), output.Profile.Extension, output.MaxNameLength)
+			// 字段值来自 CUE 和 Info.txt，渲染时已经清理过，这里再确认不会写到音乐库之外
+			if !filepath.IsLocal(rel) {
+				return nil, fmt.Errorf("path template %q renders track %d outside of the library: %s", output.Layout, track.Number, rel)
 			}
-			p.logger.Printf("  -> Executing FFmpeg... Command: %s %s", p.ffmpegPath, strings.Join(cmd.Args[1:], " "))
-			var stderr bytes.Buffer
-			cmd.Stderr = &stderr
-			if err := cmd.Run(); err != nil {
-				p.logger.Printf("  -> ERROR: FFmpeg execution failed for track %s.", track.Title)
-				p.logger.Printf("  -> FFmpeg output:\n%s", stderr.String())
-				continue
+			if other, ok := owners[rel]; ok {
+				return nil, fmt.Errorf("path template %q maps track %d and track %d to the same file %s",
+					output.Layout, other.Number, track.Number, rel)
 			}
-			p.logger.Printf("  -> Successfully created %s", convertedFilePath)
+			owners[rel] = track
+			paths[track] = rel
 		}
 	}
-	return nil
+	return paths, nil
 }
 
-// buildFFmpegCommand 构建一条包含了切割、转码和元数据写入的命令
-func (p *FFmpegProcessor) buildFFmpegCommand(inputFile, outputFile string, track *album.Track, coverArtPath string) (*exec.Cmd, error) {
-	var args []string
-	args = append(args, "-y")
-	args = append(args, "-ss", util.FormatDurationToFFmpegTime(track.StartTime))
-	if track.EndTime > 0 { // 只有非最后一个轨道才设置结束时间
-		args = append(args, "-to", util.FormatDurationToFFmpegTime(track.EndTime))
+// namingValues 返回渲染路径模板所需的字段值，单碟专辑的 disc/discs 在 :cond 下视为空。
+// 旁注文件中的唱片编号和厂牌优先于 CUE 的 CATALOG (通常是 UPC) 和 REM LABEL
+func namingValues(a *album.Album, disc *album.Disc, track *album.Track) naming.Values {
+	discs := max(disc.TotalDiscs, len(a.Discs))
+	fields := map[string]string{
+		"albumartist": firstNonEmpty(track.AlbumArtist, a.Artist),
+		"artist":      track.Artist,
+		"album":       firstNonEmpty(track.Album, a.Title),
+		"title":       track.Title,
+		"year":        firstNonEmpty(track.Year, a.Year),
+		"genre":       firstNonEmpty(track.Genre, disc.Genre),
+		"composer":    track.Songwriter,
+		"track":       strconv.Itoa(track.Number),
+		"tracks":      strconv.Itoa(len(disc.Tracks)),
+		"disc":        strconv.Itoa(disc.DiscNumber),
+		"discs":       strconv.Itoa(discs),
+		"catalog":     firstNonEmpty(a.Catalog, disc.Catalog),
+		"label":       firstNonEmpty(a.Label, disc.Rem["LABEL"]),
 	}
-	args = append(args, "-i", inputFile)
-	if coverArtPath != "" {
-		args = append(args, "-i", coverArtPath)
+	single := discs <= 1 && disc.DiscNumber <= 1
+	return naming.Values{
+		Fields: fields,
+		Hidden: map[string]bool{"disc": single, "discs": single},
 	}
-	args = append(args, "-map", "0:a")
-	if coverArtPath != "" {
-		args = append(args,
-			"-map", "1:v",
-			"-c:v", "mjpeg",
-			"-disposition:v", "attached_pic",
-			"-vsync", "0",
-		)
+}
+
+// formatDescription 以 "44100 Hz, 16 bit, 2 ch" 的形式描述音轨源文件的音频参数，未知的参数省略
+func formatDescription(track *album.Track) string {
+	parts := []string{fmt.Sprintf("%d Hz", track.SampleRate)}
+	if track.BitsPerSample > 0 {
+		parts = append(parts, fmt.Sprintf("%d bit", track.BitsPerSample))
 	}
-	args = append(args, "-c:a", "flac")
-	p.addMetadata(&args, "title", track.Title)
-	p.addMetadata(&args, "artist", track.Artist)
-	p.addMetadata(&args, "album_artist", track.AlbumArtist)
-	p.addMetadata(&args, "album", track.Album)
-	p.addMetadata(&args, "date", track.Year)
-	p.addMetadata(&args, "track", fmt.Sprintf("%d", track.Number))
-	if track.Lyrics != "" {
-		p.addMetadata(&args, "lyrics", track.Lyrics)
+	if track.Channels > 0 {
+		parts = append(parts, fmt.Sprintf("%d ch", track.Channels))
 	}
-	args = append(args, outputFile)
-	return exec.Command(p.ffmpegPath, args...), nil
+	return strings.Join(parts, ", ")
 }
-func (p *FFmpegProcessor) addMetadata(args *[]string, key, value string) {
-	if value != "" {
-		*args = append(*args, "-metadata", fmt.Sprintf("%s=%s", key, value))
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
 	}
+	return ""
 }
@@ -0,0 +1,177 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/yleoer/music/pkg/config"
+	"github.com/yleoer/music/pkg/naming"
+)
+
+// Profile 描述一种输出格式及其编码参数
+type Profile struct {
+	Name      string
+	Extension string   // 输出文件扩展名，不含点
+	Codec     []string // FFmpeg 音频编码参数
+	Muxer     []string // FFmpeg 容器相关参数
+	Tags      TagStyle // 标签写入方式
+	Lossless  bool
+	CoverArt  bool // 容器是否支持嵌入封面
+}
+
+// Output 是一个输出目标：使用的编码配置、对应的音乐库根目录以及库内路径模板
+type Output struct {
+	Profile       *Profile
+	LibraryDir    string
+	Layout        *naming.Template // 音乐库内的路径模板，不含扩展名
+	MaxNameLength int              // 每级目录名或文件名 (含扩展名) 的最大字节数
+}
+
+// ProfileByName 根据名称返回内置的编码配置，支持:
+//
+//	flac, flac-0 ... flac-8       FLAC，可指定压缩等级 (默认 5)
+//	alac                          ALAC (M4A)
+//	opus, opus-<kbps>             Opus (默认 160k)
+//	mp3-v0 ... mp3-v9, mp3-<kbps> MP3 VBR 质量或 CBR 码率
+//	aac, aac-<kbps>               AAC (M4A，默认 256k)
+func ProfileByName(name string) (*Profile, error) {
+	format, param, _ := strings.Cut(strings.ToLower(strings.TrimSpace(name)), "-")
+	switch format {
+	case "flac":
+		level := 5
+		if param != "" {
+			l, err := strconv.Atoi(param)
+			if err != nil || l < 0 || l > 8 {
+				return nil, fmt.Errorf("invalid FLAC compression level in profile %q", name)
+			}
+			level = l
+		}
+		return &Profile{
+			Name:      name,
+			Extension: "flac",
+			Codec:     []string{"-c:a", "flac", "-compression_level", strconv.Itoa(level)},
+			Tags:      TagsVorbis,
+			Lossless:  true,
+			CoverArt:  true,
+		}, nil
+	case "alac":
+		if param != "" {
+			return nil, fmt.Errorf("profile %q takes no parameter", name)
+		}
+		return &Profile{
+			Name:      name,
+			Extension: "m4a",
+			Codec:     []string{"-c:a", "alac"},
+			Muxer:     []string{"-movflags", "+faststart"},
+			Tags:      TagsMP4,
+			Lossless:  true,
+			CoverArt:  true,
+		}, nil
+	case "opus":
+		bitrate, err := parseBitrate(name, param, 160, 6, 510)
+		if err != nil {
+			return nil, err
+		}
+		// Ogg 容器无法通过 attached_pic 嵌入封面
+		return &Profile{
+			Name:      name,
+			Extension: "opus",
+			Codec:     []string{"-c:a", "libopus", "-b:a", bitrate},
+			Tags:      TagsVorbis,
+		}, nil
+	case "mp3":
+		p := &Profile{
+			Name:      name,
+			Extension: "mp3",
+			Muxer:     []string{"-id3v2_version", "3"},
+			Tags:      TagsID3v2,
+			CoverArt:  true,
+		}
+		if len(param) == 2 && param[0] == 'v' && param[1] >= '0' && param[1] <= '9' {
+			p.Codec = []string{"-c:a", "libmp3lame", "-q:a", param[1:]}
+			return p, nil
+		}
+		bitrate, err := parseBitrate(name, param, 320, 32, 320)
+		if err != nil {
+			return nil, err
+		}
+		p.Codec = []string{"-c:a", "libmp3lame", "-b:a", bitrate}
+		return p, nil
+	case "aac":
+		bitrate, err := parseBitrate(name, param, 256, 32, 512)
+		if err != nil {
+			return nil, err
+		}
+		return &Profile{
+			Name:      name,
+			Extension: "m4a",
+			Codec:     []string{"-c:a", "aac", "-b:a", bitrate},
+			Muxer:     []string{"-movflags", "+faststart"},
+			Tags:      TagsMP4,
+			CoverArt:  true,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown output profile %q", name)
+	}
+}
+
+// parseBitrate 解析以 kbps 为单位的码率参数，为空时使用默认值
+func parseBitrate(name, param string, defaultKbps, minKbps, maxKbps int) (string, error) {
+	kbps := defaultKbps
+	if param != "" {
+		k, err := strconv.Atoi(strings.TrimSuffix(param, "k"))
+		if err != nil || k < minKbps || k > maxKbps {
+			return "", fmt.Errorf("invalid bitrate in profile %q, expected %d-%d kbps", name, minKbps, maxKbps)
+		}
+		kbps = k
+	}
+	return fmt.Sprintf("%dk", kbps), nil
+}
+
+// ResolveOutputs 将配置中的输出目标解析为 Output 列表，确保各音乐库目录存在并清理过期的暂存文件。
+// 两个输出写入同一音乐库且扩展名相同时 (如 alac 和 aac 都是 m4a) 会生成相同的路径，返回配置错误
+func ResolveOutputs(cfg *config.Config) ([]Output, error) {
+	layout, err := naming.Parse(cfg.PathTemplate)
+	if err != nil {
+		return nil, err
+	}
+	profiles := make([]*Profile, len(cfg.Outputs))
+	seen := make(map[[2]string]string) // (音乐库目录, 扩展名) -> 配置名称
+	for i, o := range cfg.Outputs {
+		profile, err := ProfileByName(o.Profile)
+		if err != nil {
+			return nil, err
+		}
+		dir, err := filepath.Abs(o.LibraryDir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid library directory %s: %w", o.LibraryDir, err)
+		}
+		key := [2]string{dir, profile.Extension}
+		if other, ok := seen[key]; ok {
+			return nil, fmt.Errorf("outputs %q and %q both write .%s files to %s, use a different library directory for one of them",
+				other, o.Profile, profile.Extension, o.LibraryDir)
+		}
+		seen[key] = o.Profile
+		profiles[i] = profile
+	}
+	resolved := make([]Output, 0, len(cfg.Outputs))
+	for i, o := range cfg.Outputs {
+		profile := profiles[i]
+		if err := os.MkdirAll(o.LibraryDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create library directory %s: %w", o.LibraryDir, err)
+		}
+		if err := cleanStaging(o.LibraryDir); err != nil {
+			return nil, fmt.Errorf("failed to clean staging directory in %s: %w", o.LibraryDir, err)
+		}
+		resolved = append(resolved, Output{
+			Profile:       profile,
+			LibraryDir:    o.LibraryDir,
+			Layout:        layout,
+			MaxNameLength: cfg.MaxNameLength,
+		})
+	}
+	return resolved, nil
+}
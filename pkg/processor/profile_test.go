@@ -0,0 +1,37 @@
+package processor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yleoer/music/pkg/config"
+	"github.com/yleoer/music/pkg/naming"
+)
+
+func TestResolveOutputsRejectsDuplicates(t *testing.T) {
+	lib, mobile := t.TempDir(), t.TempDir()
+	out := func(profile, dir string) config.OutputConfig {
+		return config.OutputConfig{Profile: profile, LibraryDir: dir}
+	}
+	tests := []struct {
+		outputs []config.OutputConfig
+		ok      bool
+	}{
+		{[]config.OutputConfig{out("flac", lib), out("mp3-v0", lib), out("opus", lib)}, true},
+		{[]config.OutputConfig{out("flac-8", lib), out("flac-5", mobile)}, true},
+		{[]config.OutputConfig{out("alac", lib), out("aac", lib)}, false},                                // 都是 m4a
+		{[]config.OutputConfig{out("flac-5", lib), out("flac-8", lib)}, false},                           // 都是 flac
+		{[]config.OutputConfig{out("opus", lib), out("opus-96", lib+string(filepath.Separator))}, false}, // 同一目录的不同写法
+	}
+	for _, tt := range tests {
+		cfg := &config.Config{Outputs: tt.outputs, PathTemplate: naming.DefaultTemplate, MaxNameLength: 255}
+		outputs, err := ResolveOutputs(cfg)
+		if tt.ok && (err != nil || len(outputs) != len(tt.outputs)) {
+			t.Errorf("ResolveOutputs(%v) = %v", tt.outputs, err)
+		}
+		if !tt.ok && (err == nil || !strings.Contains(err.Error(), "both write")) {
+			t.Errorf("ResolveOutputs(%v) = %v, want a duplicate output error", tt.outputs, err)
+		}
+	}
+}
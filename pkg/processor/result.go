@@ -0,0 +1,68 @@
+package processor
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrTracksFailed 表示因为有音轨失败而放弃了整个输出，具体原因见各音轨的 TrackResult.Err
+var ErrTracksFailed = errors.New("track(s) failed")
+
+// stderrExcerptLines 是 TrackResult 中保留的 FFmpeg 输出行数
+const stderrExcerptLines = 20
+
+// TrackResult 是一条音轨在一个输出目标上的处理结果
+type TrackResult struct {
+	Disc       int
+	Track      int
+	Title      string
+	Profile    string // 输出的编码配置名称
+	OutputPath string
+
+	// 源镜像的音频参数，未知时为 0
+	SampleRate    int
+	BitsPerSample int
+	Channels      int
+
+	Err      error  // 为 nil 表示成功
+	Stderr   string // 失败时 FFmpeg 输出的末尾片段
+	Attempts int    // 实际尝试次数，包含重试
+	Resumed  bool   // 中断前已完成，本次没有重新转码
+
+	inLibrary bool // 续传的文件已位于音乐库中，提交时无需移动
+}
+
+// OK 返回音轨是否处理成功
+func (r TrackResult) OK() bool {
+	return r.Err == nil
+}
+
+// AlbumResult 是整张专辑在所有输出目标上的处理结果，按输出、光盘、音轨顺序排列
+type AlbumResult struct {
+	Tracks []TrackResult
+}
+
+// Failed 返回处理失败的音轨
+func (r *AlbumResult) Failed() []TrackResult {
+	var failed []TrackResult
+	for _, t := range r.Tracks {
+		if !t.OK() {
+			failed = append(failed, t)
+		}
+	}
+	return failed
+}
+
+// Succeeded 返回处理成功的音轨数
+func (r *AlbumResult) Succeeded() int {
+	return len(r.Tracks) - len(r.Failed())
+}
+
+// stderrExcerpt 只保留 FFmpeg 输出的最后几行，错误信息通常位于末尾
+func stderrExcerpt(stderr string) string {
+	lines := strings.Split(strings.TrimRight(stderr, "\n"), "\n")
+	if len(lines) > stderrExcerptLines {
+		lines = lines[len(lines)-stderrExcerptLines:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,109 @@
+package processor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/yleoer/music/pkg/database"
+	"github.com/yleoer/music/pkg/probe"
+	"github.com/yleoer/music/pkg/tag"
+)
+
+// ProgressStore 保存已完成音轨的校验信息，用于中断后按音轨续传。database.AlbumStore 实现了该接口
+type ProgressStore interface {
+	SaveTrackProgress(p *database.TrackProgress) error
+	TrackProgress(albumPath, profile string) (map[string]database.TrackProgress, error)
+}
+
+// resumeTrack 检查音轨是否在中断前已经完成：暂存目录或音乐库中存在与进度记录的时长和校验和一致的文件。
+// 第二个返回值表示该文件已经位于音乐库中，无需再移动
+func resumeTrack(ctx context.Context, job trackJob, profile *Profile, prober probe.Prober) (ok, inLibrary bool) {
+	if job.checkpoint == nil {
+		return false, false
+	}
+	for _, candidate := range []string{job.output, job.final} {
+		if _, err := os.Stat(candidate); err != nil {
+			continue
+		}
+		if verifyOutput(ctx, candidate, profile, job.track, prober) != nil {
+			continue
+		}
+		cp, err := newCheckpoint(ctx, candidate, profile, prober)
+		if err != nil || cp.Size != job.checkpoint.Size || cp.Checksum != job.checkpoint.Checksum ||
+			cp.Duration != job.checkpoint.Duration.Truncate(time.Millisecond) {
+			continue
+		}
+		return true, candidate == job.final
+	}
+	return false, false
+}
+
+// newCheckpoint 计算输出文件的时长、大小和 SHA-256 校验和
+func newCheckpoint(ctx context.Context, path string, profile *Profile, prober probe.Prober) (*database.TrackProgress, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := outputDuration(ctx, path, profile, prober)
+	if err != nil {
+		return nil, err
+	}
+	return &database.TrackProgress{
+		Duration: duration.Truncate(time.Millisecond), // 数据库以毫秒保存
+		Size:     size,
+		Checksum: hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// outputDuration 返回输出文件的时长：FLAC 读取 STREAMINFO，其他格式通过 prober (ffprobe) 读取，prober 为 nil 时返回 0
+func outputDuration(ctx context.Context, path string, profile *Profile, prober probe.Prober) (time.Duration, error) {
+	if profile.Extension == "flac" {
+		meta, err := tag.ReadFLACMetadata(path)
+		if err != nil {
+			return 0, err
+		}
+		if meta.StreamInfo.SampleRate == 0 {
+			return 0, fmt.Errorf("invalid sample rate in %s", path)
+		}
+		return time.Duration(meta.StreamInfo.TotalSamples) * time.Second / time.Duration(meta.StreamInfo.SampleRate), nil
+	}
+	if prober == nil {
+		return 0, nil
+	}
+	format, err := prober.Probe(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	if format.SampleRate == 0 || format.TotalSamples == 0 {
+		return 0, fmt.Errorf("unknown duration of %s", path)
+	}
+	return time.Duration(format.TotalSamples) * time.Second / time.Duration(format.SampleRate), nil
+}
+
+// saveProgress 记录已完成的音轨，失败只影响续传，不影响本次处理
+func saveProgress(ctx context.Context, store ProgressStore, job trackJob, profile *Profile, prober probe.Prober, logs *jobLog) {
+	if store == nil {
+		return
+	}
+	cp, err := newCheckpoint(ctx, job.output, profile, prober)
+	if err == nil {
+		cp.AlbumPath = job.albumPath
+		cp.Profile = profile.Name
+		cp.RelPath = job.rel
+		err = store.SaveTrackProgress(cp)
+	}
+	if err != nil {
+		logs.Printf("  -> WARN: Could not save progress for track %02d: %v", job.track.Number, err)
+	}
+}
@@ -0,0 +1,461 @@
+package processor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yleoer/music/pkg/album"
+	"github.com/yleoer/music/pkg/database"
+	"github.com/yleoer/music/pkg/probe"
+	"github.com/yleoer/music/pkg/tag"
+)
+
+// stagingDirName 是音乐库根目录下的暂存目录。暂存目录与音乐库位于同一文件系统，转码完成后通过 rename 移入音乐库：
+// 音乐库中还没有专辑目录时整个目录一次移入，媒体服务器不会扫描到半张专辑；合并到已有目录时逐个文件移入，
+// 每个文件都是完整的，但合并过程中可能看到部分文件。
+// 每张专辑的每个编码配置使用由源目录和配置名称决定的固定子目录 (多个输出可以共用一个音乐库)，
+// 进程中断后已完成的音轨保留在其中，重启后续传
+const stagingDirName = ".staging"
+
+// staleStagingAge 之前未被修改的暂存目录视为已放弃，启动时清理
+const staleStagingAge = 7 * 24 * time.Hour
+
+// commitMu 串行化移入音乐库的操作。并发处理的专辑可能写入同一目录 (如同一艺术家)，
+// 冲突检查与移动之间不能被其他专辑插入
+var commitMu sync.Mutex
+
+// stagedOutput 是一张专辑在一个输出目标上的暂存区
+type stagedOutput struct {
+	output    Output
+	albumPath string
+	dir       string                  // 专辑的暂存目录，同一专辑每次处理都相同，中断后可以续传
+	rel       map[*album.Track]string // 音轨在音乐库中的相对路径
+	cover     string                  // 封面文件在音乐库中的相对路径，未写入封面时为空
+	progress  map[string]database.TrackProgress
+}
+
+// newStagedOutput 计算专辑在输出目标中的路径，在暂存目录中创建对应的目录结构，并读取上次中断前的进度
+func newStagedOutput(a *album.Album, output Output, progress ProgressStore) (*stagedOutput, error) {
+	rel, err := planOutputPaths(a, output)
+	if err != nil {
+		return nil, err
+	}
+	dir := stagingDir(output, a.Path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create staging directory %s: %w", dir, err)
+	}
+	s := &stagedOutput{output: output, albumPath: a.Path, dir: dir, rel: rel}
+	if progress != nil {
+		if s.progress, err = progress.TrackProgress(a.Path, output.Profile.Name); err != nil {
+			return nil, err
+		}
+	}
+	for _, r := range rel {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, r)), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create staging directory: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// stagingDir 返回源目录为 albumPath 的专辑在输出目标中的暂存目录
+func stagingDir(output Output, albumPath string) string {
+	sum := sha256.Sum256([]byte(albumPath + "\x00" + output.Profile.Name))
+	return filepath.Join(output.LibraryDir, stagingDirName, hex.EncodeToString(sum[:8]))
+}
+
+// jobs 按光盘和音轨顺序列出转码任务，输出写入暂存目录
+func (s *stagedOutput) jobs(a *album.Album) []trackJob {
+	var jobs []trackJob
+	for _, disc := range a.Discs {
+		for _, track := range disc.Tracks {
+			rel := s.rel[track]
+			job := trackJob{
+				disc:      disc,
+				track:     track,
+				output:    filepath.Join(s.dir, rel),
+				final:     filepath.Join(s.output.LibraryDir, rel),
+				rel:       rel,
+				albumPath: s.albumPath,
+			}
+			if cp, ok := s.progress[rel]; ok {
+				job.checkpoint = &cp
+			}
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// coverInput 把封面写入暂存目录，作为 FFmpeg 嵌入封面的输入文件。文件名不在音轨的目录中，不会被移入音乐库
+func (s *stagedOutput) coverInput(cover *coverArt) (string, error) {
+	path := filepath.Join(s.dir, ".cover."+cover.ext)
+	if err := os.WriteFile(path, cover.data, 0644); err != nil {
+		return "", fmt.Errorf("failed to stage cover art: %w", err)
+	}
+	return path, nil
+}
+
+// writeCover 把封面作为 cover.jpg (见 fileCover) 写入专辑在暂存目录中的目录，即所有音轨所在目录的公共前缀，
+// 随音轨一起移入音乐库。音轨直接位于音乐库根目录时不写入
+func (s *stagedOutput) writeCover(cover *coverArt) error {
+	rels := make([]string, 0, len(s.rel))
+	for _, r := range s.rel {
+		rels = append(rels, r)
+	}
+	if len(rels) == 0 {
+		return nil
+	}
+	dir := commonDir(rels)
+	if dir == "." {
+		return nil
+	}
+	cover, err := fileCover(cover)
+	if err != nil {
+		return fmt.Errorf("failed to convert cover file: %w", err)
+	}
+	rel := filepath.Join(dir, "cover."+cover.ext)
+	if err := os.WriteFile(filepath.Join(s.dir, rel), cover.data, 0644); err != nil {
+		return fmt.Errorf("failed to stage cover file: %w", err)
+	}
+	s.cover = rel
+	return nil
+}
+
+// commit 将成功的音轨移入音乐库，成功后删除暂存目录。有音轨失败且不接受部分结果时不移动任何文件，
+// 已校验的音轨留在暂存目录中，重试时按进度记录续传，只重新处理失败的音轨；任务永久失败时由 DiscardStaged 删除。
+// 音乐库中还没有专辑目录时把暂存的专辑目录一次 rename 到位 (见 renameAlbumDir)；否则逐个文件合并到已有目录，
+// 绝不覆盖已有的文件，任何一个文件移动失败时撤销已移入的文件和新建的目录，音乐库中不会留下不完整的专辑
+func (s *stagedOutput) commit(jobs []trackJob, results []TrackResult, acceptPartial bool, logger *log.Logger) error {
+	commitMu.Lock()
+	defer commitMu.Unlock()
+	var rels []string
+	failed := 0
+	for i, r := range results {
+		switch {
+		case !r.OK():
+			failed++
+		case !r.inLibrary:
+			rels = append(rels, s.rel[jobs[i].track])
+		}
+	}
+	if failed > 0 && !acceptPartial {
+		return fmt.Errorf("%d %w, completed tracks for profile %s kept in %s for retry", failed, ErrTracksFailed, s.output.Profile.Name, s.dir)
+	}
+	if len(rels) == 0 {
+		s.remove()
+		return nil
+	}
+	// 先检查冲突，以便一次报告所有冲突的文件；移动时仍会原子地拒绝覆盖，防止检查后被其他程序写入
+	var conflicts []string
+	for _, r := range rels {
+		if _, err := os.Lstat(filepath.Join(s.output.LibraryDir, r)); err == nil {
+			conflicts = append(conflicts, r)
+		}
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("refusing to overwrite %d existing file(s) in %s, e.g. %s",
+			len(conflicts), s.output.LibraryDir, conflicts[0])
+	}
+	rootRel := commonDir(rels)
+	finalRoot := filepath.Join(s.output.LibraryDir, rootRel)
+	m := &libraryMove{}
+	renamed, err := s.renameAlbumDir(m, rootRel, rels)
+	if err != nil {
+		m.undo(logger)
+		return err
+	}
+	if renamed {
+		logger.Printf("  -> Moved album directory with %d file(s) into %s", len(rels), finalRoot)
+		if !inDir(s.cover, rootRel) {
+			s.commitCover(m, logger)
+		}
+		s.remove()
+		return nil
+	}
+	for _, r := range rels {
+		if err := m.move(filepath.Join(s.dir, r), filepath.Join(s.output.LibraryDir, r)); err != nil {
+			m.undo(logger)
+			return err
+		}
+	}
+	if m.created(finalRoot) {
+		logger.Printf("  -> Moved %d file(s) into %s", len(rels), finalRoot)
+	} else {
+		logger.Printf("  -> Moved %d file(s) into existing directory %s", len(rels), finalRoot)
+	}
+	s.commitCover(m, logger)
+	s.remove()
+	return nil
+}
+
+// renameAlbumDir 在音乐库中还没有专辑目录 (所有音轨所在目录的公共前缀 rootRel) 时，把暂存的专辑目录一次 rename 到位，
+// 媒体服务器不会扫描到半张专辑，中途崩溃也不会在音乐库中留下部分文件。移动前删除暂存目录中不属于本次提交的文件。
+// 音轨直接位于音乐库根目录或专辑目录已存在时返回 false，由调用方逐个文件合并
+func (s *stagedOutput) renameAlbumDir(m *libraryMove, rootRel string, rels []string) (bool, error) {
+	if rootRel == "." {
+		return false, nil
+	}
+	dst := filepath.Join(s.output.LibraryDir, rootRel)
+	if _, err := os.Lstat(dst); !os.IsNotExist(err) {
+		return false, nil
+	}
+	keep := make(map[string]bool, len(rels)+1)
+	for _, r := range rels {
+		if _, err := os.Lstat(filepath.Join(s.dir, r)); err != nil {
+			return false, fmt.Errorf("staged file for %s is missing: %w", r, err)
+		}
+		keep[r] = true
+	}
+	if inDir(s.cover, rootRel) {
+		keep[s.cover] = true
+	}
+	src := filepath.Join(s.dir, rootRel)
+	if err := s.pruneStaged(src, keep); err != nil {
+		return false, fmt.Errorf("failed to prepare staged album directory %s: %w", src, err)
+	}
+	if err := m.mkdirAll(filepath.Dir(dst)); err != nil {
+		return false, fmt.Errorf("failed to create library directory %s: %w", filepath.Dir(dst), err)
+	}
+	// rename 只会替换空目录；检查之后其他程序创建了同名的非空目录时 rename 失败，改为逐个文件合并
+	if err := os.Rename(src, dst); err != nil {
+		if _, statErr := os.Lstat(dst); statErr == nil {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to move %s into library: %w", dst, err)
+	}
+	m.files = append(m.files, [2]string{src, dst})
+	return true, nil
+}
+
+// pruneStaged 删除暂存目录 dir 中不在 keep (相对于暂存目录的路径) 中的文件，如上次处理时按其他路径模板留下的音轨
+func (s *stagedOutput) pruneStaged(dir string, keep map[string]bool) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		if !keep[rel] {
+			return os.Remove(path)
+		}
+		return nil
+	})
+}
+
+// inDir 判断相对路径 rel 是否位于相对目录 dir 之下
+func inDir(rel, dir string) bool {
+	return rel != "" && dir != "." && strings.HasPrefix(rel, dir+string(filepath.Separator))
+}
+
+// commitCover 将暂存的封面文件移入音乐库。音乐库中已有封面时保留原文件，不视为冲突
+func (s *stagedOutput) commitCover(m *libraryMove, logger *log.Logger) {
+	if s.cover == "" {
+		return
+	}
+	dst := filepath.Join(s.output.LibraryDir, s.cover)
+	if err := m.move(filepath.Join(s.dir, s.cover), dst); err != nil && !errors.Is(err, fs.ErrExist) {
+		logger.Printf("  -> WARN: Could not move cover file into %s: %v", dst, err)
+	}
+}
+
+// libraryMove 记录移入音乐库的文件和为此新建的目录，以便出错时撤销
+type libraryMove struct {
+	files [][2]string // {暂存路径, 音乐库路径}
+	dirs  []string    // 新建的目录，按创建顺序
+}
+
+// move 将 src 移动到 dst，按需创建 dst 所在的目录。dst 已存在时返回 fs.ErrExist
+func (m *libraryMove) move(src, dst string) error {
+	if err := m.mkdirAll(filepath.Dir(dst)); err != nil {
+		return fmt.Errorf("failed to create library directory %s: %w", filepath.Dir(dst), err)
+	}
+	if err := renameNoReplace(src, dst); err != nil {
+		return fmt.Errorf("failed to move %s into library: %w", dst, err)
+	}
+	m.files = append(m.files, [2]string{src, dst})
+	return nil
+}
+
+// mkdirAll 逐级创建目录，只记录本次新建的目录。os.Mkdir 在目录已存在时失败，
+// 因此其他程序同时创建的目录不会被当作自己的而在撤销时删除
+func (m *libraryMove) mkdirAll(dir string) error {
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		return nil
+	}
+	if parent := filepath.Dir(dir); parent != dir {
+		if err := m.mkdirAll(parent); err != nil {
+			return err
+		}
+	}
+	err := os.Mkdir(dir, 0755)
+	if err == nil {
+		m.dirs = append(m.dirs, dir)
+		return nil
+	}
+	if info, statErr := os.Stat(dir); statErr == nil && info.IsDir() {
+		return nil
+	}
+	return err
+}
+
+// created 返回 dir 是否由本次移动新建
+func (m *libraryMove) created(dir string) bool {
+	for _, d := range m.dirs {
+		if d == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// undo 将已移入音乐库的文件移回暂存目录，并删除新建的目录 (只删除空目录，不会删除其他程序写入的内容)
+func (m *libraryMove) undo(logger *log.Logger) {
+	for i := len(m.files) - 1; i >= 0; i-- {
+		src, dst := m.files[i][0], m.files[i][1]
+		if err := os.Rename(dst, src); err != nil {
+			if err := os.Remove(dst); err != nil {
+				logger.Printf("  -> ERROR: Could not roll back %s: %v", dst, err)
+			}
+		}
+	}
+	for i := len(m.dirs) - 1; i >= 0; i-- {
+		os.Remove(m.dirs[i])
+	}
+	m.files, m.dirs = nil, nil
+}
+
+// renameNoReplace 将 src 移动到 dst，dst 已存在时返回 fs.ErrExist 而不是覆盖。
+// 先建立硬链接再删除 src：硬链接在目标已存在时原子地失败。不支持硬链接的文件系统退回到先检查再 rename
+func renameNoReplace(src, dst string) error {
+	err := os.Link(src, dst)
+	if err == nil {
+		if err := os.Remove(src); err != nil {
+			os.Remove(dst)
+			return err
+		}
+		return nil
+	}
+	if errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	if _, statErr := os.Lstat(dst); statErr == nil {
+		return &fs.PathError{Op: "rename", Path: dst, Err: fs.ErrExist}
+	}
+	return os.Rename(src, dst)
+}
+
+// remove 删除专辑的暂存目录
+func (s *stagedOutput) remove() {
+	os.RemoveAll(s.dir)
+}
+
+// discardStaged 删除专辑在各输出目标中的暂存目录
+func discardStaged(outputs []Output, albumPath string) error {
+	var errs []error
+	for _, o := range outputs {
+		if err := os.RemoveAll(stagingDir(o, albumPath)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// cleanStaging 删除长时间未被续传的暂存目录，较新的目录保留给中断的专辑续传
+func cleanStaging(libraryDir string) error {
+	root := filepath.Join(libraryDir, stagingDirName)
+	entries, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < staleStagingAge {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(root, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commonDir 返回一组相对路径所在目录的最长公共前缀，没有公共目录时返回 "."
+func commonDir(rels []string) string {
+	common := strings.Split(filepath.Dir(rels[0]), string(filepath.Separator))
+	for _, r := range rels[1:] {
+		parts := strings.Split(filepath.Dir(r), string(filepath.Separator))
+		n := 0
+		for n < len(common) && n < len(parts) && common[n] == parts[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	if len(common) == 0 {
+		return "."
+	}
+	return filepath.Join(common...)
+}
+
+// lossyDurationTolerance 是有损输出时长与音轨长度之间允许的误差。编码器在首尾加入的填充远小于此，截断的输出会短得多
+const lossyDurationTolerance = 200 * time.Millisecond
+
+// verifyOutput 检查转码结果是否完整：文件非空，FLAC 输出要求采样数与音轨长度一致，
+// 其他格式在有 prober 时要求能读出时长且与音轨长度的误差不超过 lossyDurationTolerance
+func verifyOutput(ctx context.Context, path string, profile *Profile, track *album.Track, prober probe.Prober) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("output file missing: %w", err)
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("output file %s is empty", path)
+	}
+	if profile.Extension != "flac" {
+		return verifyDuration(ctx, path, profile, track, prober)
+	}
+	meta, err := tag.ReadFLACMetadata(path)
+	if err != nil {
+		return fmt.Errorf("output is not a valid FLAC file: %w", err)
+	}
+	// 镜像长度未知时最后一条音轨的结束位置为 0，无法检查
+	if track.EndSample > 0 && meta.StreamInfo.SampleRate == track.SampleRate {
+		if want := track.EndSample - track.StartSample; meta.StreamInfo.TotalSamples != want {
+			return fmt.Errorf("output has %d samples, expected %d", meta.StreamInfo.TotalSamples, want)
+		}
+	}
+	return nil
+}
+
+// verifyDuration 用 prober 读取有损输出的时长并与音轨长度比较，prober 为 nil 时不检查
+func verifyDuration(ctx context.Context, path string, profile *Profile, track *album.Track, prober probe.Prober) error {
+	if prober == nil {
+		return nil
+	}
+	got, err := outputDuration(ctx, path, profile, prober)
+	if err != nil {
+		return fmt.Errorf("cannot read duration of output: %w", err)
+	}
+	if track.EndSample == 0 || track.SampleRate == 0 {
+		return nil
+	}
+	want := time.Duration(track.EndSample-track.StartSample) * time.Second / time.Duration(track.SampleRate)
+	if diff := got - want; diff < -lossyDurationTolerance || diff > lossyDurationTolerance {
+		return fmt.Errorf("output lasts %v, expected %v", got.Round(time.Millisecond), want.Round(time.Millisecond))
+	}
+	return nil
+}
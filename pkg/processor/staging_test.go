@@ -0,0 +1,212 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yleoer/music/pkg/album"
+	"github.com/yleoer/music/pkg/audio"
+	"github.com/yleoer/music/pkg/probe"
+)
+
+// newTestStage 在暂存目录中写入 rels 对应的文件，返回可以直接提交的暂存区
+func newTestStage(t *testing.T, library string, rels ...string) (*stagedOutput, []trackJob, []TrackResult) {
+	t.Helper()
+	s := &stagedOutput{
+		output: Output{Profile: &Profile{Name: "flac"}, LibraryDir: library},
+		dir:    filepath.Join(library, stagingDirName, "test"),
+		rel:    make(map[*album.Track]string),
+	}
+	var jobs []trackJob
+	var results []TrackResult
+	for i, rel := range rels {
+		track := &album.Track{Number: i + 1}
+		s.rel[track] = rel
+		path := filepath.Join(s.dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(rel), 0644); err != nil {
+			t.Fatal(err)
+		}
+		jobs = append(jobs, trackJob{track: track})
+		results = append(results, TrackResult{Track: i + 1})
+	}
+	return s, jobs, results
+}
+
+func TestCommitMovesIntoNewDirectory(t *testing.T) {
+	library := t.TempDir()
+	s, jobs, results := newTestStage(t, library, "A/B/01.flac", "A/B/C/02.flac")
+	// 上次按其他路径模板留下的文件不随专辑目录移入音乐库
+	stale := filepath.Join(s.dir, "A", "B", "old name.flac")
+	if err := os.WriteFile(stale, []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.commit(jobs, results, false, log.New(io.Discard, "", 0)); err != nil {
+		t.Fatal(err)
+	}
+	for _, rel := range []string{"A/B/01.flac", "A/B/C/02.flac"} {
+		if data, err := os.ReadFile(filepath.Join(library, rel)); err != nil || string(data) != rel {
+			t.Errorf("%s not moved into library: %v", rel, err)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(library, "A", "B", "old name.flac")); !os.IsNotExist(err) {
+		t.Error("stale staged file moved into library")
+	}
+	if _, err := os.Stat(s.dir); !os.IsNotExist(err) {
+		t.Error("staging directory not removed after commit")
+	}
+}
+
+func TestCommitMergesIntoExistingDirectory(t *testing.T) {
+	library := t.TempDir()
+	existing := filepath.Join(library, "A", "B", "00.flac")
+	if err := os.MkdirAll(filepath.Dir(existing), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(existing, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, jobs, results := newTestStage(t, library, "A/B/01.flac", "A/B/02.flac")
+	if err := s.commit(jobs, results, false, log.New(io.Discard, "", 0)); err != nil {
+		t.Fatal(err)
+	}
+	for _, rel := range []string{"A/B/00.flac", "A/B/01.flac", "A/B/02.flac"} {
+		if _, err := os.Stat(filepath.Join(library, rel)); err != nil {
+			t.Errorf("%s missing after merge: %v", rel, err)
+		}
+	}
+}
+
+func TestCommitRefusesToOverwrite(t *testing.T) {
+	library := t.TempDir()
+	existing := filepath.Join(library, "A", "B", "02.flac")
+	if err := os.MkdirAll(filepath.Dir(existing), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(existing, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, jobs, results := newTestStage(t, library, "A/B/01.flac", "A/B/02.flac")
+	if err := s.commit(jobs, results, false, log.New(io.Discard, "", 0)); err == nil {
+		t.Fatal("commit overwrote an existing file")
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "original" {
+		t.Errorf("existing file changed to %q", data)
+	}
+	if _, err := os.Lstat(filepath.Join(library, "A", "B", "01.flac")); !os.IsNotExist(err) {
+		t.Error("commit moved part of the album despite a conflict")
+	}
+}
+
+func TestCommitRollsBackPartialMove(t *testing.T) {
+	library := t.TempDir()
+	s, jobs, results := newTestStage(t, library, "A/B/01.flac", "A/C/02.flac")
+	// 第二个文件在冲突检查之后、移动之前消失，移动失败
+	if err := os.Remove(filepath.Join(s.dir, "A", "C", "02.flac")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.commit(jobs, results, false, log.New(io.Discard, "", 0)); err == nil {
+		t.Fatal("commit succeeded with a missing staged file")
+	}
+	if _, err := os.Lstat(filepath.Join(library, "A")); !os.IsNotExist(err) {
+		t.Error("failed commit left files or directories in the library")
+	}
+}
+
+func TestCommitKeepsStagingWhenTracksFail(t *testing.T) {
+	library := t.TempDir()
+	s, jobs, results := newTestStage(t, library, "A/B/01.flac", "A/B/02.flac")
+	results[1].Err = errors.New("encode failed")
+	if err := s.commit(jobs, results, false, log.New(io.Discard, "", 0)); !errors.Is(err, ErrTracksFailed) {
+		t.Fatalf("commit() = %v, want ErrTracksFailed", err)
+	}
+	if _, err := os.Lstat(filepath.Join(library, "A")); !os.IsNotExist(err) {
+		t.Error("refused commit moved files into the library")
+	}
+	// 已校验的音轨留给重试续传
+	if _, err := os.Stat(filepath.Join(s.dir, "A", "B", "01.flac")); err != nil {
+		t.Errorf("verified track removed from staging: %v", err)
+	}
+
+	// 任务永久失败时删除暂存目录
+	s.dir = stagingDir(s.output, "/src/Album")
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := discardStaged([]Output{s.output}, "/src/Album"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.dir); !os.IsNotExist(err) {
+		t.Error("discardStaged left the staging directory")
+	}
+}
+
+func TestRenameNoReplace(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	for path, content := range map[string]string{src: "new", dst: "old"} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := renameNoReplace(src, dst); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("renameNoReplace onto an existing file: %v, want fs.ErrExist", err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "old" {
+		t.Errorf("destination overwritten with %q", data)
+	}
+	if err := os.Remove(dst); err != nil {
+		t.Fatal(err)
+	}
+	if err := renameNoReplace(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(src); !os.IsNotExist(err) {
+		t.Error("source still exists after move")
+	}
+}
+
+// fakeProber 返回固定的音频参数
+type fakeProber struct {
+	format audio.Format
+	err    error
+}
+
+func (p fakeProber) Probe(context.Context, string) (audio.Format, error) {
+	return p.format, p.err
+}
+
+func TestVerifyLossyOutputDuration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "01.mp3")
+	if err := os.WriteFile(path, []byte("not empty"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	profile := &Profile{Name: "mp3-v0", Extension: "mp3"}
+	track := &album.Track{SampleRate: 44100, StartSample: 44100, EndSample: 44100 * 11} // 10 秒
+	tests := []struct {
+		name    string
+		prober  probe.Prober
+		wantErr bool
+	}{
+		{"no prober", nil, false},
+		{"exact", fakeProber{format: audio.Format{SampleRate: 44100, TotalSamples: 441000}}, false},
+		{"encoder padding", fakeProber{format: audio.Format{SampleRate: 48000, TotalSamples: 480000 + 312}}, false},
+		{"truncated", fakeProber{format: audio.Format{SampleRate: 44100, TotalSamples: 44100 * 7}}, true},
+		{"unknown duration", fakeProber{format: audio.Format{SampleRate: 44100}}, true},
+		{"unreadable", fakeProber{err: errors.New("invalid data found when processing input")}, true},
+	}
+	for _, tt := range tests {
+		err := verifyOutput(context.Background(), path, profile, track, tt.prober)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: verifyOutput() = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
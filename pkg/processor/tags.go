@@ -0,0 +1,133 @@
+package processor
+
+import (
+	"strconv"
+
+	"github.com/yleoer/music/pkg/album"
+)
+
+// TagStyle 表示容器使用的标签体系
+type TagStyle int
+
+const (
+	TagsVorbis TagStyle = iota // FLAC/Ogg/Opus 的 Vorbis comment
+	TagsID3v2                  // MP3 的 ID3v2
+	TagsMP4                    // M4A 的 iTunes 风格元数据
+)
+
+// replayGainKeys 是从 CUE 的 REM 字段中透传到输出文件的 ReplayGain 标签
+var replayGainKeys = []string{
+	"REPLAYGAIN_TRACK_GAIN",
+	"REPLAYGAIN_TRACK_PEAK",
+	"REPLAYGAIN_ALBUM_GAIN",
+	"REPLAYGAIN_ALBUM_PEAK",
+}
+
+// tagField 是与容器无关的标签字段，Name 使用 Vorbis comment 的字段名
+type tagField struct {
+	Name  string
+	Value string
+}
+
+// trackTags 返回音轨需要写入的全部标签，忽略空值
+func trackTags(track *album.Track) []tagField {
+	var fields []tagField
+	add := func(name, value string) {
+		if value != "" {
+			fields = append(fields, tagField{Name: name, Value: value})
+		}
+	}
+	add("TITLE", track.Title)
+	add("ARTIST", track.Artist)
+	add("ALBUMARTIST", track.AlbumArtist)
+	add("ALBUM", track.Album)
+	add("DATE", track.Year)
+	add("TRACKNUMBER", strconv.Itoa(track.Number))
+	// 单碟专辑不写光盘编号；单独下载的套装中的一张 (如 REM DISCNUMBER 2) 仍然写入
+	if track.TotalDiscs > 1 || track.DiscNumber > 1 {
+		add("DISCNUMBER", strconv.Itoa(track.DiscNumber))
+		if track.TotalDiscs > 0 {
+			add("DISCTOTAL", strconv.Itoa(track.TotalDiscs))
+		}
+	}
+	add("GENRE", track.Genre)
+	add("COMPOSER", track.Songwriter)
+	add("ISRC", track.ISRC)
+	add("COMMENT", track.Comment)
+	for _, key := range replayGainKeys {
+		add(key, track.Rem[key])
+	}
+	add("LYRICS", track.Lyrics)
+	return fields
+}
+
+// ffmpegTagKeys 将字段名映射为 FFmpeg 在对应容器中识别的元数据键，未列出的字段在该容器中不写入
+var ffmpegTagKeys = map[TagStyle]map[string]string{
+	TagsID3v2: {
+		"TITLE":                 "title",
+		"ARTIST":                "artist",
+		"ALBUMARTIST":           "album_artist",
+		"ALBUM":                 "album",
+		"DATE":                  "date",
+		"TRACKNUMBER":           "track",
+		"DISCNUMBER":            "disc", // TPOS，值为 "编号/总数"
+		"GENRE":                 "genre",
+		"COMPOSER":              "composer",
+		"ISRC":                  "TSRC",
+		"COMMENT":               "comment",
+		"LYRICS":                "lyrics",
+		"REPLAYGAIN_TRACK_GAIN": "REPLAYGAIN_TRACK_GAIN", // 写为 TXXX 帧
+		"REPLAYGAIN_TRACK_PEAK": "REPLAYGAIN_TRACK_PEAK",
+		"REPLAYGAIN_ALBUM_GAIN": "REPLAYGAIN_ALBUM_GAIN",
+		"REPLAYGAIN_ALBUM_PEAK": "REPLAYGAIN_ALBUM_PEAK",
+	},
+	TagsMP4: {
+		"TITLE":       "title",
+		"ARTIST":      "artist",
+		"ALBUMARTIST": "album_artist",
+		"ALBUM":       "album",
+		"DATE":        "date",
+		"TRACKNUMBER": "track",
+		"DISCNUMBER":  "disc", // disk 原子，值为 "编号/总数"
+		"GENRE":       "genre",
+		"COMPOSER":    "composer",
+		"COMMENT":     "comment",
+		"LYRICS":      "lyrics",
+	},
+}
+
+// ffmpegTagKey 返回字段在指定容器中的 FFmpeg 元数据键。Vorbis comment 直接使用字段名
+func ffmpegTagKey(style TagStyle, name string) (string, bool) {
+	if style == TagsVorbis {
+		return name, true
+	}
+	key, ok := ffmpegTagKeys[style][name]
+	return key, ok
+}
+
+// ffmpegTags 返回音轨在指定容器中需要写入的 FFmpeg 元数据，Name 为元数据键。
+// ID3v2 和 MP4 没有单独的光盘总数字段，总数与编号合并写为 "编号/总数"
+func ffmpegTags(style TagStyle, track *album.Track) []tagField {
+	var tags []tagField
+	for _, field := range trackTags(track) {
+		key, ok := ffmpegTagKey(style, field.Name)
+		if !ok {
+			continue
+		}
+		if field.Name == "DISCNUMBER" && style != TagsVorbis && track.TotalDiscs > 0 {
+			field.Value += "/" + strconv.Itoa(track.TotalDiscs)
+		}
+		tags = append(tags, tagField{Name: key, Value: field.Value})
+	}
+	return tags
+}
+
+// vorbisComments 将音轨信息转换为 "KEY=value" 形式的 Vorbis comment
+func vorbisComments(track *album.Track) []string {
+	fields := trackTags(track)
+	comments := make([]string, 0, len(fields))
+	for _, f := range fields {
+		comments = append(comments, f.Name+"="+f.Value)
+	}
+	return comments
+}
@@ -0,0 +1,130 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/yleoer/music/pkg/album"
+	"github.com/yleoer/music/pkg/database"
+)
+
+// trackJob 是一条音轨在一个输出目标上的转码任务
+type trackJob struct {
+	disc   *album.Disc
+	track  *album.Track
+	output string // 转码输出路径，位于暂存目录中
+	final  string // 移入音乐库后的路径
+	rel    string // 在音乐库中的相对路径
+
+	albumPath  string                  // 专辑源目录，用作进度记录的键
+	checkpoint *database.TrackProgress // 上次中断前保存的进度，没有时为 nil
+}
+
+// jobLog 收集单个任务的日志，任务结束后再统一输出
+type jobLog struct {
+	lines []string
+	done  chan struct{}
+}
+
+// Printf 以 log.Logger 的方式记录一行日志
+func (l *jobLog) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+// runTrackJobs 用最多 opts.Workers 个 goroutine 并发执行任务并校验输出，失败的任务最多重试 opts.Retries 次，
+// 最终失败时删除不完整的输出文件。每个任务的日志先写入各自的缓冲区，再按任务顺序输出，
+// 因此同一张专辑的日志顺序与串行处理时一致。ctx 被取消后不再开始新的任务，也不再重试，
+// 这些任务的错误为 ctx.Err()。返回的结果与 jobs 一一对应
+func runTrackJobs(ctx context.Context, jobs []trackJob, profile *Profile, opts Options, logger *log.Logger,
+	run func(job trackJob, logs *jobLog) (stderr string, err error)) []TrackResult {
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]TrackResult, len(jobs))
+	logs := make([]*jobLog, len(jobs))
+	for i := range logs {
+		logs[i] = &jobLog{done: make(chan struct{})}
+	}
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(jobs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				results[i] = runTrackJob(ctx, jobs[i], profile, opts, logs[i], run)
+				close(logs[i].done)
+			}
+		}()
+	}
+	go func() {
+		for i := range jobs {
+			queue <- i
+		}
+		close(queue)
+	}()
+	for _, l := range logs {
+		<-l.done
+		for _, line := range l.lines {
+			logger.Print(line)
+		}
+	}
+	wg.Wait()
+	return results
+}
+
+// runTrackJob 执行单个任务并在失败时重试。中断前已完成的音轨直接跳过，成功的音轨记录进度以便续传
+func runTrackJob(ctx context.Context, job trackJob, profile *Profile, opts Options, logs *jobLog,
+	run func(job trackJob, logs *jobLog) (stderr string, err error)) TrackResult {
+	result := TrackResult{
+		Disc:       job.disc.DiscNumber,
+		Track:      job.track.Number,
+		Title:      job.track.Title,
+		Profile:    profile.Name,
+		OutputPath: job.final,
+
+		SampleRate:    job.track.SampleRate,
+		BitsPerSample: job.track.BitsPerSample,
+		Channels:      job.track.Channels,
+	}
+	if ok, inLibrary := resumeTrack(ctx, job, profile, opts.Prober); ok {
+		logs.Printf("  Track %02d: %s already completed before interruption, skipping.", job.track.Number, job.track.Title)
+		result.Resumed = true
+		result.inLibrary = inLibrary
+		return result
+	}
+	if err := ctx.Err(); err != nil {
+		result.Err = err
+		return result
+	}
+	retries := opts.Retries
+	for result.Attempts = 1; ; result.Attempts++ {
+		stderr, err := run(job, logs)
+		if err == nil {
+			if err = verifyOutput(ctx, job.output, profile, job.track, opts.Prober); err != nil {
+				logs.Printf("  -> ERROR: Verification failed for track %s: %v", job.track.Title, err)
+			}
+		}
+		result.Err = err
+		result.Stderr = ""
+		if err == nil {
+			saveProgress(ctx, opts.Progress, job, profile, opts.Prober, logs)
+			return result
+		}
+		if stderr != "" {
+			result.Stderr = stderrExcerpt(stderr)
+		}
+		if result.Attempts > retries || ctx.Err() != nil {
+			break
+		}
+		logs.Printf("  -> Retrying track %02d (attempt %d of %d)...", job.track.Number, result.Attempts+1, retries+1)
+	}
+	if err := os.Remove(job.output); err != nil && !os.IsNotExist(err) {
+		logs.Printf("  -> WARN: Could not remove incomplete output %s: %v", job.output, err)
+	}
+	return result
+}
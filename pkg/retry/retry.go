@@ -0,0 +1,74 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+)
+
+// transientError 标记一个稍后重试可能成功的错误
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transientError) Unwrap() error {
+	return e.err
+}
+
+// Transient 将 err 标记为暂时性错误，err 为 nil 时返回 nil
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &transientError{err: err}
+}
+
+// IsTransient 判断 err 是否为暂时性错误：被 Transient 标记的错误、超时、连接被重置或中断、网络不可达、
+// DNS 服务器暂时无法应答以及磁盘空间不足。其余错误视为永久性错误，重试也不会成功，
+// 包括源文件缺失、数据损坏，以及域名不存在、连接被拒绝这类通常由配置错误导致的网络错误
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	var te *transientError
+	if errors.As(err, &te) {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return !dnsErr.IsNotFound && (dnsErr.IsTimeout || dnsErr.IsTemporary)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.ETIMEDOUT) ||
+		errors.Is(err, syscall.ENETUNREACH) ||
+		errors.Is(err, syscall.EHOSTUNREACH) ||
+		errors.Is(err, syscall.ENETDOWN) ||
+		errors.Is(err, syscall.ENOSPC)
+}
+
+// Backoff 返回第 attempt 次 (从 1 开始) 失败后的等待时间：base 每次翻倍，不超过 maxDelay，
+// 并在后一半区间内随机抖动，避免同时失败的任务同时重试
+func Backoff(attempt int, base, maxDelay time.Duration) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < maxDelay; i++ {
+		d *= 2
+	}
+	if d > maxDelay {
+		d = maxDelay
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
@@ -0,0 +1,75 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	base, maxDelay := time.Second, 10*time.Second
+	tests := []struct {
+		attempt int
+		want    time.Duration // 抖动前的等待时间
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			d := Backoff(tt.attempt, base, maxDelay)
+			if d < tt.want/2 || d > tt.want {
+				t.Fatalf("Backoff(%d) = %v, want within [%v, %v]", tt.attempt, d, tt.want/2, tt.want)
+			}
+		}
+	}
+}
+
+// timeoutError 是一个超时的 net.Error
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsTransient(t *testing.T) {
+	opError := func(err error) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", err)}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"plain error", errors.New("corrupt frame"), false},
+		{"missing file", fs.ErrNotExist, false},
+		{"marked transient", Transient(errors.New("HTTP 503")), true},
+		{"wrapped transient", fmt.Errorf("search: %w", Transient(errors.New("HTTP 429"))), true},
+		{"net timeout", &net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}, true},
+		{"deadline exceeded", fmt.Errorf("request: %w", context.DeadlineExceeded), true},
+		{"canceled", context.Canceled, false},
+		{"connection reset", opError(syscall.ECONNRESET), true},
+		{"connection refused", opError(syscall.ECONNREFUSED), false},
+		{"network unreachable", opError(syscall.ENETUNREACH), true},
+		{"dns not found", &net.DNSError{Err: "no such host", Name: "music.163.invalid", IsNotFound: true}, false},
+		{"dns temporary", &net.DNSError{Err: "server misbehaving", Name: "music.163.com", IsTemporary: true}, true},
+		{"dns timeout", &net.DNSError{Err: "i/o timeout", Name: "music.163.com", IsTimeout: true}, true},
+		{"disk full", &fs.PathError{Op: "write", Path: "/library/01.flac", Err: syscall.ENOSPC}, true},
+	}
+	for _, tt := range tests {
+		if got := IsTransient(tt.err); got != tt.want {
+			t.Errorf("%s: IsTransient(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
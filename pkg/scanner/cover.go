@@ -0,0 +1,142 @@
+package scanner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/yleoer/music/pkg/album"
+	"github.com/yleoer/music/pkg/pathsafe"
+	"github.com/yleoer/music/pkg/tag"
+	"github.com/yleoer/music/pkg/util"
+)
+
+// coverExts 是可以作为封面的图片格式
+var coverExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".webp": true}
+
+// coverNames 是封面文件名 (不含扩展名，小写) 的优先级，越靠前越优先
+var coverNames = []string{"cover", "front", "folder", "albumart", "albumartlarge", "封面"}
+
+// artDirPattern 匹配存放扫图和封面的子目录
+var artDirPattern = regexp.MustCompile(`(?i)^(?:scans?|artworks?|art|covers?|images?|pics?|扫图|掃圖|封面)$`)
+
+// coverHintPattern 匹配包含封面字样的文件名，如 "Album - Front.jpg"、"00_cover.png"
+var coverHintPattern = regexp.MustCompile(`(?i)cover|front|封面`)
+
+// notCoverPattern 匹配封底、内页、光盘等不是封面的扫图，以及频谱图、检测软件截图
+var notCoverPattern = regexp.MustCompile(`(?i)back|inlay|inside|tray|booklet|spine|obi|disc|cd\d|matrix|封底|内页|內頁|背面|侧边|側邊|` +
+	`spectr|spek|audiochecker|auCDtect|screenshot|截图|截圖|频谱|頻譜`)
+
+// coverCandidate 是一个可能的封面文件，rank 越小越优先
+type coverCandidate struct {
+	path string
+	rank int
+}
+
+// findCover 按优先级查找专辑封面:
+//
+//  1. 专辑目录中的 cover、front、folder、albumart 等 (按此顺序，jpg/jpeg/png/webp)，其次是文件名包含 cover/front 的图片；
+//  2. Scans、Artwork、Covers 等子目录以及光盘子目录中的图片，顺序同上；
+//  3. 专辑目录中其余不像封底、内页或频谱图的图片，再其次是上述子目录中的此类图片；
+//  4. 以上都没有时，使用源 FLAC/APE/WV/TTA 文件中内嵌的封面 (album.CoverEmbedded 为 true)。
+//
+// 选中的封面指向专辑目录之外时返回错误
+func (s *AlbumScanner) findCover(root *pathsafe.Root, albumObj *album.Album, dirs []string) error {
+	locations := []string{albumObj.Path}
+	if entries, err := readDirNatural(albumObj.Path); err == nil {
+		for _, entry := range entries {
+			if entry.IsDir() && artDirPattern.MatchString(entry.Name()) {
+				locations = append(locations, filepath.Join(albumObj.Path, entry.Name()))
+			}
+		}
+	}
+	for _, dir := range dirs {
+		if dir != albumObj.Path {
+			locations = append(locations, dir)
+		}
+	}
+	var candidates []coverCandidate
+	for i, dir := range locations {
+		entries, err := readDirNatural(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			rank, ok := candidateRank(entry.Name(), i > 0)
+			if !ok || entry.IsDir() {
+				continue
+			}
+			candidates = append(candidates, coverCandidate{path: filepath.Join(dir, entry.Name()), rank: rank})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].rank < candidates[j].rank
+	})
+	if len(candidates) > 0 {
+		path, err := root.Check(candidates[0].path)
+		if err != nil {
+			return err
+		}
+		s.logger.Printf("  Using cover art %s", path)
+		albumObj.CoverArt = path
+		return nil
+	}
+	for _, disc := range albumObj.Discs {
+		source := disc.ImagePath
+		if !util.IsLosslessImageFile(source) {
+			continue
+		}
+		if _, err := tag.ReadEmbeddedCover(source); err == nil {
+			s.logger.Printf("  Using cover art embedded in %s", source)
+			albumObj.CoverArt = source
+			albumObj.CoverEmbedded = true
+			return nil
+		} else if !errors.Is(err, tag.ErrNoTag) && !errors.Is(err, os.ErrNotExist) {
+			s.logger.Printf("Warning: Could not read embedded cover art in %s: %v", source, err)
+		}
+	}
+	s.logger.Printf("  No cover art found in %s", albumObj.Path)
+	return nil
+}
+
+// candidateRank 返回图片作为封面候选的优先级，inSubdir 表示图片位于子目录中：命名的和包含封面字样的图片排在最前，
+// 专辑目录中的优先于子目录；其余图片无论在哪里都排在它们之后
+func candidateRank(name string, inSubdir bool) (int, bool) {
+	rank, ok := coverRank(name)
+	if !ok {
+		return 0, false
+	}
+	tier := 0
+	if rank > len(coverNames) {
+		tier = 2
+	}
+	if inSubdir {
+		tier++
+	}
+	return tier*100 + rank, true
+}
+
+// coverRank 返回图片文件名作为封面的优先级，不是图片或明显不是封面时返回 false
+func coverRank(name string) (int, bool) {
+	ext := strings.ToLower(filepath.Ext(name))
+	if !coverExts[ext] {
+		return 0, false
+	}
+	base := strings.ToLower(strings.TrimSpace(strings.TrimSuffix(name, filepath.Ext(name))))
+	for i, n := range coverNames {
+		if base == n {
+			return i, true
+		}
+	}
+	switch {
+	case coverHintPattern.MatchString(base) && !notCoverPattern.MatchString(strings.ReplaceAll(base, "cover", "")):
+		return len(coverNames), true
+	case notCoverPattern.MatchString(base):
+		return 0, false
+	default:
+		return len(coverNames) + 1, true
+	}
+}
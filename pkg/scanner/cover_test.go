@@ -0,0 +1,91 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yleoer/music/pkg/album"
+	"github.com/yleoer/music/pkg/pathsafe"
+)
+
+func TestCandidateRankOrder(t *testing.T) {
+	// 按期望的优先级从高到低排列
+	ordered := []struct {
+		name     string
+		inSubdir bool
+	}{
+		{"cover.jpg", false},
+		{"Folder.png", false},
+		{"Album - Front.jpg", false},
+		{"cover.webp", true},
+		{"Front.jpg", true},
+		{"00_cover.png", true},
+		{"Artist - Album.jpg", false},
+		{"001.jpg", true},
+	}
+	prev := -1
+	for _, c := range ordered {
+		rank, ok := candidateRank(c.name, c.inSubdir)
+		if !ok {
+			t.Errorf("%s (subdir %v) is not a candidate", c.name, c.inSubdir)
+			continue
+		}
+		if rank <= prev {
+			t.Errorf("%s (subdir %v) ranks %d, want lower than the previous %d", c.name, c.inSubdir, rank, prev)
+		}
+		prev = rank
+	}
+
+	for _, name := range []string{
+		"back.jpg", "Booklet 01.jpg", "CD1.png", "cover back.jpg", "inlay.jpg",
+		"spectrogram.png", "Spectrum.png", "AudioChecker.png", "auCDtect.png", "screenshot.png",
+		"cover.gif", "cover.txt",
+	} {
+		if rank, ok := candidateRank(name, false); ok {
+			t.Errorf("%s ranks %d, want it rejected", name, rank)
+		}
+	}
+}
+
+func TestFindCover(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{"named in root", []string{"folder.jpg", "cover.png", "Scans/Front.jpg"}, "cover.png"},
+		{"art folder over unhinted root image", []string{"random.jpg", "spectrogram.png", "AudioChecker.png", "Scans/Front.jpg"}, "Scans/Front.jpg"},
+		{"unhinted root image over unhinted scans", []string{"Artist - Album.jpg", "Scans/001.jpg"}, "Artist - Album.jpg"},
+		{"only spectrograms", []string{"spectrogram.png", "Scans/Back.jpg"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, f := range tt.files {
+				path := filepath.Join(dir, f)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte("image"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			root, err := pathsafe.NewRoot(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			a := &album.Album{Path: dir}
+			if err := newTestScanner().findCover(root, a, []string{dir}); err != nil {
+				t.Fatal(err)
+			}
+			want := ""
+			if tt.want != "" {
+				want = filepath.Join(root.Dir(), tt.want)
+			}
+			if a.CoverArt != want {
+				t.Errorf("cover = %q, want %q", a.CoverArt, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yleoer/music/pkg/album"
+)
+
+// discNumberPattern 是光盘编号：一到两位数字或中文数字 (一 至 九十九)
+const discNumberPattern = `(\d{1,2}|[一二三四五六七八九十]{1,3})`
+
+// discDirPatterns 匹配多碟专辑的光盘子目录名，如 CD1、CD 2、Disc 1、DISK02、[CD3]、CD1 - Live、碟1、第二碟
+var discDirPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)^[\[(]?(?:cd|disc|disk)\s*[-_.]?\s*` + discNumberPattern + `(?:[\])\s\-_.:：]|$)`),
+	regexp.MustCompile(`^[\[(]?碟\s*` + discNumberPattern + `(?:[\])\s\-_.:：]|$)`),
+	regexp.MustCompile(`^[\[(]?第?\s*` + discNumberPattern + `\s*[碟张張](?:[\])\s\-_.:：]|$)`),
+}
+
+// discHintPatterns 匹配 CUE 或镜像文件名中的光盘编号，如 "Album (Disc 2).cue"、"Album CD1.cue"、"专辑 第二碟.cue"
+var discHintPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(?:^|[^a-z])(?:cd|disc|disk)\s*[-_.]?\s*` + discNumberPattern + `(?:[^\d一二三四五六七八九十]|$)`),
+	regexp.MustCompile(`碟\s*` + discNumberPattern + `(?:[^\d一二三四五六七八九十]|$)`),
+	regexp.MustCompile(`第\s*` + discNumberPattern + `\s*[碟张張]`),
+}
+
+// DiscDirNumber 判断目录名是否为光盘子目录，返回其光盘编号
+func DiscDirNumber(name string) (int, bool) {
+	return matchDiscNumber(discDirPatterns, strings.TrimSpace(name))
+}
+
+// discHint 返回文件名 (不含扩展名) 中的光盘编号
+func discHint(name string) (int, bool) {
+	return matchDiscNumber(discHintPatterns, name)
+}
+
+func matchDiscNumber(patterns []*regexp.Regexp, s string) (int, bool) {
+	for _, re := range patterns {
+		if matches := re.FindStringSubmatch(s); matches != nil {
+			n := parseDiscNumber(matches[1])
+			return n, n > 0
+		}
+	}
+	return 0, false
+}
+
+// parseDiscNumber 解析阿拉伯数字或中文数字 (如 "二"、"十二"、"二十")，无法解析时返回 0
+func parseDiscNumber(s string) int {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+	digits := map[rune]int{'一': 1, '二': 2, '三': 3, '四': 4, '五': 5, '六': 6, '七': 7, '八': 8, '九': 9}
+	total, current := 0, 0
+	for _, r := range s {
+		if r == '十' {
+			if current == 0 {
+				current = 1
+			}
+			total += current * 10
+			current = 0
+			continue
+		}
+		current = digits[r]
+	}
+	return total + current
+}
+
+// DiscDirs 返回专辑目录下的光盘子目录，按光盘编号排序，没有时返回 nil
+func DiscDirs(albumDir string) []string {
+	entries, err := os.ReadDir(albumDir)
+	if err != nil {
+		return nil
+	}
+	var dirs []string
+	numbers := make(map[string]int)
+	for _, entry := range entries {
+		if n, ok := DiscDirNumber(entry.Name()); ok && entry.IsDir() {
+			dir := filepath.Join(albumDir, entry.Name())
+			dirs = append(dirs, dir)
+			numbers[dir] = n
+		}
+	}
+	sort.SliceStable(dirs, func(i, j int) bool {
+		if numbers[dirs[i]] != numbers[dirs[j]] {
+			return numbers[dirs[i]] < numbers[dirs[j]]
+		}
+		return naturalLess(filepath.Base(dirs[i]), filepath.Base(dirs[j]))
+	})
+	return dirs
+}
+
+// readDirNatural 读取目录并按自然顺序排列，使 "CD2.cue" 排在 "CD10.cue" 之前
+func readDirNatural(dir string) ([]os.DirEntry, error) {
+	entries, err := os.ReadDir(dir)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return naturalLess(entries[i].Name(), entries[j].Name())
+	})
+	return entries, err
+}
+
+// naturalLess 按自然顺序比较两个名称：连续的数字按数值比较，其余字符忽略大小写逐个比较
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		da, db := leadingDigits(a), leadingDigits(b)
+		if da != "" && db != "" {
+			na, nb := strings.TrimLeft(da, "0"), strings.TrimLeft(db, "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			a, b = a[len(da):], b[len(db):]
+			continue
+		}
+		ra, sizeA := utf8.DecodeRuneInString(a)
+		rb, sizeB := utf8.DecodeRuneInString(b)
+		if la, lb := unicode.ToLower(ra), unicode.ToLower(rb); la != lb {
+			return la < lb
+		}
+		a, b = a[sizeA:], b[sizeB:]
+	}
+	return len(a) < len(b)
+}
+
+func leadingDigits(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
+
+// remDiscNumber 读取 REM DISCNUMBER (如 "2" 或 "2/3") 和 REM TOTALDISCS/DISCTOTAL，缺失时为 0
+func remDiscNumber(rem map[string]string) (number, total int) {
+	value, totalValue, _ := strings.Cut(rem["DISCNUMBER"], "/")
+	number, _ = strconv.Atoi(strings.TrimSpace(value))
+	for _, v := range []string{totalValue, rem["TOTALDISCS"], rem["DISCTOTAL"]} {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > total {
+			total = n
+		}
+	}
+	return max(number, 0), total
+}
+
+// numberDiscs 确定各光盘的编号和总光盘数，并写入光盘和音轨。
+// 编号依次取自 REM DISCNUMBER (已分轨的专辑为文件的 DISCNUMBER 标签)、光盘子目录名、CUE (内嵌 CUE 则为镜像) 文件名。
+// 各光盘都有编号且互不重复时直接使用，否则按编号排序 (没有编号的按发现顺序排在最后) 后重新编号为 1..n。
+// 总数取 REM TOTALDISCS/DISCTOTAL、光盘数和最大编号中的最大值
+func (s *AlbumScanner) numberDiscs(albumObj *album.Album) {
+	type hintedDisc struct {
+		disc   *album.Disc
+		number int
+	}
+	discs := make([]hintedDisc, 0, len(albumObj.Discs))
+	seen := make(map[int]bool)
+	unique := true
+	total := len(albumObj.Discs)
+	for _, disc := range albumObj.Discs {
+		number, remTotal := remDiscNumber(disc.Rem)
+		total = max(total, remTotal)
+		source := discSource(disc)
+		if dir := filepath.Dir(source); number == 0 && dir != albumObj.Path {
+			number, _ = DiscDirNumber(filepath.Base(dir))
+		}
+		if number == 0 && disc.CuePath != "" {
+			name := filepath.Base(source)
+			number, _ = discHint(strings.TrimSuffix(name, filepath.Ext(name)))
+		}
+		if number == 0 || seen[number] {
+			unique = false
+		}
+		seen[number] = true
+		discs = append(discs, hintedDisc{disc: disc, number: number})
+	}
+	sort.SliceStable(discs, func(i, j int) bool {
+		ni, nj := discs[i].number, discs[j].number
+		return ni != 0 && (nj == 0 || ni < nj)
+	})
+	if !unique && len(discs) > 1 {
+		s.logger.Printf("  Disc numbers from REM DISCNUMBER and file names are missing or duplicated, numbering discs 1-%d.", len(discs))
+	}
+	for i, d := range discs {
+		d.disc.DiscNumber = d.number
+		if !unique {
+			d.disc.DiscNumber = i + 1
+		}
+		total = max(total, d.disc.DiscNumber)
+	}
+	for _, d := range discs {
+		d.disc.TotalDiscs = total
+		for _, track := range d.disc.Tracks {
+			track.DiscNumber = d.disc.DiscNumber
+			track.TotalDiscs = total
+		}
+		s.logger.Printf("  Disc %d of %d: %s (%d tracks)", d.disc.DiscNumber, total, discSource(d.disc), len(d.disc.Tracks))
+	}
+}
+
+// discSource 返回光盘的来源文件：CUE 文件、内嵌 CUE 的镜像，已分轨的专辑则为第一首音轨的文件
+func discSource(disc *album.Disc) string {
+	if disc.CuePath != "" {
+		return disc.CuePath
+	}
+	return disc.ImagePath
+}
@@ -0,0 +1,95 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yleoer/music/pkg/util"
+)
+
+// hasMusicFiles 判断目录中是否直接包含 CUE 或音频文件
+func hasMusicFiles(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if util.IsAudioFile(entry.Name()) || strings.EqualFold(filepath.Ext(entry.Name()), ".cue") {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAlbumDir 判断目录是否为专辑目录：直接包含 CUE 或音频文件，或者包含这样的光盘子目录
+func IsAlbumDir(dir string) bool {
+	if hasMusicFiles(dir) {
+		return true
+	}
+	for _, discDir := range DiscDirs(dir) {
+		if hasMusicFiles(discDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// Depth 返回 path 相对 root 的层级，root 本身为 0，直接子目录为 1；path 不在 root 之下时返回 -1
+func Depth(root, path string) int {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return -1
+	}
+	if rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// AlbumRoot 返回 path (文件或目录) 所属的专辑目录：文件属于其所在目录，光盘子目录属于其上级目录。
+// 专辑目录必须位于 downloadRoot 之下不超过 maxDepth 层，并且包含 CUE 或音频文件，否则返回 false
+func AlbumRoot(downloadRoot, path string, maxDepth int) (string, bool) {
+	dir := path
+	if !util.IsDirectory(path) {
+		dir = filepath.Dir(path)
+	}
+	if _, ok := DiscDirNumber(filepath.Base(dir)); ok && Depth(downloadRoot, dir) > 1 {
+		dir = filepath.Dir(dir)
+	}
+	if depth := Depth(downloadRoot, dir); depth < 1 || depth > maxDepth {
+		return "", false
+	}
+	if !IsAlbumDir(dir) {
+		return "", false
+	}
+	return dir, true
+}
+
+// FindAlbumRoots 在 dir 及其子目录中查找专辑目录，层级相对 downloadRoot 计算，不超过 maxDepth。
+// 专辑目录及光盘子目录的子目录不再继续查找，无法读取的目录被跳过
+func FindAlbumRoots(downloadRoot, dir string, maxDepth int) []string {
+	var roots []string
+	_ = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		depth := Depth(downloadRoot, path)
+		if depth < 0 || depth > maxDepth {
+			return filepath.SkipDir
+		}
+		// 光盘子目录由其上级目录代表
+		if _, ok := DiscDirNumber(d.Name()); ok && depth > 1 {
+			return filepath.SkipDir
+		}
+		if depth > 0 && IsAlbumDir(path) {
+			roots = append(roots, path)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return roots
+}
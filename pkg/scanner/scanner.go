@@ -1,133 +1,324 @@
 package scanner
 
 import (
+	"context"
+	"errors"
 	"log"
 	"os"
 	"path/filepath"
-	"regexp"
 	"sort"
 	"strings"
 
 	"github.com/yleoer/music/pkg/album"
 	"github.com/yleoer/music/pkg/converter"
+	"github.com/yleoer/music/pkg/dirname"
 	"github.com/yleoer/music/pkg/parser"
+	"github.com/yleoer/music/pkg/pathsafe"
+	"github.com/yleoer/music/pkg/sidecar"
 	"github.com/yleoer/music/pkg/util"
 )
 
+// maxSidecarSize 是读取的旁注文件的最大字节数，更大的文件不会是专辑说明
+const maxSidecarSize = 1 << 20
+
 // AlbumScanner 负责扫描专辑目录并构建 Album 对象
 type AlbumScanner struct {
 	cueParser parser.CueParser // 修改为 CueParser 实例，而不是接口
+	sidecars  sidecar.Parsers  // Info.txt、.nfo、JSON 等旁注文件的解析器
+	dirNames  *dirname.Parser  // 专辑目录名的解析规则
 	converter converter.TextConverter
 	logger    *log.Logger
 }
 
 // NewAlbumScanner 创建一个新的 AlbumScanner 实例
-func NewAlbumScanner(cp *parser.CueParser, tc converter.TextConverter, logger *log.Logger) *AlbumScanner {
+func NewAlbumScanner(cp *parser.CueParser, sidecars sidecar.Parsers, dirNames *dirname.Parser, tc converter.TextConverter, logger *log.Logger) *AlbumScanner {
 	return &AlbumScanner{
 		cueParser: *cp, // 注意这里是结构体，所以直接赋值。如果 CueParser 是接口，则传递接口。
+		sidecars:  sidecars,
+		dirNames:  dirNames,
 		converter: tc,
 		logger:    logger,
 	}
 }
 
-// ScanAlbumDirectory 扫描专辑目录并构建 Album 对象
-func (s *AlbumScanner) ScanAlbumDirectory(rootPath string) (*album.Album, error) {
+// ScanAlbumDirectory 扫描专辑目录 (包括其中的光盘子目录) 并构建 Album 对象，光盘编号的确定方式见 numberDiscs。
+// 各来源只补全优先级更高的来源没有提供的字段:
+//
+//	专辑艺术家、专辑名、年份  旁注文件 > CUE (PERFORMER、TITLE、REM DATE) > 音频文件标签 > 目录名
+//	厂牌、唱片编号            旁注文件 > CUE (REM LABEL、CATALOG) > 目录名
+//	流派                      CUE (REM GENRE) 或文件标签 > 旁注文件
+//	音轨信息                  CUE 中的音轨 (已分轨的专辑为文件标签) > 旁注文件曲目表 > 文件名 > 专辑信息
+//	歌词                      文件标签 > 在线元数据
+//
+// 旁注文件的读取方式见 readSidecars，封面的查找顺序见 findCover。目录中的 CUE、镜像、封面或旁注文件指向专辑目录之外时返回满足 errors.Is(err, pathsafe.ErrUnsafePath) 的错误，
+// ctx 被取消时停止扫描并返回 ctx.Err()
+func (s *AlbumScanner) ScanAlbumDirectory(ctx context.Context, rootPath string) (*album.Album, error) {
 	// ... (原逻辑，但调用 s.cueParser 和 s.converter 方法) ...
 	albumObj := &album.Album{Path: rootPath}
-	infoPath := filepath.Join(rootPath, "Info.txt")
-	if infoContent, err := util.ReadTextFileContent(infoPath); err == nil {
-		albumObj.InfoContent = infoContent
-		s.parseInfoContent(albumObj)
-	} else {
-		s.logger.Printf("Warning: Info.txt not found or error reading in %s: %v. Attempting to parse from directory name.", rootPath, err)
-		albumObj.Artist, albumObj.Title, albumObj.Year = s.parseArtistTitleYearFromDir(filepath.Base(rootPath))
-	}
-	albumObj.Artist = s.converter.TradToSim(albumObj.Artist)
-	albumObj.Title = s.converter.TradToSim(albumObj.Title)
-	// Find cover art
-	coverPath := filepath.Join(rootPath, "folder.jpg")
-	if _, err := os.Stat(coverPath); err == nil {
-		albumObj.CoverArt = coverPath
-	}
-	s.logger.Printf("  Searching for CUE files in %s...", rootPath)
+	root, err := pathsafe.NewRoot(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.readSidecars(root, albumObj); err != nil {
+		return nil, err
+	}
+	// 多碟专辑的 CUE 和镜像可能放在 CD1、Disc 2 等光盘子目录中
+	dirs := append([]string{rootPath}, DiscDirs(rootPath)...)
 	discNumber := 1
-	err := filepath.WalkDir(rootPath, func(path string, d os.DirEntry, err error) error {
-		if err != nil {
-			return err
+	for _, dir := range dirs {
+		if err := ctx.Err(); err != nil {
+			return albumObj, err
 		}
-		// 忽略子目录中的 .cue 文件，只处理一级目录或与音频文件同级的 .cue
-		// 或者，如果你的 CUE 文件可能在子目录，这里需要更复杂的逻辑
-		if !d.IsDir() && strings.HasSuffix(strings.ToLower(d.Name()), ".cue") && filepath.Dir(path) == rootPath {
+		s.logger.Printf("  Searching for CUE files in %s...", dir)
+		entries, err := readDirNatural(dir)
+		if err != nil && dir == rootPath {
+			return albumObj, err
+		} else if err != nil {
+			s.logger.Printf("Error reading %s for CUE files: %v", dir, err)
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(strings.ToLower(entry.Name()), ".cue") {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
 			s.logger.Printf("  Found CUE file: %s", path)
-			disc, err := s.cueParser.ProcessCueFile(path, albumObj, discNumber) // 调用新的 CueParser 方法
-			if err != nil {
+			disc, err := s.cueParser.ProcessCueFile(ctx, path, albumObj, discNumber) // 调用新的 CueParser 方法
+			if errors.Is(err, pathsafe.ErrUnsafePath) {
+				return albumObj, err // 整张专辑都不可信，停止扫描
+			} else if err != nil {
 				s.logger.Printf("Error processing CUE file %s: %v", path, err)
-				return nil // continue walking
+				continue
 			}
+			s.logger.Printf("  %s uses image %s (%d file(s), %d substituted)", entry.Name(), disc.ImagePath, len(disc.Files), len(disc.Substitutions))
 			albumObj.Discs = append(albumObj.Discs, disc)
 			discNumber++
 		}
-		return nil
-	})
-	sort.Slice(albumObj.Discs, func(i, j int) bool {
+	}
+	// 没有被外部 .cue 引用的无损镜像，尝试读取其内嵌的 CUE (外部 .cue 优先)
+	if err := s.scanEmbeddedCues(ctx, albumObj, dirs, discNumber); err != nil {
+		return albumObj, err
+	}
+	// 没有任何 CUE 的专辑按已分轨的音频文件处理
+	if len(albumObj.Discs) == 0 {
+		if err := s.scanTrackFiles(ctx, albumObj, dirs); err != nil {
+			return albumObj, err
+		}
+	}
+	s.numberDiscs(albumObj)
+	s.applyTracklist(albumObj)
+	s.completeAlbumInfo(albumObj)
+	// 封面可能内嵌在镜像中，在确定光盘之后查找
+	if err := s.findCover(root, albumObj, dirs); err != nil {
+		return albumObj, err
+	}
+	sort.SliceStable(albumObj.Discs, func(i, j int) bool {
 		return albumObj.Discs[i].DiscNumber < albumObj.Discs[j].DiscNumber
 	})
-	return albumObj, err
+	return albumObj, nil
 }
 
-// parseInfoContent 和 parseArtistTitleYearFromDir 成为 AlbumScanner 的私有方法
-func (s *AlbumScanner) parseInfoContent(album *album.Album) {
-	content := album.InfoContent
-
-	// 专辑名称
-	reAlbumName := regexp.MustCompile(`(?i)专辑名称：\s*(.+)`)
-	if matches := reAlbumName.FindStringSubmatch(content); len(matches) > 1 {
-		album.Title = strings.TrimSpace(matches[1])
+// scanEmbeddedCues 处理 dirs 中未被任何 Disc 引用的 FLAC/APE/WV/TTA 镜像中的内嵌 CUE，光盘编号从 discNumber 开始 (之后由 numberDiscs 确定最终编号)。
+// 只有遇到不安全的路径时才返回错误
+func (s *AlbumScanner) scanEmbeddedCues(ctx context.Context, albumObj *album.Album, dirs []string, discNumber int) error {
+	referenced := make(map[string]bool)
+	for _, disc := range albumObj.Discs {
+		for _, f := range disc.Files {
+			referenced[f] = true
+		}
+	}
+	for _, dir := range dirs {
+		entries, err := readDirNatural(dir)
+		if err != nil {
+			s.logger.Printf("Error reading %s for embedded CUE sheets: %v", dir, err)
+			continue
+		}
+		for _, entry := range entries {
+			imagePath := filepath.Join(dir, entry.Name())
+			if entry.IsDir() || referenced[imagePath] || !util.IsLosslessImageFile(imagePath) {
+				continue
+			}
+			disc, err := s.cueParser.ProcessEmbeddedCue(ctx, imagePath, albumObj, discNumber)
+			if errors.Is(err, parser.ErrNoEmbeddedCue) {
+				continue
+			} else if errors.Is(err, pathsafe.ErrUnsafePath) {
+				return err
+			} else if err != nil {
+				s.logger.Printf("Error processing embedded CUE in %s: %v", imagePath, err)
+				continue
+			}
+			s.logger.Printf("  Found embedded CUE in %s (%d tracks)", imagePath, len(disc.Tracks))
+			albumObj.Discs = append(albumObj.Discs, disc)
+			discNumber++
+		}
 	}
+	return nil
+}
 
-	// 出版日期 (年份)
-	reDate := regexp.MustCompile(`(?i)出版日期：\s*(\d{4})年`)
-	if matches := reDate.FindStringSubmatch(content); len(matches) > 1 {
-		album.Year = strings.TrimSpace(matches[1])
+// scanTrackFiles 将 dirs 中每个目录的音频文件 (每个文件一首音轨) 构建为光盘。只有遇到不安全的路径时才返回错误
+func (s *AlbumScanner) scanTrackFiles(ctx context.Context, albumObj *album.Album, dirs []string) error {
+	for _, dir := range dirs {
+		entries, err := readDirNatural(dir)
+		if err != nil {
+			s.logger.Printf("Error reading %s for track files: %v", dir, err)
+			continue
+		}
+		var paths []string
+		for _, entry := range entries {
+			if !entry.IsDir() && util.IsAudioFile(entry.Name()) {
+				paths = append(paths, filepath.Join(dir, entry.Name()))
+			}
+		}
+		if len(paths) == 0 {
+			continue
+		}
+		s.logger.Printf("  No CUE sheet found, treating %d audio file(s) in %s as individual tracks", len(paths), dir)
+		discs, err := s.cueParser.ProcessTrackFiles(ctx, paths, albumObj)
+		if errors.Is(err, pathsafe.ErrUnsafePath) {
+			return err
+		} else if err != nil {
+			s.logger.Printf("Error processing track files in %s: %v", dir, err)
+			continue
+		}
+		albumObj.Discs = append(albumObj.Discs, discs...)
 	}
+	return nil
+}
 
-	// 艺术家：从第一行“刘德华《笨小孩 1993-1998 国语精选》专辑简介”中提取
-	reArtist := regexp.MustCompile(`^(.+)《`)
-	if matches := reArtist.FindStringSubmatch(content); len(matches) > 1 {
-		album.Artist = strings.TrimSpace(matches[1])
-	} else {
-		// 如果第一行不符合，可以尝试从其他行找，或默认
-		// 示例：如果 Info.txt 中没有明确的“艺术家：”字段，这里可以手动指定或留空让用户填写
-		log.Printf("Warning: Could not extract artist from Info.txt. Falling back to default \"Unknown Artist\".")
-		album.Artist = "Unknown Artist"
+// checkOptional 校验专辑目录中可能不存在的文件 (如旁注文件)：
+// 文件不存在时原样返回路径，存在但指向专辑目录之外时返回错误
+func (s *AlbumScanner) checkOptional(root *pathsafe.Root, path string) (string, error) {
+	checked, err := root.Check(path)
+	if errors.Is(err, pathsafe.ErrUnsafePath) {
+		return "", err
+	} else if err != nil {
+		return path, nil
 	}
+	return checked, nil
 }
-func (s *AlbumScanner) parseArtistTitleYearFromDir(dirName string) (artist, title, year string) {
-	// 假设目录名为 "艺术家 - 专辑名 年份" 或 "专辑名 年份"
-	// 示例：劉德華 - 笨小孩 1993-1998 國語精選 WAV+CUE -> Artist: 劉德華, Title: 笨小孩 1993-1998 國語精選, Year: 1993 (或空)
 
-	// 首先尝试匹配 "艺术家 - 专辑名 [年份]"
-	reFull := regexp.MustCompile(`^(.+?)\s*-\s*(.+?)(?:\s*\(?(\d{4})\)?)?(?:\s+WAV\+CUE)?$`)
-	if matches := reFull.FindStringSubmatch(dirName); len(matches) > 0 {
-		artist = strings.TrimSpace(matches[1])
-		title = strings.TrimSpace(matches[2])
-		if len(matches) > 3 && matches[3] != "" {
-			year = matches[3]
+// readSidecars 解析专辑目录中的旁注文件 (Info.txt 优先，其余按自然顺序)，合并后填入专辑信息，先解析的文件提取的字段优先。
+// 旁注文件指向专辑目录之外时返回错误，其他读取错误只记录日志
+func (s *AlbumScanner) readSidecars(root *pathsafe.Root, albumObj *album.Album) error {
+	entries, err := readDirNatural(albumObj.Path)
+	if err != nil {
+		return nil // 读取目录的错误在查找 CUE 时报告
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && s.sidecars.Accepts(entry.Name()) {
+			names = append(names, entry.Name())
 		}
-		return
 	}
+	sort.SliceStable(names, func(i, j int) bool {
+		return strings.EqualFold(names[i], "Info.txt") && !strings.EqualFold(names[j], "Info.txt")
+	})
+	info := &sidecar.Info{}
+	for _, name := range names {
+		path, err := s.checkOptional(root, filepath.Join(albumObj.Path, name))
+		if err != nil {
+			return err
+		}
+		if stat, err := os.Stat(path); err != nil || stat.Size() > maxSidecarSize {
+			continue
+		}
+		content, err := util.ReadTextFileContent(path)
+		if err != nil {
+			s.logger.Printf("Warning: Could not read %s: %v", path, err)
+			continue
+		}
+		if strings.EqualFold(name, "Info.txt") {
+			albumObj.InfoContent = content
+		}
+		if parsed := s.sidecars.Parse(name, content); parsed != nil {
+			s.logger.Printf("  Read album info from %s", name)
+			info.Merge(parsed)
+		}
+	}
+	if info.Empty() {
+		s.logger.Printf("Warning: No album info found in sidecar files in %s. Falling back to CUE, tags and directory name.", albumObj.Path)
+		return nil
+	}
+	albumObj.Artist = s.converter.TradToSim(info.Artist)
+	albumObj.Title = s.converter.TradToSim(info.Album)
+	albumObj.Year = info.Year
+	albumObj.ReleaseDate = info.Date
+	albumObj.Label = s.converter.TradToSim(info.Label)
+	albumObj.Catalog = info.Catalog
+	albumObj.Genre = s.converter.TradToSim(info.Genre)
+	albumObj.Tracklist = info.Tracks
+	return nil
+}
 
-	// 否则，尝试匹配 "专辑名 [年份]"
-	reSimple := regexp.MustCompile(`^(.+?)(?:\s*\(?(\d{4})\)?)?(?:\s+WAV\+CUE)?$`)
-	if matches := reSimple.FindStringSubmatch(dirName); len(matches) > 0 {
-		title = strings.TrimSpace(matches[1])
-		if len(matches) > 2 && matches[2] != "" {
-			year = matches[2]
-		}
-		artist = "Unknown Artist" // 无法从目录名推断艺术家
+// applyTracklist 用旁注文件的曲目表替换 CUE 和文件标签都没有提供的音轨标题和艺术家 (来自文件名、按音轨号生成或沿用专辑艺术家)。
+// 曲目表按光盘编号和音轨号对应，必须在 numberDiscs 确定最终编号之后调用
+func (s *AlbumScanner) applyTracklist(albumObj *album.Album) {
+	if len(albumObj.Tracklist) == 0 {
 		return
 	}
+	for _, disc := range albumObj.Discs {
+		for _, track := range disc.Tracks {
+			entry, ok := albumObj.LookupTracklist(track.DiscNumber, track.Number)
+			if !ok {
+				continue
+			}
+			if track.GuessedTitle && entry.Title != "" {
+				track.Title = s.converter.TradToSim(entry.Title)
+				track.GuessedTitle = false
+			}
+			if track.GuessedArtist && entry.Artist != "" {
+				track.Artist = s.converter.TradToSim(entry.Artist)
+				track.GuessedArtist = false
+			}
+		}
+	}
+}
+
+// completeAlbumInfo 用目录名 (解析规则见 dirname.Parser) 补全旁注文件、CUE 和音频文件标签都没有提供的专辑信息，仍然没有艺术家时为 "Unknown Artist"。
+// 专辑信息随后填入各音轨中为空的字段
+func (s *AlbumScanner) completeAlbumInfo(albumObj *album.Album) {
+	fromDir := s.dirNames.Parse(filepath.Base(albumObj.Path))
+	s.logger.Printf("  Directory name matches rule %s: artist=%q, title=%q, year=%q", fromDir.Rule, fromDir.Artist, fromDir.Title, fromDir.Year)
+	if albumObj.Artist == "" {
+		albumObj.Artist = s.converter.TradToSim(fromDir.Artist)
+	}
+	if albumObj.Artist == "" {
+		albumObj.Artist = "Unknown Artist"
+	}
+	if albumObj.Title == "" {
+		albumObj.Title = s.converter.TradToSim(fromDir.Title)
+	}
+	if albumObj.Year == "" {
+		albumObj.Year = fromDir.Year
+	}
+	// 目录名中的厂牌和唱片编号只在 CUE 也没有时使用
+	cueLabel, cueCatalog := false, false
+	for _, disc := range albumObj.Discs {
+		cueLabel = cueLabel || disc.Rem["LABEL"] != ""
+		cueCatalog = cueCatalog || disc.Catalog != ""
+	}
+	if albumObj.Label == "" && !cueLabel {
+		albumObj.Label = s.converter.TradToSim(fromDir.Label)
+	}
+	if albumObj.Catalog == "" && !cueCatalog {
+		albumObj.Catalog = fromDir.Catalog
+	}
+	for _, disc := range albumObj.Discs {
+		for _, track := range disc.Tracks {
+			track.Album = firstNonEmpty(track.Album, albumObj.Title)
+			track.AlbumArtist = firstNonEmpty(track.AlbumArtist, albumObj.Artist)
+			track.Artist = firstNonEmpty(track.Artist, albumObj.Artist)
+			track.Year = firstNonEmpty(track.Year, albumObj.Year)
+			track.Genre = firstNonEmpty(track.Genre, albumObj.Genre)
+		}
+	}
+}
 
-	// 最差情况，直接用目录名作为标题
-	return "Unknown Artist", dirName, ""
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
 }
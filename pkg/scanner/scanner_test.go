@@ -0,0 +1,129 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yleoer/music/pkg/album"
+	"github.com/yleoer/music/pkg/parser"
+	"github.com/yleoer/music/pkg/pathsafe"
+)
+
+// identityConverter 不做任何转换
+type identityConverter struct{}
+
+func (identityConverter) TradToSim(text string) string { return text }
+
+func newTestScanner() *AlbumScanner {
+	return &AlbumScanner{converter: identityConverter{}, logger: log.New(io.Discard, "", 0)}
+}
+
+// testDisc 构建一张位于 dir 的已分轨光盘，titles 为空字符串的音轨标题按文件名推测
+func testDisc(dir string, titles ...string) *album.Disc {
+	disc := &album.Disc{DiscNumber: 1, ImagePath: filepath.Join(dir, "01.flac"), Rem: map[string]string{}}
+	for i, title := range titles {
+		track := &album.Track{Number: i + 1, DiscNumber: 1, Title: title}
+		if title == "" {
+			track.Title, track.GuessedTitle, track.GuessedArtist = "from name", true, true
+		}
+		disc.Tracks = append(disc.Tracks, track)
+	}
+	return disc
+}
+
+func TestApplyTracklistUsesFinalDiscNumbers(t *testing.T) {
+	root := "/music/Album"
+	// 光盘子目录中的文件都没有 DISCNUMBER 标签，解析时都是第 1 张光盘
+	cd2 := testDisc(filepath.Join(root, "CD2"), "", "")
+	cd1 := testDisc(filepath.Join(root, "CD1"), "", "Tagged")
+	a := &album.Album{
+		Path:  root,
+		Discs: []*album.Disc{cd2, cd1},
+		Tracklist: []album.TracklistEntry{
+			{Number: 1, Title: "Intro", Artist: "Guest"},
+			{Number: 2, Title: "Second"},
+		},
+	}
+	s := newTestScanner()
+	s.numberDiscs(a)
+	s.applyTracklist(a)
+
+	if cd1.DiscNumber != 1 || cd2.DiscNumber != 2 {
+		t.Fatalf("discs numbered %d and %d, want 1 and 2", cd1.DiscNumber, cd2.DiscNumber)
+	}
+	if got := cd1.Tracks[0]; got.Title != "Intro" || got.Artist != "Guest" {
+		t.Errorf("CD1 track 1 = %q by %q, want the tracklist entry", got.Title, got.Artist)
+	}
+	if got := cd1.Tracks[1].Title; got != "Tagged" {
+		t.Errorf("CD1 track 2 = %q, the tag title must win over the tracklist", got)
+	}
+	// 没有区分光盘的曲目表只对应第一张光盘
+	for _, track := range cd2.Tracks {
+		if track.Title != "from name" {
+			t.Errorf("CD2 track %d = %q, want the title from its file name", track.Number, track.Title)
+		}
+	}
+}
+
+func TestApplyTracklistPerDisc(t *testing.T) {
+	root := "/music/Album"
+	cd1 := testDisc(filepath.Join(root, "Disc 1"), "")
+	cd2 := testDisc(filepath.Join(root, "Disc 2"), "")
+	a := &album.Album{
+		Path:  root,
+		Discs: []*album.Disc{cd1, cd2},
+		Tracklist: []album.TracklistEntry{
+			{Disc: 1, Number: 1, Title: "One"},
+			{Disc: 2, Number: 1, Title: "Two"},
+		},
+	}
+	s := newTestScanner()
+	s.numberDiscs(a)
+	s.applyTracklist(a)
+	if cd1.Tracks[0].Title != "One" || cd2.Tracks[0].Title != "Two" {
+		t.Errorf("titles = %q, %q, want One, Two", cd1.Tracks[0].Title, cd2.Tracks[0].Title)
+	}
+}
+
+func TestScanRejectsCueOutsideAlbum(t *testing.T) {
+	tests := []struct {
+		name string
+		file string // CUE 中 FILE 引用的文件
+	}{
+		{"parent traversal", "../../etc/passwd"},
+		{"backslash traversal", `..\..\etc\passwd`},
+		{"absolute path", "/etc/passwd"},
+		{"symlink", "image.wav"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := t.TempDir()
+			dir := filepath.Join(base, "Artist - Album")
+			if err := os.Mkdir(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			// image.wav 是指向专辑目录之外的符号链接
+			secret := filepath.Join(base, "secret.wav")
+			if err := os.WriteFile(secret, []byte("data"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Symlink(secret, filepath.Join(dir, "image.wav")); err != nil {
+				t.Skipf("symlinks not supported: %v", err)
+			}
+			cue := "FILE \"" + tt.file + "\" WAVE\nTRACK 01 AUDIO\nINDEX 01 00:00:00\n"
+			if err := os.WriteFile(filepath.Join(dir, "album.cue"), []byte(cue), 0644); err != nil {
+				t.Fatal(err)
+			}
+			s := newTestScanner()
+			s.cueParser = *parser.NewCueParser(identityConverter{}, nil, s.logger)
+			if _, err := s.ScanAlbumDirectory(context.Background(), dir); !errors.Is(err, pathsafe.ErrUnsafePath) {
+				t.Errorf("ScanAlbumDirectory() = %v, want ErrUnsafePath so the album is quarantined", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/yleoer/music/pkg/database"
+	"github.com/yleoer/music/pkg/retry"
+)
+
+// 任务优先级，数值越大越先处理。用户手动重新排队的任务最先处理，新下载完成的专辑优先于启动时补扫的目录
+const (
+	PriorityInitialScan = 0
+	PriorityWatch       = 10
+	PriorityManual      = 20
+)
+
+// dispatcher 的休眠时间：本进程排队的任务会立即唤醒它，其他进程 (如 requeue 命令) 排队的任务
+// 最多等待 idleWakeup 才被发现；至少休眠 minWakeup，避免数据库出错时空转
+const (
+	idleWakeup = time.Minute
+	minWakeup  = 100 * time.Millisecond
+)
+
+// watchDebounce 是监听事件的防抖窗口，窗口内同一目录的多次变化只写入一次任务队列
+const watchDebounce = 2 * time.Second
+
+// Start 将上次退出时未完成的任务重新排队，并启动 dispatcher
+func (ts *TaskScheduler) Start() {
+	n, err := ts.dbStore.ResetInterruptedJobs(time.Now())
+	if err != nil {
+		ts.logger.Printf("ERROR: Failed to requeue interrupted jobs: %v", err)
+	} else if n > 0 {
+		ts.logger.Printf("Requeued %d job(s) interrupted by the last shutdown.", n)
+	}
+	ts.logQueue()
+	ts.dispatcherDone = make(chan struct{})
+	go ts.dispatch()
+}
+
+// logQueue 输出队列中排队和失败的任务，失败的任务逐个列出原因
+func (ts *TaskScheduler) logQueue() {
+	jobs, err := ts.dbStore.ListJobs(database.JobQueued, database.JobFailed)
+	if err != nil {
+		ts.logger.Printf("ERROR: Failed to read job queue: %v", err)
+		return
+	}
+	queued := 0
+	var failed []database.Job
+	for _, job := range jobs {
+		if job.State == database.JobFailed {
+			failed = append(failed, job)
+		} else {
+			queued++
+		}
+	}
+	ts.logger.Printf("Job queue: %d queued, %d failed.", queued, len(failed))
+	for _, job := range failed {
+		ts.logger.Printf("  -> Failed job %s (%d attempt(s), last at %s): %s",
+			job.Path, job.Attempts, job.UpdatedAt.Format(time.DateTime), job.LastError)
+	}
+}
+
+// enqueue 将目录以指定优先级加入队列，在 StabilityCheckInterval 之后开始检查文件稳定性。
+// 失败的任务不会因为目录变化而重新排队，需要用 requeue 命令手动重试
+func (ts *TaskScheduler) enqueue(dir string, priority int) {
+	if ts.ctx.Err() != nil {
+		return
+	}
+	if job, err := ts.dbStore.Job(dir); err == nil && job != nil && job.State == database.JobFailed {
+		ts.logger.Printf("Album %s failed permanently, ignoring change until requeued: %s", dir, job.LastError)
+		return
+	}
+	if err := ts.dbStore.EnqueueJob(dir, priority, time.Now().Add(ts.cfg.StabilityCheckInterval)); err != nil {
+		ts.logger.Printf("ERROR: Failed to schedule scan for %s: %v", dir, err)
+		return
+	}
+	ts.logger.Printf("Scheduled scan for %s in %v", dir, ts.cfg.StabilityCheckInterval)
+	ts.notify()
+}
+
+// notify 唤醒 dispatcher，不会阻塞
+func (ts *TaskScheduler) notify() {
+	select {
+	case ts.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch 是唯一的调度 goroutine：将防抖窗口结束的目录加入队列，对到期的任务检查文件稳定性，并在有空闲名额时按优先级启动已就绪的任务。
+// 等待文件稳定的目录只是在队列中推迟，不占用处理名额
+func (ts *TaskScheduler) dispatch() {
+	defer close(ts.dispatcherDone)
+	for {
+		debounce := ts.flushTriggered()
+		ts.checkDueJobs()
+		ts.startReadyJobs()
+		timer := time.NewTimer(min(ts.nextWakeup(), debounce))
+		select {
+		case <-ts.ctx.Done():
+			timer.Stop()
+			return
+		case <-ts.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// flushTriggered 将防抖窗口已经结束的目录加入任务队列，返回距离下一个窗口结束还有多久，没有等待中的目录时返回 idleWakeup
+func (ts *TaskScheduler) flushTriggered() time.Duration {
+	now := time.Now()
+	next := idleWakeup
+	var due []string
+	ts.triggerMu.Lock()
+	for dir, since := range ts.triggered {
+		if wait := since.Add(watchDebounce).Sub(now); wait > 0 {
+			next = min(next, wait)
+			continue
+		}
+		due = append(due, dir)
+		delete(ts.triggered, dir)
+	}
+	ts.triggerMu.Unlock()
+	for _, dir := range due {
+		ts.enqueue(dir, PriorityWatch)
+	}
+	return next
+}
+
+// checkDueJobs 对每个到期的任务做一次稳定性检查，稳定的标记为就绪，其余推迟到下一次检查
+func (ts *TaskScheduler) checkDueJobs() {
+	now := time.Now()
+	jobs, err := ts.dbStore.DueJobs(now)
+	if err != nil {
+		ts.logger.Printf("ERROR: Failed to read due jobs: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		if ts.ctx.Err() != nil {
+			return
+		}
+		stable, err := ts.checkStability(job.Path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			ts.logger.Printf("  -> Directory %s no longer exists. Dropping its job.", job.Path)
+			delete(ts.stability, job.Path)
+			err = ts.dbStore.RemoveJob(job.Path)
+		case err != nil:
+			ts.logger.Printf("ERROR: Error reading directory %s for stability check: %v", job.Path, err)
+			err = ts.dbStore.DeferJob(job.Path, time.Now().Add(ts.cfg.StabilityCheckInterval))
+		case stable:
+			delete(ts.stability, job.Path)
+			var ready bool
+			if ready, err = ts.dbStore.MarkJobReady(job.Path, now); ready {
+				ts.logger.Printf("  -> %s is ready for processing.", job.Path)
+			}
+		default:
+			err = ts.dbStore.DeferJob(job.Path, time.Now().Add(ts.cfg.StabilityCheckInterval))
+		}
+		if err != nil {
+			ts.logger.Printf("ERROR: %v", err)
+		}
+	}
+}
+
+// startReadyJobs 在有空闲名额时按优先级取出就绪的任务，每个任务在单独的 goroutine 中处理
+func (ts *TaskScheduler) startReadyJobs() {
+	for ts.ctx.Err() == nil {
+		select {
+		case ts.albumSlots <- struct{}{}:
+		default:
+			return
+		}
+		job, err := ts.dbStore.ClaimReadyJob()
+		if err != nil || job == nil {
+			<-ts.albumSlots
+			if err != nil {
+				ts.logger.Printf("ERROR: %v", err)
+			}
+			return
+		}
+		ts.inflight.Add(1)
+		go ts.runJob(job)
+	}
+}
+
+// runJob 处理一个任务并记录结果，结束后归还名额
+func (ts *TaskScheduler) runJob(job *database.Job) {
+	defer ts.inflight.Done()
+	defer ts.notify()
+	defer func() { <-ts.albumSlots }()
+	err := ts.performScan(job.Path)
+	state, lastError := database.JobDone, ""
+	runAt := time.Now().Add(ts.cfg.StabilityCheckInterval)
+	switch {
+	case ts.workCtx.Err() != nil:
+		// 宽限期结束时被中止，下次启动后重新处理，已完成的音轨从暂存目录续传
+		state, lastError = database.JobQueued, "interrupted by shutdown"
+		runAt = time.Now()
+	case err == nil:
+	case retry.IsTransient(err) && job.Attempts < ts.cfg.RetryMaxAttempts:
+		delay := retry.Backoff(job.Attempts, ts.cfg.RetryBaseDelay, ts.cfg.RetryMaxDelay)
+		ts.logger.Printf("WARN: Transient failure for %s (attempt %d of %d), retrying in %v: %v",
+			job.Path, job.Attempts, ts.cfg.RetryMaxAttempts, delay.Round(time.Second), err)
+		state, lastError = database.JobQueued, err.Error()
+		runAt = time.Now().Add(delay)
+	default:
+		state, lastError = database.JobFailed, err.Error()
+		if retry.IsTransient(err) {
+			lastError = fmt.Sprintf("giving up after %d attempts: %v", job.Attempts, err)
+		}
+		ts.logger.Printf("ERROR: Album %s failed permanently and will not be retried until requeued: %s", job.Path, lastError)
+		ts.discardProgress(job.Path)
+	}
+	if err := ts.dbStore.FinishJob(job.Path, state, lastError, runAt); err != nil {
+		ts.logger.Printf("ERROR: %v", err)
+	}
+}
+
+// nextWakeup 返回距离最早的排队任务到期还有多久
+func (ts *TaskScheduler) nextWakeup() time.Duration {
+	next, ok, err := ts.dbStore.NextJobRunAt()
+	if err != nil {
+		ts.logger.Printf("ERROR: %v", err)
+		return ts.cfg.StabilityCheckInterval
+	}
+	if !ok {
+		return idleWakeup
+	}
+	return max(time.Until(next), minWakeup)
+}
@@ -1,111 +1,214 @@
 package scheduler
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
 
+	"github.com/yleoer/music/pkg/album"
 	"github.com/yleoer/music/pkg/config"
 	"github.com/yleoer/music/pkg/database"
 	"github.com/yleoer/music/pkg/metadata"
+	"github.com/yleoer/music/pkg/pathsafe"
 	"github.com/yleoer/music/pkg/processor"
+	"github.com/yleoer/music/pkg/retry"
 	"github.com/yleoer/music/pkg/scanner"
 	"github.com/yleoer/music/pkg/util"
 )
 
-// TaskScheduler 负责调度专辑扫描和处理任务
+// TaskScheduler 负责调度专辑扫描和处理任务。任务保存在数据库的任务队列中，重启后继续处理
 type TaskScheduler struct {
-	cfg               *config.Config
-	dbStore           database.AlbumStore
-	albumScanner      *scanner.AlbumScanner
-	albumProcessor    *processor.FFmpegProcessor
-	metaFetcher       metadata.Fetcher
-	logger            *log.Logger
-	scanMutex         sync.Mutex // 保护扫描过程
-	pendingScans      map[string]*time.Timer
-	pendingScansMutex sync.Mutex // 保护 pendingScans map
-}
-
-// NewTaskScheduler 创建一个新的 TaskScheduler 实例
+	cfg            *config.Config
+	dbStore        database.AlbumStore
+	albumScanner   *scanner.AlbumScanner
+	albumProcessor processor.Processor
+	metaFetcher    metadata.Fetcher
+	logger         *log.Logger
+
+	albumSlots     chan struct{}              // 处理专辑的名额，等待文件稳定时不占用
+	wake           chan struct{}              // 通知 dispatcher 有新任务或空出了名额
+	stability      map[string]*stabilityCheck // 各目录的文件稳定性检查状态，只由 dispatcher 访问
+	dispatcherDone chan struct{}              // dispatcher 退出时关闭
+
+	triggerMu sync.Mutex
+	triggered map[string]time.Time // 监听到变化但还没有写入任务队列的目录，值为防抖窗口的开始时间
+
+	// ctx 是调度器的生命周期，Shutdown 时取消：不再开始新的任务。
+	// workCtx 供正在处理的专辑使用，宽限期结束时才取消：终止元数据请求和转码
+	ctx        context.Context
+	stop       context.CancelFunc
+	workCtx    context.Context
+	cancelWork context.CancelFunc
+	inflight   sync.WaitGroup // 正在处理的任务
+
+	metaMu       sync.Mutex
+	metaFailures int       // 在线元数据服务连续暂时性失败的次数
+	metaPaused   time.Time // 在此之前不查询在线元数据
+}
+
+// NewTaskScheduler 创建一个新的 TaskScheduler 实例，调用 Start 后开始处理任务。ctx 被取消时不再开始新的任务，
+// 但已经开始处理的专辑只在 Shutdown 的宽限期结束后才被中止
 func NewTaskScheduler(
+	ctx context.Context,
 	cfg *config.Config,
 	dbStore database.AlbumStore,
 	albumScanner *scanner.AlbumScanner,
-	albumProcessor *processor.FFmpegProcessor,
+	albumProcessor processor.Processor,
 	metaFetcher metadata.Fetcher,
 	logger *log.Logger,
 ) *TaskScheduler {
-	return &TaskScheduler{
+	ts := &TaskScheduler{
 		cfg:            cfg,
 		dbStore:        dbStore,
 		albumScanner:   albumScanner,
 		albumProcessor: albumProcessor,
 		metaFetcher:    metaFetcher,
 		logger:         logger,
-		pendingScans:   make(map[string]*time.Timer),
+		albumSlots:     make(chan struct{}, max(cfg.AlbumWorkers, 1)),
+		wake:           make(chan struct{}, 1),
+		stability:      make(map[string]*stabilityCheck),
+		triggered:      make(map[string]time.Time),
 	}
+	ts.ctx, ts.stop = context.WithCancel(ctx)
+	ts.workCtx, ts.cancelWork = context.WithCancel(context.WithoutCancel(ctx))
+	return ts
 }
 
-// InitialScan 对下载目录进行初始扫描
+// Shutdown 停止调度新的任务，等待正在处理的专辑在 grace 内完成。超过 grace 后取消处理：
+// FFmpeg 进程被终止，已完成的音轨保留在暂存目录中，任务重新排队，音乐库不会留下半张专辑
+func (ts *TaskScheduler) Shutdown(grace time.Duration) {
+	ts.stop()
+	if ts.dispatcherDone != nil {
+		<-ts.dispatcherDone
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ts.inflight.Wait()
+		close(done)
+	}()
+	ts.logger.Printf("Waiting up to %v for in-flight albums to finish...", grace)
+	select {
+	case <-done:
+	case <-time.After(grace):
+		ts.logger.Printf("WARN: Grace period of %v exceeded, aborting in-flight albums.", grace)
+		ts.cancelWork()
+		<-done
+	}
+	ts.cancelWork()
+	ts.logger.Println("Task scheduler stopped.")
+}
+
+// InitialScan 对下载目录进行初始扫描，将 ScanMaxDepth 层以内尚未处理的专辑目录加入任务队列
 func (ts *TaskScheduler) InitialScan(downloadRoot string) {
 	ts.logger.Println("Performing initial scan for unprocessed albums in download directory...")
-	entries, err := os.ReadDir(downloadRoot)
-	if err != nil {
+	if _, err := os.Stat(downloadRoot); err != nil {
 		ts.logger.Printf("ERROR: Error reading download directory %s for initial scan: %v", downloadRoot, err)
 		return
 	}
-	for _, entry := range entries {
-		if entry.IsDir() {
-			albumDir := filepath.Join(downloadRoot, entry.Name())
-			processed, err := ts.dbStore.IsAlbumProcessed(albumDir)
+	for _, albumDir := range scanner.FindAlbumRoots(downloadRoot, downloadRoot, ts.cfg.ScanMaxDepth) {
+		if ts.ctx.Err() != nil {
+			return
+		}
+		processed, err := ts.dbStore.IsAlbumProcessed(albumDir)
+		if err != nil {
+			ts.logger.Printf("ERROR: Error checking processed status for %s: %v", albumDir, err)
+		}
+		if processed {
+			ts.logger.Printf("  -> Album directory %s already processed. Skipping.", albumDir)
+			continue
+		}
+		// 已在队列中的任务保留其重试计划，失败的任务等待用户重新排队
+		job, err := ts.dbStore.Job(albumDir)
+		if err != nil {
+			ts.logger.Printf("ERROR: %v", err)
+		}
+		switch {
+		case job == nil || job.State == database.JobDone:
+			ts.logger.Printf("  -> Found unprocessed album directory: %s. Scheduling scan.", albumDir)
+			ts.enqueue(albumDir, PriorityInitialScan)
+		case job.State == database.JobFailed:
+			ts.logger.Printf("  -> Album directory %s failed permanently: %s. Skipping until requeued.", albumDir, job.LastError)
+		default:
+			ts.logger.Printf("  -> Album directory %s is already %s in the job queue.", albumDir, job.State)
+		}
+	}
+	ts.logger.Println("Initial scan completed.")
+}
+
+// TriggerScan 记录目录发生了变化，由 dispatcher 在 watchDebounce 之后加入任务队列：复制文件时的大量事件
+// 只在内存中合并，每个窗口只访问一次数据库。StabilityCheckInterval 内再次触发时推迟检查，Shutdown 之后调用不做任何事
+func (ts *TaskScheduler) TriggerScan(dirPath string) {
+	if ts.ctx.Err() != nil {
+		return
+	}
+	ts.triggerMu.Lock()
+	_, pending := ts.triggered[dirPath]
+	if !pending {
+		ts.triggered[dirPath] = time.Now()
+	}
+	ts.triggerMu.Unlock()
+	if !pending {
+		ts.notify()
+	}
+}
+
+// fetchMetadata 查询专辑每个音轨的在线元数据 (在线 ID 和歌词)。在线元数据只是补充，查询失败不影响转码：
+// 在线服务暂时不可用时按指数退避暂停查询，暂停期间处理的专辑不带在线元数据，暂停结束后的专辑再重试；
+// 其余错误只影响该音轨的元数据
+func (ts *TaskScheduler) fetchMetadata(ctx context.Context, a *album.Album) {
+	for _, disc := range a.Discs {
+		for _, track := range disc.Tracks {
+			if ctx.Err() != nil {
+				return
+			}
+			if until, paused := ts.metadataPaused(); paused {
+				ts.logger.Printf("    -> WARN: Online metadata service unavailable until %s, processing '%s - %s' without online metadata.",
+					until.Format(time.DateTime), a.Artist, a.Title)
+				return
+			}
+			err := ts.metaFetcher.FetchMetadataAndUpdateTrack(ctx, track)
 			if err != nil {
-				ts.logger.Printf("ERROR: Error checking processed status for %s: %v", albumDir, err)
+				ts.logger.Printf("    -> WARN: Metadata lookup for track %s failed: %v", track.Title, err)
 			}
-			if !processed {
-				ts.logger.Printf("  -> Found unprocessed album directory: %s. Scheduling scan.", albumDir)
-				ts.TriggerScan(albumDir)
-			} else {
-				ts.logger.Printf("  -> Album directory %s already processed. Skipping.", albumDir)
+			if ctx.Err() == nil {
+				ts.recordMetadataResult(err)
 			}
 		}
 	}
-	ts.logger.Println("Initial scan completed.")
 }
 
-// TriggerScan 将一个目录添加到延迟扫描队列
-func (ts *TaskScheduler) TriggerScan(dirPath string) {
-	ts.pendingScansMutex.Lock()
-	defer ts.pendingScansMutex.Unlock()
-	// 如果这个目录已经有一个待定的扫描任务，就重置计时器
-	if timer, ok := ts.pendingScans[dirPath]; ok {
-		timer.Stop()
-	}
-	// 启动一个新的计时器，延迟一段时间后执行扫描
-	timer := time.AfterFunc(ts.cfg.StabilityCheckInterval, func() {
-		ts.performScan(dirPath)
-		// 扫描完成后从队列中移除
-		ts.pendingScansMutex.Lock()
-		delete(ts.pendingScans, dirPath)
-		ts.pendingScansMutex.Unlock()
-	})
-	ts.pendingScans[dirPath] = timer
-	ts.logger.Printf("Scheduled scan for %s in %v", dirPath, ts.cfg.StabilityCheckInterval)
-}
-
-// performScan 执行实际的专辑目录扫描和处理
-func (ts *TaskScheduler) performScan(dir string) {
-	ts.scanMutex.Lock() // 获取全局锁，避免并发处理同一个目录
-	defer ts.scanMutex.Unlock()
-	ts.logger.Printf("-> Performing full scan for changes in directory: %s", dir)
-	// --- 文件稳定性检查 ---
-	if !ts.waitForFilesStability(dir) {
-		ts.logger.Printf("  -> Files in %s are still changing. Rescheduling scan.", dir)
-		ts.TriggerScan(dir) // 重新调度一次扫描
+// metadataPaused 返回在线元数据查询是否处于暂停期以及暂停的结束时间
+func (ts *TaskScheduler) metadataPaused() (time.Time, bool) {
+	ts.metaMu.Lock()
+	defer ts.metaMu.Unlock()
+	return ts.metaPaused, time.Now().Before(ts.metaPaused)
+}
+
+// recordMetadataResult 记录一次在线元数据查询的结果：暂时性错误使查询暂停，暂停时间随连续失败的次数翻倍，
+// 其余结果说明服务可用，清除失败计数
+func (ts *TaskScheduler) recordMetadataResult(err error) {
+	ts.metaMu.Lock()
+	defer ts.metaMu.Unlock()
+	if !retry.IsTransient(err) {
+		ts.metaFailures = 0
 		return
 	}
-	// --- 结束文件稳定性检查 ---
+	ts.metaFailures++
+	delay := retry.Backoff(ts.metaFailures, ts.cfg.RetryBaseDelay, ts.cfg.RetryMaxDelay)
+	ts.metaPaused = time.Now().Add(delay)
+	ts.logger.Printf("WARN: Online metadata service unavailable (%d consecutive failure(s)), pausing lookups for %v.",
+		ts.metaFailures, delay.Round(time.Second))
+}
+
+// performScan 扫描并处理一个文件已经稳定的专辑目录，专辑处理失败或被拒绝时返回错误
+func (ts *TaskScheduler) performScan(dir string) error {
+	ts.logger.Printf("-> Performing full scan for changes in directory: %s", dir)
 	processed, err := ts.dbStore.IsAlbumProcessed(dir)
 	if err != nil {
 		ts.logger.Printf("ERROR: Error checking processed status for %s before scan: %v", dir, err)
@@ -113,53 +216,210 @@ func (ts *TaskScheduler) performScan(dir string) {
 	}
 	if processed {
 		ts.logger.Printf("  -> Album directory %s already processed (after stability check). Skipping.", dir)
-		return
+		return nil
+	}
+	// 专辑已经在处理中，只有宽限期结束时才被中止
+	ctx := ts.workCtx
+	album, err := ts.albumScanner.ScanAlbumDirectory(ctx, dir)
+	if errors.Is(err, pathsafe.ErrUnsafePath) {
+		return ts.rejectAlbum(dir, err)
 	}
-	album, err := ts.albumScanner.ScanAlbumDirectory(dir)
 	if err != nil {
 		ts.logger.Printf("ERROR: Error scanning album directory %s: %v", dir, err)
-		return
+		return err
 	}
 	if album != nil && len(album.Discs) > 0 {
 		ts.logger.Printf("Album '%s - %s' (%s) found with %d discs. Processing metadata and transcoding...", album.Artist, album.Title, album.Year, len(album.Discs))
-		// 处理每个轨道的元数据
-		for _, disc := range album.Discs {
-			for _, track := range disc.Tracks {
-				ts.metaFetcher.FetchMetadataAndUpdateTrack(track)
-			}
-		}
+		ts.fetchMetadata(ctx, album)
 
-		err = ts.albumProcessor.ProcessAlbum(album, ts.cfg.MusicLibDir)
-		if err != nil {
-			ts.logger.Printf("ERROR: Error processing album '%s - %s': %v", album.Artist, album.Title, err)
-		} else {
+		result, err := ts.albumProcessor.ProcessAlbum(ctx, album)
+		run := ts.evaluateResult(dir, result, err)
+		if err := ts.dbStore.RecordAlbumRun(run); err != nil {
+			ts.logger.Printf("ERROR: Failed to record processing result for %s: %v", dir, err)
+		}
+		switch run.Status {
+		case database.StatusSucceeded:
 			ts.logger.Printf("Successfully processed album '%s - %s'.", album.Artist, album.Title)
-			ts.dbStore.AddProcessedAlbum(dir) // 处理成功，标记为已处理
+			ts.markProcessed(dir) // 处理成功，标记为已处理
+		case database.StatusPartial:
+			ts.logger.Printf("WARN: Album '%s - %s' processed with %d failed track(s), accepted by failure policy %q.",
+				album.Artist, album.Title, len(result.Failed()), ts.cfg.FailurePolicy)
+			ts.markProcessed(dir)
+		default:
+			ts.logger.Printf("ERROR: Error processing album '%s - %s': %s", album.Artist, album.Title, run.Error)
+			return albumError(run, result, err)
 		}
-	} else {
-		ts.logger.Printf("No valid album data found in %s after scan. Not marking as processed.", dir)
+		return nil
 	}
+	ts.logger.Printf("No valid album data found in %s after scan. Not marking as processed.", dir)
+	return errors.New("no valid album data found")
 }
 
-// waitForFilesStability 检查目录中的文件是否稳定
-func (ts *TaskScheduler) waitForFilesStability(dir string) bool {
-	ts.logger.Printf("  -> Waiting for files in %s to stabilize for %v...", dir, ts.cfg.StabilityQuietDuration)
-	previousFileStates := make(map[string]fileInfo)
-	fileQuietTimes := make(map[string]time.Time)
-	startOverallWait := time.Now()
-	for time.Since(startOverallWait) < ts.cfg.StabilityMaxWait {
-		currentCheckTime := time.Now()
-		entries, err := os.ReadDir(dir)
-		if err != nil {
-			ts.logger.Printf("ERROR: Error reading directory %s for stability check: %v", dir, err)
-			time.Sleep(ts.cfg.StabilityCheckInterval)
+// albumError 将失败的处理结果转换为任务的错误。只有专辑级错误和所有失败音轨的错误都是暂时性错误时，
+// 整张专辑才是暂时性失败，否则重试也不会成功
+func albumError(run *database.AlbumRun, result *processor.AlbumResult, err error) error {
+	var causes []error
+	if !errors.Is(err, processor.ErrTracksFailed) { // 由音轨失败导致的拒绝提交，原因在音轨结果中
+		causes = append(causes, err)
+	}
+	if result != nil {
+		for _, t := range result.Failed() {
+			causes = append(causes, t.Err)
+		}
+	}
+	transient := false
+	for _, cause := range causes {
+		if cause == nil {
 			continue
 		}
-		allRelevantFilesQuiet := true
-		hasRelevantFiles := false
-		currentFileStates := make(map[string]fileInfo)
+		if !retry.IsTransient(cause) {
+			return errors.New(run.Error)
+		}
+		transient = true
+	}
+	if transient {
+		return retry.Transient(errors.New(run.Error))
+	}
+	return errors.New(run.Error)
+}
+
+// rejectAlbum 拒绝处理包含不安全路径的专辑并记录原因，返回任务的错误。配置了隔离目录时将专辑移过去，
+// 避免反复扫描；移动失败 (如隔离目录在另一个文件系统上) 时专辑留在原处，返回的错误同时包含移动失败的原因，
+// 任务被标记为失败，在 requeue 之前不会重新处理
+func (ts *TaskScheduler) rejectAlbum(dir string, reason error) error {
+	ts.logger.Printf("ERROR: Refusing to process album %s: %v", dir, reason)
+	run := &database.AlbumRun{Path: dir, Status: database.StatusRejected, Error: reason.Error(), FinishedAt: time.Now()}
+	if err := ts.dbStore.RecordAlbumRun(run); err != nil {
+		ts.logger.Printf("ERROR: Failed to record rejection of %s: %v", dir, err)
+	}
+	if ts.cfg.QuarantineDir == "" {
+		return reason
+	}
+	target := filepath.Join(ts.cfg.QuarantineDir, filepath.Base(dir))
+	if _, err := os.Lstat(target); err == nil {
+		target = fmt.Sprintf("%s.%d", target, time.Now().Unix())
+	}
+	if err := os.Rename(dir, target); err != nil {
+		ts.logger.Printf("ERROR: Failed to move album %s to quarantine, leaving it in place: %v", dir, err)
+		return fmt.Errorf("%w; moving to quarantine failed: %v", reason, err)
+	}
+	ts.logger.Printf("  -> Album %s moved to quarantine at %s", dir, target)
+	return reason
+}
+
+// discardProgress 删除永久失败的专辑留在暂存目录中的音轨和续传进度，requeue 后从头处理
+func (ts *TaskScheduler) discardProgress(dir string) {
+	if err := ts.albumProcessor.DiscardStaged(dir); err != nil {
+		ts.logger.Printf("WARN: Failed to remove staged files of %s: %v", dir, err)
+	}
+	if err := ts.dbStore.ClearTrackProgress(dir); err != nil {
+		ts.logger.Printf("WARN: %v", err)
+	}
+}
+
+// markProcessed 将专辑标记为已处理，并清除不再需要的续传进度
+func (ts *TaskScheduler) markProcessed(dir string) {
+	ts.dbStore.AddProcessedAlbum(dir)
+	if err := ts.dbStore.ClearTrackProgress(dir); err != nil {
+		ts.logger.Printf("WARN: %v", err)
+	}
+}
+
+// evaluateResult 按配置的失败策略判定处理结果，生成需要保存到数据库的记录
+func (ts *TaskScheduler) evaluateResult(dir string, result *processor.AlbumResult, err error) *database.AlbumRun {
+	run := &database.AlbumRun{Path: dir, FinishedAt: time.Now()}
+	if result == nil {
+		result = &processor.AlbumResult{}
+	}
+	resumed := 0
+	for _, t := range result.Tracks {
+		record := database.TrackRecord{
+			Disc:       t.Disc,
+			Track:      t.Track,
+			Title:      t.Title,
+			Profile:    t.Profile,
+			OutputPath: t.OutputPath,
+
+			SampleRate:    t.SampleRate,
+			BitsPerSample: t.BitsPerSample,
+			Channels:      t.Channels,
+
+			Succeeded: t.OK(),
+			Stderr:    t.Stderr,
+			Attempts:  t.Attempts,
+		}
+		if t.Resumed {
+			resumed++
+		}
+		if t.Err != nil {
+			record.Error = t.Err.Error()
+			ts.logger.Printf("  -> FAILED: Disc %d Track %02d (%s, %s) after %d attempt(s): %v",
+				t.Disc, t.Track, t.Title, t.Profile, t.Attempts, t.Err)
+		}
+		run.Tracks = append(run.Tracks, record)
+	}
+	if resumed > 0 {
+		ts.logger.Printf("  -> Resumed %d track(s) completed before the last interruption.", resumed)
+	}
+	failed := len(result.Failed())
+	switch {
+	case err != nil:
+		run.Status = database.StatusFailed
+		run.Error = err.Error()
+	case len(result.Tracks) == 0:
+		run.Status = database.StatusFailed
+		run.Error = "no tracks were processed"
+	case failed == 0:
+		run.Status = database.StatusSucceeded
+	case ts.cfg.FailurePolicy == config.FailurePartial && result.Succeeded() > 0:
+		run.Status = database.StatusPartial
+	default:
+		run.Status = database.StatusFailed
+		run.Error = fmt.Sprintf("%d of %d track(s) failed", failed, len(result.Tracks))
+	}
+	return run
+}
+
+// stabilityCheck 保存一个目录在多次稳定性检查之间观察到的文件状态
+type stabilityCheck struct {
+	started    time.Time
+	files      map[string]fileInfo
+	quietSince map[string]time.Time // 每个文件最近一次被观察到变化的时间
+}
+
+// checkStability 对目录做一次文件稳定性检查，所有相关文件都在 StabilityQuietDuration 内没有变化时返回 true。
+// 检查之间的状态保存在 ts.stability 中，超过 StabilityMaxWait 仍不稳定时重新开始观察
+func (ts *TaskScheduler) checkStability(dir string) (bool, error) {
+	check, ok := ts.stability[dir]
+	if ok && time.Since(check.started) >= ts.cfg.StabilityMaxWait {
+		ts.logger.Printf("  -> Max wait time for stability exceeded for %s. Files still active within %v or new files appeared.", dir, ts.cfg.StabilityQuietDuration)
+		ok = false
+	}
+	if !ok {
+		ts.logger.Printf("  -> Waiting for files in %s to stabilize for %v...", dir, ts.cfg.StabilityQuietDuration)
+		check = &stabilityCheck{
+			started:    time.Now(),
+			files:      make(map[string]fileInfo),
+			quietSince: make(map[string]time.Time),
+		}
+		ts.stability[dir] = check
+	}
+	currentCheckTime := time.Now()
+	// 光盘子目录中的文件也属于这张专辑
+	dirs := append([]string{dir}, scanner.DiscDirs(dir)...)
+	allRelevantFilesQuiet := true
+	hasRelevantFiles := false
+	currentFileStates := make(map[string]fileInfo)
+scan:
+	for _, d := range dirs {
+		entries, err := os.ReadDir(d)
+		if err != nil && d != dir && os.IsNotExist(err) {
+			continue // 光盘子目录刚被移走，下一次检查时不再包含
+		} else if err != nil {
+			return false, err
+		}
 		for _, entry := range entries {
-			filePath := filepath.Join(dir, entry.Name())
+			filePath := filepath.Join(d, entry.Name())
 			if entry.IsDir() {
 				continue
 			}
@@ -171,57 +431,41 @@ func (ts *TaskScheduler) waitForFilesStability(dir string) bool {
 				ts.logger.Printf("ERROR: Error getting file info for %s: %v", filePath, err)
 				allRelevantFilesQuiet = false
 				hasRelevantFiles = true
-				break
+				break scan
 			}
-			//ext := strings.ToLower(filepath.Ext(entry.Name()))
 			// 统一使用 util.IsRelevantMusicFile 辅助函数
 			if util.IsRelevantMusicFile(filePath) {
 				hasRelevantFiles = true
 				currentFileStates[filePath] = fileInfo{Size: info.Size(), ModTime: info.ModTime()}
-				prevInfo, exists := previousFileStates[filePath]
-				fileChanged := false
-				if exists && (prevInfo.Size != info.Size() || !prevInfo.ModTime.Equal(info.ModTime())) {
-					fileChanged = true
-				} else if !exists {
-					fileChanged = true
-				}
-				if fileChanged {
-					fileQuietTimes[filePath] = currentCheckTime
+				prevInfo, exists := check.files[filePath]
+				if !exists || prevInfo.Size != info.Size() || !prevInfo.ModTime.Equal(info.ModTime()) {
+					check.quietSince[filePath] = currentCheckTime
+					allRelevantFilesQuiet = false
+				} else if currentCheckTime.Sub(check.quietSince[filePath]) < ts.cfg.StabilityQuietDuration {
 					allRelevantFilesQuiet = false
-				} else {
-					lastChangeTime := fileQuietTimes[filePath]
-					if lastChangeTime.IsZero() {
-						fileQuietTimes[filePath] = currentCheckTime
-						allRelevantFilesQuiet = false
-					} else if currentCheckTime.Sub(lastChangeTime) < ts.cfg.StabilityQuietDuration {
-						allRelevantFilesQuiet = false
-					}
 				}
 			}
 		}
-		previousFileStates = currentFileStates
-		if !hasRelevantFiles {
-			ts.logger.Printf("  -> No relevant files found in %s that require stability check. Proceeding.", dir)
-			return true
-		}
-		allCurrentlyQuiet := true
-		for filePath, lastChangeTime := range fileQuietTimes {
-			if _, exists := currentFileStates[filePath]; !exists { // 文件被删除
-				continue
-			}
-			if currentCheckTime.Sub(lastChangeTime) < ts.cfg.StabilityQuietDuration {
-				allCurrentlyQuiet = false
-				break
-			}
+	}
+	check.files = currentFileStates
+	if !hasRelevantFiles {
+		ts.logger.Printf("  -> No relevant files found in %s that require stability check. Proceeding.", dir)
+		return true, nil
+	}
+	for filePath, lastChangeTime := range check.quietSince {
+		if _, exists := currentFileStates[filePath]; !exists { // 文件被删除
+			delete(check.quietSince, filePath)
+			continue
 		}
-		if allRelevantFilesQuiet && allCurrentlyQuiet {
-			ts.logger.Printf("  -> All relevant files in %s are stable for at least %v.", dir, ts.cfg.StabilityQuietDuration)
-			return true
+		if currentCheckTime.Sub(lastChangeTime) < ts.cfg.StabilityQuietDuration {
+			allRelevantFilesQuiet = false
 		}
-		time.Sleep(ts.cfg.StabilityCheckInterval)
 	}
-	ts.logger.Printf("  -> Max wait time for stability exceeded for %s. Files still active within %v or new files appeared.", dir, ts.cfg.StabilityQuietDuration)
-	return false
+	if allRelevantFilesQuiet {
+		ts.logger.Printf("  -> All relevant files in %s are stable for at least %v.", dir, ts.cfg.StabilityQuietDuration)
+		return true, nil
+	}
+	return false, nil
 }
 
 // fileInfo struct 用于存储文件的关键信息 (可移到 util 包)
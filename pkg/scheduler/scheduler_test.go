@@ -0,0 +1,187 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yleoer/music/pkg/album"
+	"github.com/yleoer/music/pkg/config"
+	"github.com/yleoer/music/pkg/database"
+	"github.com/yleoer/music/pkg/pathsafe"
+	"github.com/yleoer/music/pkg/retry"
+)
+
+// fakeFetcher 按顺序返回 errs 中的错误，用完后返回 nil
+type fakeFetcher struct {
+	errs  []error
+	calls int
+}
+
+func (f *fakeFetcher) FetchMetadataAndUpdateTrack(context.Context, *album.Track) error {
+	f.calls++
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func testAlbum(tracks int) *album.Album {
+	disc := &album.Disc{DiscNumber: 1}
+	for i := 0; i < tracks; i++ {
+		disc.Tracks = append(disc.Tracks, &album.Track{Number: i + 1})
+	}
+	return &album.Album{Artist: "Artist", Title: "Album", Discs: []*album.Disc{disc}}
+}
+
+func TestFetchMetadataPausesOnTransientError(t *testing.T) {
+	fetcher := &fakeFetcher{errs: []error{nil, retry.Transient(errors.New("HTTP 503"))}}
+	ts := &TaskScheduler{
+		cfg:         &config.Config{RetryBaseDelay: time.Hour, RetryMaxDelay: 4 * time.Hour},
+		metaFetcher: fetcher,
+		logger:      log.New(io.Discard, "", 0),
+	}
+	ts.fetchMetadata(context.Background(), testAlbum(5))
+	if fetcher.calls != 2 {
+		t.Errorf("%d lookup(s) after the service became unavailable, want 2", fetcher.calls)
+	}
+	// 暂停期间的专辑不再查询
+	ts.fetchMetadata(context.Background(), testAlbum(3))
+	if fetcher.calls != 2 {
+		t.Errorf("%d lookup(s) while paused, want 2", fetcher.calls)
+	}
+	if until, paused := ts.metadataPaused(); !paused || time.Until(until) < 30*time.Minute {
+		t.Errorf("lookups paused until %v, want about an hour", until)
+	}
+
+	// 暂停结束后重试，成功的查询清除失败计数
+	ts.metaPaused = time.Time{}
+	ts.fetchMetadata(context.Background(), testAlbum(3))
+	if fetcher.calls != 5 || ts.metaFailures != 0 {
+		t.Errorf("after pause: %d lookup(s), %d failure(s), want 5 and 0", fetcher.calls, ts.metaFailures)
+	}
+}
+
+func TestFetchMetadataIgnoresPermanentErrors(t *testing.T) {
+	fetcher := &fakeFetcher{errs: []error{errors.New("HTTP 404"), errors.New("bad response")}}
+	ts := &TaskScheduler{
+		cfg:         &config.Config{RetryBaseDelay: time.Hour, RetryMaxDelay: 4 * time.Hour},
+		metaFetcher: fetcher,
+		logger:      log.New(io.Discard, "", 0),
+	}
+	ts.fetchMetadata(context.Background(), testAlbum(4))
+	if fetcher.calls != 4 {
+		t.Errorf("%d lookup(s), want 4", fetcher.calls)
+	}
+	if _, paused := ts.metadataPaused(); paused {
+		t.Error("permanent errors paused metadata lookups")
+	}
+}
+
+// runRecorder 只实现 RecordAlbumRun，调用其他方法会 panic
+type runRecorder struct {
+	database.AlbumStore
+	runs []*database.AlbumRun
+}
+
+func (r *runRecorder) RecordAlbumRun(run *database.AlbumRun) error {
+	r.runs = append(r.runs, run)
+	return nil
+}
+
+func TestRejectAlbum(t *testing.T) {
+	reason := fmt.Errorf("track ../../etc/passwd: %w", pathsafe.ErrUnsafePath)
+	newAlbum := func(t *testing.T) string {
+		dir := filepath.Join(t.TempDir(), "Album")
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+
+	t.Run("quarantined", func(t *testing.T) {
+		dir, quarantine := newAlbum(t), t.TempDir()
+		store := &runRecorder{}
+		ts := &TaskScheduler{cfg: &config.Config{QuarantineDir: quarantine}, dbStore: store, logger: log.New(io.Discard, "", 0)}
+		if err := ts.rejectAlbum(dir, reason); !errors.Is(err, pathsafe.ErrUnsafePath) {
+			t.Errorf("rejectAlbum() = %v, want the rejection reason", err)
+		}
+		if _, err := os.Stat(filepath.Join(quarantine, "Album")); err != nil {
+			t.Errorf("album not moved to quarantine: %v", err)
+		}
+		if len(store.runs) != 1 || store.runs[0].Status != database.StatusRejected {
+			t.Errorf("recorded runs: %+v", store.runs)
+		}
+	})
+
+	t.Run("quarantine fails", func(t *testing.T) {
+		dir := newAlbum(t)
+		store := &runRecorder{}
+		// 隔离目录不存在，移动失败，和跨文件系统 (EXDEV) 的情况一样
+		quarantine := filepath.Join(t.TempDir(), "missing")
+		ts := &TaskScheduler{cfg: &config.Config{QuarantineDir: quarantine}, dbStore: store, logger: log.New(io.Discard, "", 0)}
+		err := ts.rejectAlbum(dir, reason)
+		if !errors.Is(err, pathsafe.ErrUnsafePath) || retry.IsTransient(err) {
+			t.Errorf("rejectAlbum() = %v, want a permanent error wrapping the rejection reason", err)
+		}
+		if err == nil || !strings.Contains(err.Error(), "quarantine") {
+			t.Errorf("rejectAlbum() = %v, want it to mention the failed quarantine move", err)
+		}
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("album directory lost: %v", err)
+		}
+	})
+}
+
+// enqueueRecorder 记录 EnqueueJob 的调用，Job 总是返回没有任务
+type enqueueRecorder struct {
+	database.AlbumStore
+	enqueued []string
+}
+
+func (r *enqueueRecorder) Job(string) (*database.Job, error) {
+	return nil, nil
+}
+
+func (r *enqueueRecorder) EnqueueJob(path string, priority int, runAt time.Time) error {
+	r.enqueued = append(r.enqueued, path)
+	return nil
+}
+
+func TestTriggerScanDebounces(t *testing.T) {
+	store := &enqueueRecorder{}
+	ts := NewTaskScheduler(context.Background(), &config.Config{StabilityCheckInterval: time.Minute}, store, nil, nil, nil, log.New(io.Discard, "", 0))
+	for i := 0; i < 100; i++ {
+		ts.TriggerScan("/downloads/a")
+	}
+	ts.TriggerScan("/downloads/b")
+	if wait := ts.flushTriggered(); len(store.enqueued) != 0 || wait <= 0 || wait > watchDebounce {
+		t.Fatalf("flushTriggered() inside the window enqueued %v and waits %v", store.enqueued, wait)
+	}
+
+	// 窗口结束后每个目录只写入一次
+	ts.triggered["/downloads/a"] = time.Now().Add(-watchDebounce)
+	ts.flushTriggered()
+	if strings.Join(store.enqueued, ",") != "/downloads/a" {
+		t.Errorf("enqueued %v, want /downloads/a once", store.enqueued)
+	}
+	ts.triggered["/downloads/b"] = time.Now().Add(-watchDebounce)
+	if wait := ts.flushTriggered(); wait != idleWakeup || len(store.enqueued) != 2 {
+		t.Errorf("enqueued %v and waits %v, want both directories and idle", store.enqueued, wait)
+	}
+
+	// 之后的变化开始新的窗口
+	ts.TriggerScan("/downloads/a")
+	if _, ok := ts.triggered["/downloads/a"]; !ok {
+		t.Error("change after the window was dropped")
+	}
+}
@@ -0,0 +1,164 @@
+package sidecar
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/yleoer/music/pkg/album"
+)
+
+// jsonParser 解析发布组或下载工具附带的专辑 JSON。键名不区分大小写并忽略 "-"、"_" 和空格，
+// 因此既支持 {"artist", "album", "release_date", "tracks": [{"number", "title"}]} 这样的扁平格式，
+// 也支持 MusicBrainz 的 release JSON ("artist-credit"、"label-info"、"media")
+type jsonParser struct{}
+
+func (jsonParser) Accepts(fileName string) bool {
+	return matchFiles([]string{"*.json"}, fileName)
+}
+
+func (jsonParser) Parse(content string) *Info {
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(content), &raw); err != nil {
+		return nil
+	}
+	doc := normalizeKeys(raw)
+	// 专辑信息可能嵌套在 "album" 或 "release" 对象中
+	for _, key := range []string{"album", "release"} {
+		if nested, ok := doc[key].(map[string]any); ok {
+			doc = normalizeKeys(nested)
+			break
+		}
+	}
+	info := &Info{
+		Artist:  jsonString(doc, "albumartist", "artist", "artists", "artistcredit"),
+		Album:   jsonString(doc, "album", "title", "name"),
+		Year:    jsonString(doc, "year"),
+		Date:    jsonString(doc, "releasedate", "date", "released"),
+		Label:   jsonString(doc, "label", "labels", "recordlabel", "publisher"),
+		Catalog: jsonString(doc, "catalognumber", "catalog", "catno"),
+		Genre:   jsonString(doc, "genre", "genres", "style", "styles"),
+		Tracks:  jsonTracks(doc),
+	}
+	if infos, ok := doc["labelinfo"].([]any); ok && len(infos) > 0 {
+		if first, ok := infos[0].(map[string]any); ok {
+			first = normalizeKeys(first)
+			if info.Label == "" {
+				info.Label = jsonString(first, "label")
+			}
+			if info.Catalog == "" {
+				info.Catalog = jsonString(first, "catalognumber")
+			}
+		}
+	}
+	info.normalize()
+	if info.Empty() {
+		return nil
+	}
+	return info
+}
+
+// jsonTracks 读取 "tracks" 曲目表，或 MusicBrainz 按光盘分组的 "media"
+func jsonTracks(doc map[string]any) []album.TracklistEntry {
+	if media, ok := doc["media"].([]any); ok {
+		var tracks []album.TracklistEntry
+		for i, m := range media {
+			medium, ok := m.(map[string]any)
+			if !ok {
+				continue
+			}
+			medium = normalizeKeys(medium)
+			disc, _ := strconv.Atoi(jsonString(medium, "position"))
+			if disc == 0 {
+				disc = i + 1
+			}
+			tracks = append(tracks, jsonTrackList(medium["tracks"], disc)...)
+		}
+		return tracks
+	}
+	for _, key := range []string{"tracks", "tracklist", "songs"} {
+		if list, ok := doc[key]; ok {
+			return jsonTrackList(list, 0)
+		}
+	}
+	return nil
+}
+
+// jsonTrackList 读取曲目数组，缺少编号的曲目按数组中的位置编号。编号为 "1-01" 时包含光盘编号
+func jsonTrackList(value any, disc int) []album.TracklistEntry {
+	list, ok := value.([]any)
+	if !ok {
+		return nil
+	}
+	var tracks []album.TracklistEntry
+	for i, item := range list {
+		obj, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		obj = normalizeKeys(obj)
+		entry := album.TracklistEntry{
+			Disc:   disc,
+			Title:  jsonString(obj, "title", "name"),
+			Artist: jsonString(obj, "artist", "artists", "artistcredit"),
+		}
+		position := jsonString(obj, "number", "tracknumber", "track", "position", "no")
+		if d, n, ok := strings.Cut(position, "-"); ok {
+			entry.Disc, _ = strconv.Atoi(strings.TrimSpace(d))
+			position = n
+		}
+		entry.Number, _ = strconv.Atoi(strings.TrimSpace(position))
+		if entry.Number <= 0 {
+			entry.Number = i + 1
+		}
+		if d, _ := strconv.Atoi(jsonString(obj, "disc", "discnumber", "disk")); d > 0 {
+			entry.Disc = d
+		}
+		if entry.Title != "" {
+			tracks = append(tracks, entry)
+		}
+	}
+	return tracks
+}
+
+// normalizeKeys 把对象的键转换为小写并去掉 "-"、"_" 和空格
+func normalizeKeys(obj map[string]any) map[string]any {
+	result := make(map[string]any, len(obj))
+	for k, v := range obj {
+		k = strings.NewReplacer("-", "", "_", "", " ", "").Replace(strings.ToLower(k))
+		if _, ok := result[k]; !ok {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// jsonString 返回第一个存在的键的文本值。数字转换为十进制文本，数组用 ", " 连接，对象取其 name 或 title
+func jsonString(obj map[string]any, keys ...string) string {
+	for _, key := range keys {
+		if s := jsonText(obj[key]); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+func jsonText(value any) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []any:
+		var parts []string
+		for _, item := range v {
+			if s := jsonText(item); s != "" {
+				parts = append(parts, s)
+			}
+		}
+		return strings.Join(parts, ", ")
+	case map[string]any:
+		return jsonString(normalizeKeys(v), "name", "title")
+	}
+	return ""
+}
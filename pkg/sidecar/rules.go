@@ -0,0 +1,177 @@
+package sidecar
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/yleoer/music/pkg/album"
+)
+
+// textFiles 是未指定 Files 的规则所处理的文件
+var textFiles = []string{"*.txt", "*.nfo"}
+
+// builtinFields 是内置文本规则的字段正则，兼顾国内发布组的 Info.txt 和英文 "Artist: / Album: / Year:" 格式，
+// 以及 scene NFO 中用点对齐的 "Label......: " 格式
+var builtinFields = map[string][]string{
+	"artist": {
+		fieldPattern(`专辑艺人|專輯藝人|专辑艺术家|專輯藝術家|album ?artist`), // 合辑中的专辑艺术家优先于 "Artist:"
+		fieldPattern(`歌手|艺人|藝人|演唱者?|艺术家|藝術家|artist|performer`),
+		`^[ \t]*([^\n《]+?)[ \t]*《`, // 第一行 "刘德华《笨小孩 1993-1998 国语精选》专辑简介"
+	},
+	"album": {
+		fieldPattern(`专辑名称|專輯名稱|专辑名|專輯名|专辑|專輯|album title|album|title`),
+		`^[^\n《]*《([^》\n]+)》`,
+	},
+	"year":    {fieldPattern(`年份|年代|year`)},
+	"date":    {fieldPattern(`出版日期|出版时间|出版時間|发行日期|發行日期|发行时间|發行時間|release date|rel(?:ease)?[ .]?date|released|date`)},
+	"label":   {fieldPattern(`唱片公司|发行公司|發行公司|出版公司|出版社|厂牌|廠牌|(?:record )?label|publisher`)},
+	"catalog": {fieldPattern(`唱片编号|唱片編號|专辑编号|專輯編號|碟号|碟號|编号|編號|cat(?:alog(?:ue)?)?(?:[ .]*(?:no|number|#))?`)},
+	"genre":   {fieldPattern(`流派|风格|風格|曲风|曲風|genre|style`)},
+}
+
+const (
+	// builtinTrackSection 是曲目表的标题行，只在其后查找曲目，避免把简介中的编号段落当作曲目
+	builtinTrackSection = `(?im)^.*(?:曲目|歌曲列表|track ?list(?:ing)?|tracks)[^\n]*$`
+	// builtinTrack 匹配 "01. 标题"、"1-01 标题 4:32"、"01 - Title (04:32)" 形式的曲目行
+	builtinTrack = `(?m)^[ \t]*(?:(?P<disc>\d{1,2})[-.])?(?P<number>\d{1,3})[ \t]*(?:[.)、:：-]|[ \t])[ \t]*(?P<title>[^\n]+?)[ \t]*(?:[(\[]?\d{1,2}:\d{2}(?::\d{2})?[)\]]?)?[ \t│║|*]*$`
+)
+
+// fieldPattern 构造匹配 "键: 值" 行的正则：键前可以有边框字符，键后可以有用于对齐的点或空格，冒号可以是全角
+func fieldPattern(keys string) string {
+	return `(?im)^[^\p{L}\p{N}\n]*(?:` + keys + `)[ \t.]*[:：][ \t]*(.+?)[ \t│║|*]*$`
+}
+
+// builtinParsers 返回内置的解析器
+func builtinParsers() Parsers {
+	text, err := newRuleParser(nil, builtinFields, builtinTrack, builtinTrackSection)
+	if err != nil {
+		panic(err) // 内置规则是常量，出错说明代码有误
+	}
+	return Parsers{text, jsonParser{}}
+}
+
+// ruleParser 按正则规则从文本文件中提取字段和曲目表
+type ruleParser struct {
+	files        []string
+	fields       map[string][]*regexp.Regexp
+	track        *regexp.Regexp
+	trackSection *regexp.Regexp
+}
+
+func newRuleParser(files []string, fields map[string][]string, track, trackSection string) (*ruleParser, error) {
+	if len(files) == 0 {
+		files = textFiles
+	}
+	for _, pattern := range files {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid file pattern %q: %w", pattern, err)
+		}
+	}
+	p := &ruleParser{files: files, fields: make(map[string][]*regexp.Regexp)}
+	for field, patterns := range fields {
+		if !isField(field) {
+			return nil, fmt.Errorf("unknown field %q, expected artist, album, year, date, label, catalog or genre", field)
+		}
+		for _, pattern := range patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern for %s: %w", field, err)
+			}
+			if re.NumSubexp() < 1 {
+				return nil, fmt.Errorf("pattern %q for %s has no capture group", pattern, field)
+			}
+			p.fields[field] = append(p.fields[field], re)
+		}
+	}
+	if track != "" {
+		re, err := regexp.Compile(track)
+		if err != nil {
+			return nil, fmt.Errorf("invalid track pattern: %w", err)
+		}
+		if re.SubexpIndex("number") < 0 || re.SubexpIndex("title") < 0 {
+			return nil, fmt.Errorf("track pattern %q must have named groups number and title", track)
+		}
+		p.track = re
+	}
+	if trackSection != "" {
+		re, err := regexp.Compile(trackSection)
+		if err != nil {
+			return nil, fmt.Errorf("invalid track section pattern: %w", err)
+		}
+		p.trackSection = re
+	}
+	return p, nil
+}
+
+func isField(field string) bool {
+	switch field {
+	case "artist", "album", "year", "date", "label", "catalog", "genre":
+		return true
+	}
+	return false
+}
+
+func (p *ruleParser) Accepts(fileName string) bool {
+	return matchFiles(p.files, fileName)
+}
+
+func (p *ruleParser) Parse(content string) *Info {
+	info := &Info{}
+	targets := map[string]*string{
+		"artist":  &info.Artist,
+		"album":   &info.Album,
+		"year":    &info.Year,
+		"date":    &info.Date,
+		"label":   &info.Label,
+		"catalog": &info.Catalog,
+		"genre":   &info.Genre,
+	}
+	for field, patterns := range p.fields {
+		for _, re := range patterns {
+			if m := re.FindStringSubmatch(content); m != nil && strings.TrimSpace(m[1]) != "" {
+				*targets[field] = m[1]
+				break
+			}
+		}
+	}
+	info.Tracks = p.parseTracks(content)
+	info.normalize()
+	if info.Empty() {
+		return nil
+	}
+	return info
+}
+
+// parseTracks 提取曲目表，设置了 trackSection 但没有匹配时不提取
+func (p *ruleParser) parseTracks(content string) []album.TracklistEntry {
+	if p.track == nil {
+		return nil
+	}
+	if p.trackSection != nil {
+		loc := p.trackSection.FindStringIndex(content)
+		if loc == nil {
+			return nil
+		}
+		content = content[loc[1]:]
+	}
+	group := func(m []string, name string) string {
+		if i := p.track.SubexpIndex(name); i >= 0 {
+			return strings.TrimSpace(m[i])
+		}
+		return ""
+	}
+	var tracks []album.TracklistEntry
+	for _, m := range p.track.FindAllStringSubmatch(content, -1) {
+		number, _ := strconv.Atoi(group(m, "number"))
+		title := group(m, "title")
+		if number <= 0 || title == "" {
+			continue
+		}
+		disc, _ := strconv.Atoi(group(m, "disc"))
+		tracks = append(tracks, album.TracklistEntry{Disc: disc, Number: number, Artist: group(m, "artist"), Title: title})
+	}
+	return tracks
+}
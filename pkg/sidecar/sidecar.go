@@ -0,0 +1,138 @@
+package sidecar
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/yleoer/music/pkg/album"
+	"github.com/yleoer/music/pkg/config"
+)
+
+// yearPattern 匹配日期中的四位年份，如 "1998年5月1日"、"1998-05-01"、"May 1, 1998"
+var yearPattern = regexp.MustCompile(`(?:^|\D)((?:19|20)\d{2})(?:\D|$)`)
+
+// Info 是从旁注文件中提取的专辑信息，未提取到的字段为零值
+type Info struct {
+	Artist  string
+	Album   string
+	Year    string
+	Date    string // 发行日期，保留原文
+	Label   string
+	Catalog string
+	Genre   string
+	Tracks  []album.TracklistEntry
+}
+
+// Empty 判断是否没有提取到任何信息
+func (i *Info) Empty() bool {
+	return i.Artist == "" && i.Album == "" && i.Year == "" && i.Date == "" &&
+		i.Label == "" && i.Catalog == "" && i.Genre == "" && len(i.Tracks) == 0
+}
+
+// Merge 用 other 补全 i 中为空的字段，曲目表只在 i 没有曲目时整体采用
+func (i *Info) Merge(other *Info) {
+	fill := func(dst *string, src string) {
+		if *dst == "" {
+			*dst = src
+		}
+	}
+	fill(&i.Artist, other.Artist)
+	fill(&i.Album, other.Album)
+	fill(&i.Year, other.Year)
+	fill(&i.Date, other.Date)
+	fill(&i.Label, other.Label)
+	fill(&i.Catalog, other.Catalog)
+	fill(&i.Genre, other.Genre)
+	if len(i.Tracks) == 0 {
+		i.Tracks = other.Tracks
+	}
+}
+
+// normalize 清理字段值，并把年份统一为四位数字 (没有年份时取自发行日期)
+func (i *Info) normalize() {
+	for _, v := range []*string{&i.Artist, &i.Album, &i.Year, &i.Date, &i.Label, &i.Catalog, &i.Genre} {
+		*v = strings.TrimSpace(*v)
+	}
+	i.Year = yearFromDate(i.Year)
+	if i.Year == "" {
+		i.Year = yearFromDate(i.Date)
+	}
+}
+
+// yearFromDate 返回日期中的四位年份，没有时返回空字符串
+func yearFromDate(date string) string {
+	if m := yearPattern.FindStringSubmatch(date); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// Parser 从一种旁注文件中提取专辑信息
+type Parser interface {
+	// Accepts 判断是否处理该文件名 (不含目录) 的文件
+	Accepts(fileName string) bool
+	// Parse 解析文件内容，无法识别时返回 nil
+	Parse(content string) *Info
+}
+
+// Parsers 是按优先级排列的一组解析器
+type Parsers []Parser
+
+// NewParsers 创建解析器：用户定义的规则在前，之后是内置的 Info.txt/NFO 文本规则和 JSON 解析器。
+// 规则中的字段名、通配符或正则表达式无效时返回错误
+func NewParsers(rules []config.SidecarRule) (Parsers, error) {
+	var parsers Parsers
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("rule %d", i+1)
+		}
+		p, err := newRuleParser(rule.Files, rule.Fields, rule.Track, rule.TrackSection)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sidecar rule %q: %w", name, err)
+		}
+		parsers = append(parsers, p)
+	}
+	return append(parsers, builtinParsers()...), nil
+}
+
+// Accepts 判断是否有解析器处理该文件名的文件
+func (ps Parsers) Accepts(fileName string) bool {
+	for _, p := range ps {
+		if p.Accepts(fileName) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse 用所有接受该文件的解析器解析内容，靠前的解析器提取的字段优先。没有提取到任何信息时返回 nil
+func (ps Parsers) Parse(fileName, content string) *Info {
+	content = strings.TrimPrefix(strings.ReplaceAll(content, "\r\n", "\n"), "\ufeff")
+	result := &Info{}
+	for _, p := range ps {
+		if !p.Accepts(fileName) {
+			continue
+		}
+		if info := p.Parse(content); info != nil {
+			result.Merge(info)
+		}
+	}
+	if result.Empty() {
+		return nil
+	}
+	return result
+}
+
+// matchFiles 判断文件名是否匹配任一通配符，不区分大小写
+func matchFiles(patterns []string, fileName string) bool {
+	fileName = strings.ToLower(fileName)
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(strings.ToLower(pattern), fileName); ok {
+			return true
+		}
+	}
+	return false
+}
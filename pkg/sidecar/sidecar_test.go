@@ -0,0 +1,219 @@
+package sidecar
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/yleoer/music/pkg/album"
+	"github.com/yleoer/music/pkg/config"
+)
+
+// newTestParsers 返回只有内置规则的解析器，内置正则无效时 NewParsers 会 panic
+func newTestParsers(t *testing.T) Parsers {
+	t.Helper()
+	ps, err := NewParsers(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ps
+}
+
+// checkInfo 比较专辑字段和曲目表
+func checkInfo(t *testing.T, name string, got, want *Info) {
+	t.Helper()
+	if got == nil {
+		t.Errorf("%s: Parse() = nil, want %+v", name, want)
+		return
+	}
+	gotFields := [...]string{got.Artist, got.Album, got.Year, got.Date, got.Label, got.Catalog, got.Genre}
+	wantFields := [...]string{want.Artist, want.Album, want.Year, want.Date, want.Label, want.Catalog, want.Genre}
+	if gotFields != wantFields {
+		t.Errorf("%s: artist, album, year, date, label, catalog, genre = %q, want %q", name, gotFields, wantFields)
+	}
+	if !reflect.DeepEqual(got.Tracks, want.Tracks) {
+		t.Errorf("%s: tracks = %+v, want %+v", name, got.Tracks, want.Tracks)
+	}
+}
+
+func TestParseInfoText(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		content  string
+		want     *Info
+	}{
+		{
+			name:     "chinese info",
+			fileName: "Info.txt",
+			content: "\ufeff刘德华《笨小孩 1993-1998 国语精选》专辑简介\r\n" +
+				"\r\n" +
+				"专辑名称：笨小孩 1993-1998 国语精选\r\n" +
+				"歌手：刘德华\r\n" +
+				"发行时间：1998年5月1日\r\n" +
+				"唱片公司：飞碟唱片\r\n" +
+				"唱片编号：UFO-98123\r\n" +
+				"流派：流行\r\n" +
+				"\r\n" +
+				"1. 本专辑收录了 1993 至 1998 年的作品\r\n" + // 简介中的编号段落不是曲目
+				"【曲目】\r\n" +
+				"01. 笨小孩 4:32\r\n" +
+				"02. 忘情水 (04:35)\r\n" +
+				"03、中国人\r\n",
+			want: &Info{
+				Artist: "刘德华", Album: "笨小孩 1993-1998 国语精选", Year: "1998", Date: "1998年5月1日",
+				Label: "飞碟唱片", Catalog: "UFO-98123", Genre: "流行",
+				Tracks: []album.TracklistEntry{
+					{Number: 1, Title: "笨小孩"},
+					{Number: 2, Title: "忘情水"},
+					{Number: 3, Title: "中国人"},
+				},
+			},
+		},
+		{
+			name:     "title line only",
+			fileName: "info.txt",
+			content:  "陈奕迅《U87》\n",
+			want:     &Info{Artist: "陈奕迅", Album: "U87"},
+		},
+		{
+			name:     "scene nfo",
+			fileName: "release.NFO",
+			content: "  ║ Album Artist..: Various Artists          ║\n" +
+				"  ║ Artist........: Someone                  ║\n" +
+				"  ║ Album.........: Greatest Hits            ║\n" +
+				"  ║ Rel.Date......: 2001-04-18               ║\n" +
+				"  ║ Label.........: Sony Music               ║\n" +
+				"  ║ Catalog No....: SICP-1234                ║\n" +
+				"  ║ Genre.........: J-Pop                    ║\n" +
+				"\n" +
+				"Tracklist:\n" +
+				"1-01 - First Song (03:12)\n" +
+				"1-02 - Second Song (04:01)\n" +
+				"2-01 - Third Song 5:00\n",
+			want: &Info{
+				Artist: "Various Artists", Album: "Greatest Hits", Year: "2001", Date: "2001-04-18",
+				Label: "Sony Music", Catalog: "SICP-1234", Genre: "J-Pop",
+				Tracks: []album.TracklistEntry{
+					{Disc: 1, Number: 1, Title: "First Song"},
+					{Disc: 1, Number: 2, Title: "Second Song"},
+					{Disc: 2, Number: 1, Title: "Third Song"},
+				},
+			},
+		},
+	}
+	ps := newTestParsers(t)
+	for _, tt := range tests {
+		checkInfo(t, tt.name, ps.Parse(tt.fileName, tt.content), tt.want)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *Info
+	}{
+		{
+			name: "flat",
+			content: `{
+				"artist": "Artist", "album": "Album", "release_date": "2005-03-09",
+				"label": "Label", "catalog_number": "CAT-001", "genre": ["Rock", "Pop"],
+				"tracks": [
+					{"number": "1", "title": "One"},
+					{"title": "Two", "artist": "Guest"},
+					{"track": "2-03", "title": "Three"},
+					{"number": 4}
+				]
+			}`,
+			want: &Info{
+				Artist: "Artist", Album: "Album", Year: "2005", Date: "2005-03-09",
+				Label: "Label", Catalog: "CAT-001", Genre: "Rock, Pop",
+				Tracks: []album.TracklistEntry{
+					{Number: 1, Title: "One"},
+					{Number: 2, Title: "Two", Artist: "Guest"},
+					{Disc: 2, Number: 3, Title: "Three"},
+				},
+			},
+		},
+		{
+			name:    "nested album",
+			content: `{"source": "web", "album": {"Album Artist": "Artist", "Title": "Album", "Year": 1999}}`,
+			want:    &Info{Artist: "Artist", Album: "Album", Year: "1999"},
+		},
+		{
+			name: "musicbrainz release",
+			content: `{
+				"id": "0a1b2c3d", "title": "Abbey Road", "date": "1969-09-26", "status": "Official",
+				"artist-credit": [{"name": "The Beatles", "joinphrase": "", "artist": {"name": "The Beatles", "sort-name": "Beatles, The"}}],
+				"label-info": [{"catalog-number": "PCS 7088", "label": {"name": "Apple Records"}}],
+				"media": [
+					{"position": 1, "format": "CD", "tracks": [
+						{"position": 1, "number": "1", "title": "Come Together"},
+						{"position": 2, "number": "2", "title": "Something",
+						 "artist-credit": [{"name": "George Harrison"}]}
+					]},
+					{"position": 2, "format": "CD", "tracks": [
+						{"position": 1, "number": "1", "title": "Here Comes the Sun"}
+					]}
+				]
+			}`,
+			want: &Info{
+				Artist: "The Beatles", Album: "Abbey Road", Year: "1969", Date: "1969-09-26",
+				Label: "Apple Records", Catalog: "PCS 7088",
+				Tracks: []album.TracklistEntry{
+					{Disc: 1, Number: 1, Title: "Come Together"},
+					{Disc: 1, Number: 2, Title: "Something", Artist: "George Harrison"},
+					{Disc: 2, Number: 1, Title: "Here Comes the Sun"},
+				},
+			},
+		},
+	}
+	ps := newTestParsers(t)
+	for _, tt := range tests {
+		checkInfo(t, tt.name, ps.Parse("album.json", tt.content), tt.want)
+	}
+	for _, content := range []string{"", "not json", "[1, 2]", `{"unrelated": true}`} {
+		if info := ps.Parse("album.json", content); info != nil {
+			t.Errorf("Parse(%q) = %+v, want nil", content, info)
+		}
+	}
+}
+
+func TestUserRulesTakePriority(t *testing.T) {
+	ps, err := NewParsers([]config.SidecarRule{{
+		Name:   "equals",
+		Fields: map[string][]string{"album": {`(?m)^Name = (.+)$`}},
+		Track:  `(?m)^#(?P<number>\d+) (?P<title>.+?) / (?P<artist>.+)$`,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := "Name = From Rule\nAlbum: From Builtin\nArtist: Someone\n#1 Song / Guest\n"
+	want := &Info{
+		Artist: "Someone", Album: "From Rule",
+		Tracks: []album.TracklistEntry{{Number: 1, Title: "Song", Artist: "Guest"}},
+	}
+	checkInfo(t, "user rule", ps.Parse("Info.txt", content), want)
+	if ps.Accepts("cover.jpg") || !ps.Accepts("INFO.TXT") || !ps.Accepts("release.json") {
+		t.Error("Accepts() does not match the default text and JSON files")
+	}
+}
+
+func TestNewParsersRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule config.SidecarRule
+	}{
+		{"unknown field", config.SidecarRule{Fields: map[string][]string{"composer": {`(.+)`}}}},
+		{"invalid pattern", config.SidecarRule{Fields: map[string][]string{"album": {`(`}}}},
+		{"no capture group", config.SidecarRule{Fields: map[string][]string{"album": {`Album: .+`}}}},
+		{"track without number", config.SidecarRule{Track: `(?P<title>.+)`}},
+		{"invalid track section", config.SidecarRule{Track: `(?P<number>\d+) (?P<title>.+)`, TrackSection: `[`}},
+		{"invalid file pattern", config.SidecarRule{Files: []string{"["}}},
+	}
+	for _, tt := range tests {
+		if _, err := NewParsers([]config.SidecarRule{tt.rule}); err == nil {
+			t.Errorf("%s: NewParsers() accepted %+v", tt.name, tt.rule)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package tag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	apeFooterSize = 32
+	id3v1Size     = 128
+)
+
+// ErrNoTag 表示文件中没有找到对应格式的标签
+var ErrNoTag = errors.New("no tag found")
+
+// APETag 是 APEv2 标签的内容 (APE、WavPack、TTA 等格式使用)
+type APETag struct {
+	Items  Tags              // 文本项
+	Binary map[string][]byte // 二进制项，如 "COVER ART (FRONT)"，键为大写
+}
+
+// ReadAPETag 从文件末尾读取 APEv2 标签，兼容其后跟随 ID3v1 标签的情况
+func ReadAPETag(path string) (*APETag, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	footer := make([]byte, apeFooterSize)
+	footerPos := int64(-1)
+	for _, trailing := range []int64{0, id3v1Size} {
+		pos := info.Size() - apeFooterSize - trailing
+		if pos < 0 {
+			continue
+		}
+		if _, err := f.ReadAt(footer, pos); err != nil {
+			return nil, fmt.Errorf("failed to read APE tag footer in %s: %w", path, err)
+		}
+		if string(footer[:8]) == "APETAGEX" {
+			footerPos = pos
+			break
+		}
+	}
+	if footerPos < 0 {
+		return nil, ErrNoTag
+	}
+
+	// footer: preamble(8) version(4) tagSize(4) itemCount(4) flags(4) reserved(8)，均为小端
+	tagSize := int64(binary.LittleEndian.Uint32(footer[12:16]))
+	itemCount := int(binary.LittleEndian.Uint32(footer[16:20]))
+	if tagSize < apeFooterSize || tagSize > footerPos+apeFooterSize {
+		return nil, fmt.Errorf("invalid APE tag size %d in %s", tagSize, path)
+	}
+	data := make([]byte, tagSize-apeFooterSize)
+	if _, err := f.ReadAt(data, footerPos+apeFooterSize-tagSize); err != nil {
+		return nil, fmt.Errorf("failed to read APE tag items in %s: %w", path, err)
+	}
+
+	tag := &APETag{Items: make(Tags), Binary: make(map[string][]byte)}
+	for i := 0; i < itemCount; i++ {
+		if len(data) < 8 {
+			return nil, fmt.Errorf("APE tag item truncated in %s: %w", path, io.ErrUnexpectedEOF)
+		}
+		size := int(binary.LittleEndian.Uint32(data[:4]))
+		flags := binary.LittleEndian.Uint32(data[4:8])
+		data = data[8:]
+		keyEnd := bytes.IndexByte(data, 0)
+		if keyEnd < 0 || size < 0 || len(data)-keyEnd-1 < size {
+			return nil, fmt.Errorf("APE tag item malformed in %s", path)
+		}
+		key := string(data[:keyEnd])
+		value := data[keyEnd+1 : keyEnd+1+size]
+		data = data[keyEnd+1+size:]
+
+		// flags 的第 1-2 位: 0 UTF-8 文本，1 二进制，2 外部链接
+		switch (flags >> 1) & 0x3 {
+		case 0:
+			// 多值文本项以 \0 分隔
+			for _, v := range bytes.Split(value, []byte{0}) {
+				tag.Items.add(key, string(v))
+			}
+		case 1:
+			tag.Binary[strings.ToUpper(key)] = value
+		}
+	}
+	return tag, nil
+}
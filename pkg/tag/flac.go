@@ -0,0 +1,268 @@
+package tag
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// FLAC 元数据块类型
+const (
+	flacBlockStreamInfo    = 0
+	flacBlockVorbisComment = 4
+	flacBlockCueSheet      = 5
+	flacBlockPicture       = 6
+)
+
+// StreamInfo 对应 FLAC 的 STREAMINFO 块
+type StreamInfo struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+	TotalSamples  int64 // 每声道的采样数，0 表示未知
+}
+
+// CueSheetIndex 是 FLAC CUESHEET 块中的一个 INDEX 点
+type CueSheetIndex struct {
+	Number int
+	Offset uint64 // 相对于音轨起点的采样偏移
+}
+
+// CueSheetTrack 是 FLAC CUESHEET 块中的一个音轨
+type CueSheetTrack struct {
+	Number      int
+	Offset      uint64 // 相对于文件起点的采样偏移
+	ISRC        string
+	IsAudio     bool
+	PreEmphasis bool
+	Indexes     []CueSheetIndex
+}
+
+// CueSheetBlock 对应 FLAC 的 CUESHEET 元数据块，最后一个音轨是 lead-out
+type CueSheetBlock struct {
+	CatalogNumber string
+	LeadInSamples uint64
+	IsCD          bool
+	Tracks        []CueSheetTrack
+}
+
+// Picture 是文件中内嵌的图片
+type Picture struct {
+	Type     int // ID3v2 APIC 图片类型，3 为封面
+	MIMEType string
+	Data     []byte
+}
+
+// FLACMetadata 是从 FLAC 文件头部读取的元数据
+type FLACMetadata struct {
+	StreamInfo StreamInfo
+	Comments   Tags           // VORBIS_COMMENT 中的标签
+	CueSheet   *CueSheetBlock // CUESHEET 块，不存在时为 nil
+	Pictures   []Picture      // PICTURE 块，按出现顺序
+}
+
+// ReadFLACMetadata 读取 FLAC 文件的元数据块，遇到音频帧前停止
+func ReadFLACMetadata(path string) (*FLACMetadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	if err := skipID3v2(r); err != nil {
+		return nil, fmt.Errorf("failed to skip ID3v2 tag in %s: %w", path, err)
+	}
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != "fLaC" {
+		return nil, fmt.Errorf("%s is not a FLAC file", path)
+	}
+
+	meta := &FLACMetadata{Comments: make(Tags)}
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, fmt.Errorf("failed to read FLAC metadata block header in %s: %w", path, err)
+		}
+		isLast := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("failed to read FLAC metadata block in %s: %w", path, err)
+		}
+		switch blockType {
+		case flacBlockStreamInfo:
+			meta.StreamInfo, err = parseStreamInfo(data)
+		case flacBlockVorbisComment:
+			err = parseVorbisComment(data, meta.Comments)
+		case flacBlockCueSheet:
+			meta.CueSheet, err = parseFLACCueSheet(data)
+		case flacBlockPicture:
+			var pic Picture
+			if pic, err = parseFLACPicture(data); err == nil {
+				meta.Pictures = append(meta.Pictures, pic)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("malformed FLAC metadata block %d in %s: %w", blockType, path, err)
+		}
+		if isLast {
+			return meta, nil
+		}
+	}
+}
+
+// skipID3v2 跳过部分编码器写在 FLAC 头部之前的 ID3v2 标签
+func skipID3v2(r *bufio.Reader) error {
+	header, err := r.Peek(10)
+	if err != nil || string(header[:3]) != "ID3" {
+		return nil
+	}
+	size := int(header[6])<<21 | int(header[7])<<14 | int(header[8])<<7 | int(header[9])
+	if header[5]&0x10 != 0 { // 存在 footer
+		size += 10
+	}
+	_, err = r.Discard(10 + size)
+	return err
+}
+
+func parseStreamInfo(data []byte) (StreamInfo, error) {
+	if len(data) < 18 {
+		return StreamInfo{}, errors.New("STREAMINFO too short")
+	}
+	// 字节 10 起: 采样率 20 bit、声道数-1 3 bit、位深-1 5 bit、总采样数 36 bit
+	bits := binary.BigEndian.Uint64(data[10:18])
+	return StreamInfo{
+		SampleRate:    int(bits >> 44),
+		Channels:      int(bits>>41&0x7) + 1,
+		BitsPerSample: int(bits>>36&0x1f) + 1,
+		TotalSamples:  int64(bits & 0xfffffffff),
+	}, nil
+}
+
+// parseVorbisComment 解析 Vorbis comment (小端长度前缀的 "KEY=value" 列表)
+func parseVorbisComment(data []byte, tags Tags) error {
+	readString := func() (string, error) {
+		if len(data) < 4 {
+			return "", io.ErrUnexpectedEOF
+		}
+		n := int(binary.LittleEndian.Uint32(data))
+		if n < 0 || len(data)-4 < n {
+			return "", io.ErrUnexpectedEOF
+		}
+		s := string(data[4 : 4+n])
+		data = data[4+n:]
+		return s, nil
+	}
+	if _, err := readString(); err != nil { // vendor string
+		return err
+	}
+	if len(data) < 4 {
+		return io.ErrUnexpectedEOF
+	}
+	count := int(binary.LittleEndian.Uint32(data))
+	data = data[4:]
+	for i := 0; i < count; i++ {
+		comment, err := readString()
+		if err != nil {
+			return err
+		}
+		if key, value, ok := strings.Cut(comment, "="); ok {
+			tags.add(key, value)
+		}
+	}
+	return nil
+}
+
+// parseFLACPicture 解析 PICTURE 块: 类型(4) MIME 长度(4) MIME 描述长度(4) 描述 宽高位深颜色数(16) 数据长度(4) 数据，均为大端
+func parseFLACPicture(data []byte) (Picture, error) {
+	readBytes := func(n int) ([]byte, error) {
+		if n < 0 || len(data) < n {
+			return nil, errors.New("PICTURE truncated")
+		}
+		b := data[:n]
+		data = data[n:]
+		return b, nil
+	}
+	readLength := func() (int, error) {
+		b, err := readBytes(4)
+		if err != nil {
+			return 0, err
+		}
+		return int(binary.BigEndian.Uint32(b)), nil
+	}
+	var pic Picture
+	var err error
+	if pic.Type, err = readLength(); err != nil {
+		return pic, err
+	}
+	for i := 0; i < 2; i++ { // MIME 和描述
+		n, err := readLength()
+		if err != nil {
+			return pic, err
+		}
+		b, err := readBytes(n)
+		if err != nil {
+			return pic, err
+		}
+		if i == 0 {
+			pic.MIMEType = string(b)
+		}
+	}
+	if _, err := readBytes(16); err != nil {
+		return pic, err
+	}
+	n, err := readLength()
+	if err != nil {
+		return pic, err
+	}
+	if pic.Data, err = readBytes(n); err != nil {
+		return pic, err
+	}
+	return pic, nil
+}
+
+// parseFLACCueSheet 解析 CUESHEET 块 (格式见 FLAC 规范 METADATA_BLOCK_CUESHEET)
+func parseFLACCueSheet(data []byte) (*CueSheetBlock, error) {
+	if len(data) < 396 {
+		return nil, errors.New("CUESHEET too short")
+	}
+	block := &CueSheetBlock{
+		CatalogNumber: strings.TrimRight(string(data[:128]), "\x00"),
+		LeadInSamples: binary.BigEndian.Uint64(data[128:136]),
+		IsCD:          data[136]&0x80 != 0,
+	}
+	numTracks := int(data[395])
+	data = data[396:]
+	for i := 0; i < numTracks; i++ {
+		if len(data) < 36 {
+			return nil, errors.New("CUESHEET track truncated")
+		}
+		track := CueSheetTrack{
+			Offset:      binary.BigEndian.Uint64(data[:8]),
+			Number:      int(data[8]),
+			ISRC:        strings.TrimRight(string(data[9:21]), "\x00"),
+			IsAudio:     data[21]&0x80 == 0,
+			PreEmphasis: data[21]&0x40 != 0,
+		}
+		numIndexes := int(data[35])
+		data = data[36:]
+		if len(data) < numIndexes*12 {
+			return nil, errors.New("CUESHEET index truncated")
+		}
+		for j := 0; j < numIndexes; j++ {
+			track.Indexes = append(track.Indexes, CueSheetIndex{
+				Offset: binary.BigEndian.Uint64(data[:8]),
+				Number: int(data[8]),
+			})
+			data = data[12:]
+		}
+		block.Tracks = append(block.Tracks, track)
+	}
+	return block, nil
+}
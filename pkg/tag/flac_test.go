@@ -0,0 +1,78 @@
+package tag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testFLACPicture 生成 PICTURE 块的内容
+func testFLACPicture(picType int, mimeType, description string, data []byte) []byte {
+	var b []byte
+	b = binary.BigEndian.AppendUint32(b, uint32(picType))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(mimeType)))
+	b = append(b, mimeType...)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(description)))
+	b = append(b, description...)
+	b = append(b, make([]byte, 16)...) // 宽、高、位深、颜色数
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	return append(b, data...)
+}
+
+func TestParseFLACPicture(t *testing.T) {
+	block := testFLACPicture(3, "image/png", "封面", []byte("\x89PNG data"))
+	pic, err := parseFLACPicture(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pic.Type != 3 || pic.MIMEType != "image/png" || string(pic.Data) != "\x89PNG data" {
+		t.Errorf("parseFLACPicture() = %+v", pic)
+	}
+	for n := 0; n < len(block); n++ {
+		if _, err := parseFLACPicture(block[:n]); err == nil {
+			t.Fatalf("parseFLACPicture accepted a block truncated to %d bytes", n)
+		}
+	}
+	// 数据长度超过块的剩余部分
+	bad := append([]byte{}, block...)
+	binary.BigEndian.PutUint32(bad[len(bad)-len("\x89PNG data")-4:], 0xFFFFFFFF)
+	if _, err := parseFLACPicture(bad); err == nil {
+		t.Error("parseFLACPicture accepted a data length beyond the block")
+	}
+}
+
+func TestReadEmbeddedCoverPrefersFront(t *testing.T) {
+	streamInfo := make([]byte, 34)
+	blocks := []struct {
+		typ  byte
+		data []byte
+	}{
+		{0, streamInfo},
+		{6, testFLACPicture(4, "image/jpeg", "", []byte("back"))},
+		{6, testFLACPicture(3, "image/jpeg", "", []byte("front"))},
+	}
+	var buf bytes.Buffer
+	buf.WriteString("fLaC")
+	for i, b := range blocks {
+		header := b.typ
+		if i == len(blocks)-1 {
+			header |= 0x80
+		}
+		buf.WriteByte(header)
+		buf.Write([]byte{byte(len(b.data) >> 16), byte(len(b.data) >> 8), byte(len(b.data))})
+		buf.Write(b.data)
+	}
+	path := filepath.Join(t.TempDir(), "image.flac")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ReadEmbeddedCover(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "front" {
+		t.Errorf("ReadEmbeddedCover() = %q, want the front cover", data)
+	}
+}
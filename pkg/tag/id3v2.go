@@ -0,0 +1,333 @@
+package tag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// maxID3v2Size 限制读入内存的 ID3v2 标签大小 (可能包含 APIC 封面)，避免损坏的文件导致分配过大的内存
+const maxID3v2Size = 64 << 20
+
+// id3Frames 将 ID3v2.3/2.4 的帧 ID 映射为 Vorbis comment 字段名，TXXX、COMM、USLT 单独处理
+var id3Frames = map[string]string{
+	"TIT2": "TITLE",
+	"TPE1": "ARTIST",
+	"TPE2": "ALBUMARTIST",
+	"TALB": "ALBUM",
+	"TDRC": "DATE",
+	"TYER": "DATE",
+	"TRCK": "TRACKNUMBER",
+	"TPOS": "DISCNUMBER",
+	"TCON": "GENRE",
+	"TCOM": "COMPOSER",
+	"TSRC": "ISRC",
+	"TPUB": "LABEL",
+}
+
+// id3v22Frames 将 ID3v2.2 的三字符帧 ID 映射为对应的 ID3v2.3 帧 ID
+var id3v22Frames = map[string]string{
+	"TT2": "TIT2",
+	"TP1": "TPE1",
+	"TP2": "TPE2",
+	"TAL": "TALB",
+	"TYE": "TYER",
+	"TRK": "TRCK",
+	"TPA": "TPOS",
+	"TCO": "TCON",
+	"TCM": "TCOM",
+	"TRC": "TSRC",
+	"TPB": "TPUB",
+	"TXX": "TXXX",
+	"COM": "COMM",
+	"ULT": "USLT",
+}
+
+// ReadID3v2 读取文件开头的 ID3v2 标签 (v2.2、v2.3、v2.4)，键使用 Vorbis comment 的字段名，没有标签时返回 ErrNoTag
+func ReadID3v2(path string) (Tags, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(f, header); err != nil || string(header[:3]) != "ID3" {
+		return nil, ErrNoTag
+	}
+	size := syncsafe(header[6:10])
+	if size > maxID3v2Size {
+		return nil, fmt.Errorf("ID3v2 tag in %s is too large (%d bytes)", path, size)
+	}
+	data := make([]byte, 10+size)
+	copy(data, header)
+	if _, err := io.ReadFull(f, data[10:]); err != nil {
+		return nil, fmt.Errorf("failed to read ID3v2 tag in %s: %w", path, err)
+	}
+	tags, err := parseID3v2(data)
+	if err != nil {
+		return nil, fmt.Errorf("malformed ID3v2 tag in %s: %w", path, err)
+	}
+	return tags, nil
+}
+
+// parseID3v2 解析以 10 字节头部开始的完整 ID3v2 标签。压缩或加密的帧被跳过
+func parseID3v2(data []byte) (Tags, error) {
+	if len(data) < 10 || string(data[:3]) != "ID3" {
+		return nil, ErrNoTag
+	}
+	version, flags := data[3], data[5]
+	if version < 2 || version > 4 {
+		return nil, fmt.Errorf("unsupported ID3v2 version 2.%d", version)
+	}
+	size := syncsafe(data[6:10])
+	if len(data)-10 < size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	body := data[10 : 10+size]
+	// v2.2/v2.3 的不同步处理作用于整个标签，v2.4 改为逐帧标记
+	if flags&0x80 != 0 && version < 4 {
+		body = removeUnsync(body)
+	}
+	if flags&0x40 != 0 && version > 2 { // 扩展头部
+		if len(body) < 4 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		extSize := int(binary.BigEndian.Uint32(body)) + 4 // v2.3 的长度不包含自身
+		if version == 4 {
+			extSize = syncsafe(body[:4])
+		}
+		if extSize > len(body) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		body = body[extSize:]
+	}
+
+	tags := make(Tags)
+	idLen, headerLen := 4, 10
+	if version == 2 {
+		idLen, headerLen = 3, 6
+	}
+	for len(body) >= headerLen && body[0] != 0 { // 0 开始的是填充
+		id := string(body[:idLen])
+		var frameSize int
+		var formatFlags byte
+		switch version {
+		case 2:
+			frameSize = int(body[3])<<16 | int(body[4])<<8 | int(body[5])
+		case 3:
+			frameSize = int(binary.BigEndian.Uint32(body[4:8]))
+			formatFlags = body[9]
+		default:
+			frameSize = syncsafe(body[4:8])
+			formatFlags = body[9]
+		}
+		if frameSize < 0 || len(body)-headerLen < frameSize {
+			return nil, fmt.Errorf("frame %s truncated", id)
+		}
+		frame := body[headerLen : headerLen+frameSize]
+		body = body[headerLen+frameSize:]
+		if version == 2 {
+			id = id3v22Frames[id]
+		}
+		switch {
+		case version == 3 && formatFlags&0xc0 != 0, version == 4 && formatFlags&0x0c != 0:
+			continue // 压缩或加密
+		case version == 4:
+			if formatFlags&0x01 != 0 { // 数据长度指示
+				if len(frame) < 4 {
+					continue
+				}
+				frame = frame[4:]
+			}
+			if formatFlags&0x02 != 0 {
+				frame = removeUnsync(frame)
+			}
+		}
+		addID3Frame(tags, id, frame)
+	}
+	return tags, nil
+}
+
+// addID3Frame 将一个帧的内容加入 tags，不认识的帧被忽略
+func addID3Frame(tags Tags, id string, frame []byte) {
+	if len(frame) < 1 {
+		return
+	}
+	encoding, payload := frame[0], frame[1:]
+	switch id {
+	case "TXXX": // 描述\0值，如 REPLAYGAIN_TRACK_GAIN
+		values := id3Strings(encoding, payload)
+		if len(values) >= 2 && values[0] != "" {
+			for _, v := range values[1:] {
+				tags.add(values[0], v)
+			}
+		}
+	case "COMM", "USLT": // 语言(3) 描述\0文本
+		if len(payload) < 3 {
+			return
+		}
+		values := id3Strings(encoding, payload[3:])
+		if len(values) < 2 || strings.HasPrefix(values[0], "iTun") { // 跳过 iTunNORM 等 iTunes 内部数据
+			return
+		}
+		name := "COMMENT"
+		if id == "USLT" {
+			name = "LYRICS"
+		}
+		tags.add(name, values[1])
+	default:
+		name, ok := id3Frames[id]
+		if !ok {
+			return
+		}
+		for _, v := range id3Strings(encoding, payload) {
+			if name == "GENRE" {
+				v = id3Genre(v)
+			}
+			if v != "" {
+				tags.add(name, v)
+			}
+		}
+	}
+}
+
+// id3Strings 按帧的文本编码解码以 \0 分隔的字符串
+func id3Strings(encoding byte, data []byte) []string {
+	var parts [][]byte
+	switch encoding {
+	case 1, 2: // UTF-16 (带 BOM)、UTF-16BE，结束符为两个字节的 0
+		for len(data) >= 2 {
+			end := 0
+			for end+1 < len(data) && (data[end] != 0 || data[end+1] != 0) {
+				end += 2
+			}
+			if end+1 >= len(data) {
+				parts = append(parts, data)
+				break
+			}
+			parts = append(parts, data[:end])
+			data = data[end+2:]
+		}
+	default:
+		parts = bytes.Split(bytes.TrimRight(data, "\x00"), []byte{0})
+	}
+	values := make([]string, 0, len(parts))
+	for _, p := range parts {
+		values = append(values, decodeID3Text(encoding, p))
+	}
+	return values
+}
+
+// decodeID3Text 将一段文本按编码转换为 UTF-8。标称 ISO-8859-1 的文本在中文资源中通常是 GBK，能按 GBK 完整解码时按 GBK 处理
+func decodeID3Text(encoding byte, data []byte) string {
+	switch encoding {
+	case 1, 2:
+		order := binary.ByteOrder(binary.BigEndian)
+		if len(data) >= 2 && data[0] == 0xff && data[1] == 0xfe {
+			order, data = binary.LittleEndian, data[2:]
+		} else if len(data) >= 2 && data[0] == 0xfe && data[1] == 0xff {
+			data = data[2:]
+		}
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			units[i] = order.Uint16(data[2*i:])
+		}
+		return string(utf16.Decode(units))
+	case 3:
+		return string(data)
+	default:
+		if utf8.Valid(data) { // 也覆盖纯 ASCII，部分工具会把 UTF-8 写为 ISO-8859-1
+			return string(data)
+		}
+		if decoded, err := simplifiedchinese.GBK.NewDecoder().Bytes(data); err == nil && !bytes.ContainsRune(decoded, utf8.RuneError) {
+			return string(decoded)
+		}
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	}
+}
+
+// id3Genre 去掉 ID3v1 风格的流派编号 "(17)Rock" 中的编号部分
+func id3Genre(v string) string {
+	if strings.HasPrefix(v, "(") {
+		if end := strings.IndexByte(v, ')'); end > 0 && end < len(v)-1 {
+			return v[end+1:]
+		}
+	}
+	return v
+}
+
+// removeUnsync 还原不同步处理：把 0xFF 0x00 还原为 0xFF
+func removeUnsync(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		out = append(out, data[i])
+		if data[i] == 0xff && i+1 < len(data) && data[i+1] == 0 {
+			i++
+		}
+	}
+	return out
+}
+
+// syncsafe 解析 4 字节的 syncsafe 整数 (每字节 7 位)
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// readChunkID3 在 WAV (RIFF，小端) 或 AIFF (FORM，大端) 文件的 "id3 " 块中读取 ID3v2 标签
+func readChunkID3(path string) (Tags, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return nil, ErrNoTag
+	}
+	var order binary.ByteOrder
+	switch string(header[:4]) {
+	case "RIFF":
+		order = binary.LittleEndian
+	case "FORM":
+		order = binary.BigEndian
+	default:
+		return nil, ErrNoTag
+	}
+	chunk := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(f, chunk); err != nil {
+			return nil, ErrNoTag
+		}
+		size := int64(order.Uint32(chunk[4:8]))
+		if id := strings.ToLower(string(chunk[:4])); id != "id3 " {
+			if _, err := f.Seek(size+size%2, io.SeekCurrent); err != nil { // 块按偶数字节对齐
+				return nil, ErrNoTag
+			}
+			continue
+		}
+		if size > maxID3v2Size {
+			return nil, fmt.Errorf("ID3 chunk in %s is too large (%d bytes)", path, size)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(f, data); err != nil {
+			return nil, fmt.Errorf("failed to read ID3 chunk in %s: %w", path, err)
+		}
+		tags, err := parseID3v2(data)
+		if err != nil && !errors.Is(err, ErrNoTag) {
+			return nil, fmt.Errorf("malformed ID3v2 tag in %s: %w", path, err)
+		}
+		return tags, err
+	}
+}
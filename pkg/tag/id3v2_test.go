@@ -0,0 +1,110 @@
+package tag
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testID3v2 生成一个包含 TIT2 和 TPE1 帧 (ISO-8859-1) 的 ID3v2.3 标签
+func testID3v2(title, artist string) []byte {
+	var body []byte
+	for _, f := range [][2]string{{"TIT2", title}, {"TPE1", artist}} {
+		body = append(body, f[0]...)
+		body = binary.BigEndian.AppendUint32(body, uint32(len(f[1])+1))
+		body = append(body, 0, 0, 0)
+		body = append(body, f[1]...)
+	}
+	n := len(body)
+	header := []byte{'I', 'D', '3', 3, 0, 0, byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+	return append(header, body...)
+}
+
+// testRIFF 按 chunks 的顺序 (块 ID、声明的长度、内容) 生成一个 WAV 文件
+func testRIFF(chunks ...riffChunk) []byte {
+	data := []byte("RIFF\x00\x00\x00\x00WAVE")
+	for _, c := range chunks {
+		data = append(data, c.id...)
+		data = binary.LittleEndian.AppendUint32(data, c.size)
+		data = append(data, c.data...)
+		if len(c.data)%2 == 1 {
+			data = append(data, 0)
+		}
+	}
+	binary.LittleEndian.PutUint32(data[4:8], uint32(len(data)-8))
+	return data
+}
+
+type riffChunk struct {
+	id   string
+	size uint32
+	data []byte
+}
+
+func chunk(id string, data []byte) riffChunk {
+	return riffChunk{id: id, size: uint32(len(data)), data: data}
+}
+
+func writeTestFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadTagsWAVChunk(t *testing.T) {
+	path := writeTestFile(t, "image.wav", testRIFF(
+		chunk("fmt ", make([]byte, 16)),
+		chunk("LIST", []byte("INFO\x00")), // 奇数长度，测试对齐
+		chunk("data", make([]byte, 400)),
+		chunk("id3 ", testID3v2("Album", "Artist")),
+	))
+	tags, err := ReadTags(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags.Get("TITLE") != "Album" || tags.Get("ARTIST") != "Artist" {
+		t.Errorf("tags = %v", tags)
+	}
+}
+
+func TestReadTagsOversizedHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		data    []byte
+		wantErr bool
+	}{
+		{
+			// data 块声明了 4 GiB，通过 Seek 跳过，不读入内存
+			name: "huge data chunk",
+			file: "image.wav",
+			data: testRIFF(chunk("fmt ", make([]byte, 16)), riffChunk{id: "data", size: 0xFFFFFFF0, data: make([]byte, 64)}),
+		},
+		{
+			name:    "huge id3 chunk",
+			file:    "image.wav",
+			data:    testRIFF(chunk("fmt ", make([]byte, 16)), riffChunk{id: "id3 ", size: 0xFFFFFFF0, data: testID3v2("A", "B")}),
+			wantErr: true,
+		},
+		{
+			name:    "huge ID3v2 tag",
+			file:    "track.mp3",
+			data:    append([]byte{'I', 'D', '3', 3, 0, 0, 0x7f, 0x7f, 0x7f, 0x7f}, make([]byte, 64)...),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		_, err := ReadTags(writeTestFile(t, tt.file, tt.data))
+		if tt.wantErr && (err == nil || errors.Is(err, ErrNoTag)) {
+			t.Errorf("%s: ReadTags() = %v, want an error", tt.name, err)
+		}
+		if !tt.wantErr && !errors.Is(err, ErrNoTag) {
+			t.Errorf("%s: ReadTags() = %v, want ErrNoTag", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package tag
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// mp4Atoms 将 iTunes 风格元数据 (moov/udta/meta/ilst) 的原子名映射为 Vorbis comment 字段名
+var mp4Atoms = map[string]string{
+	"\xa9nam": "TITLE",
+	"\xa9ART": "ARTIST",
+	"aART":    "ALBUMARTIST",
+	"\xa9alb": "ALBUM",
+	"\xa9day": "DATE",
+	"\xa9gen": "GENRE",
+	"\xa9wrt": "COMPOSER",
+	"\xa9cmt": "COMMENT",
+	"\xa9lyr": "LYRICS",
+	"trkn":    "TRACKNUMBER",
+	"disk":    "DISCNUMBER",
+}
+
+// maxMP4AtomSize 限制读入内存的元数据原子大小，避免损坏的文件导致分配过大的内存
+const maxMP4AtomSize = 64 << 20
+
+// ReadMP4Tags 读取 M4A/MP4 文件中 iTunes 风格的元数据，键使用 Vorbis comment 的字段名。
+// "----" 自定义项 (如 REPLAYGAIN_TRACK_GAIN、ISRC) 以其名称为键。没有元数据时返回 ErrNoTag
+func ReadMP4Tags(path string) (Tags, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	// moov 可能位于 mdat 之后，只读取路径上的原子
+	ilst, err := findMP4Atom(f, 0, info.Size(), []string{"moov", "udta", "meta", "ilst"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MP4 atoms in %s: %w", path, err)
+	}
+	if ilst == nil {
+		return nil, ErrNoTag
+	}
+	tags := make(Tags)
+	for _, item := range splitMP4Atoms(ilst) {
+		addMP4Item(tags, item.name, item.data)
+	}
+	return tags, nil
+}
+
+type mp4Atom struct {
+	name string
+	data []byte
+}
+
+// findMP4Atom 在 [offset, end) 中按 path 逐级查找原子，返回最后一级原子的内容，不存在时返回 nil
+func findMP4Atom(r io.ReaderAt, offset, end int64, path []string) ([]byte, error) {
+	header := make([]byte, 16)
+	for offset+8 <= end {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, err
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		name := string(header[4:8])
+		headerSize := int64(8)
+		switch size {
+		case 0: // 延伸到文件结尾
+			size = end - offset
+		case 1: // 64 位长度
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, err
+			}
+			size, headerSize = int64(binary.BigEndian.Uint64(header[8:16])), 16
+		}
+		if size < headerSize || offset+size > end {
+			return nil, fmt.Errorf("invalid size of atom %q", name)
+		}
+		if name != path[0] {
+			offset += size
+			continue
+		}
+		start := offset + headerSize
+		if name == "meta" { // meta 是 full box，内容前有 4 字节的版本和标志 (QuickTime 格式没有)
+			if _, err := r.ReadAt(header[:8], start); err != nil {
+				return nil, err
+			}
+			if string(header[4:8]) != "hdlr" {
+				start += 4
+			}
+		}
+		if len(path) > 1 {
+			return findMP4Atom(r, start, offset+size, path[1:])
+		}
+		if offset+size-start > maxMP4AtomSize {
+			return nil, fmt.Errorf("atom %q is too large", name)
+		}
+		data := make([]byte, offset+size-start)
+		if _, err := r.ReadAt(data, start); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+	return nil, nil
+}
+
+// splitMP4Atoms 将内存中的一段内容拆分为原子，遇到格式错误时停止
+func splitMP4Atoms(data []byte) []mp4Atom {
+	var atoms []mp4Atom
+	for len(data) >= 8 {
+		size := int(binary.BigEndian.Uint32(data[:4]))
+		if size < 8 || size > len(data) {
+			break
+		}
+		atoms = append(atoms, mp4Atom{name: string(data[4:8]), data: data[8:size]})
+		data = data[size:]
+	}
+	return atoms
+}
+
+// addMP4Item 解析 ilst 中的一项：data 原子的内容为 类型(4) 区域(4) 值
+func addMP4Item(tags Tags, name string, item []byte) {
+	key, ok := mp4Atoms[name]
+	for _, child := range splitMP4Atoms(item) {
+		switch {
+		case child.name == "name" && name == "----" && len(child.data) > 4:
+			key, ok = string(child.data[4:]), true // 自定义项的名称，前 4 字节为版本和标志
+		case child.name == "data" && ok && len(child.data) >= 8:
+			value := child.data[8:]
+			switch key {
+			case "TRACKNUMBER", "DISCNUMBER": // 二进制: 保留(2) 编号(2) 总数(2)
+				if len(value) < 6 {
+					continue
+				}
+				number, total := binary.BigEndian.Uint16(value[2:4]), binary.BigEndian.Uint16(value[4:6])
+				v := strconv.Itoa(int(number))
+				if total > 0 {
+					v += "/" + strconv.Itoa(int(total))
+				}
+				tags.add(key, v)
+			default:
+				if typ := binary.BigEndian.Uint32(child.data[:4]) & 0xffffff; typ == 1 { // UTF-8 文本
+					tags.add(key, string(value))
+				}
+			}
+		}
+	}
+}
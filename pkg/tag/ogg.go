@@ -0,0 +1,75 @@
+package tag
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// maxOggCommentSize 限制 Vorbis comment 包的大小，其中可能包含 METADATA_BLOCK_PICTURE 封面
+const maxOggCommentSize = 64 << 20
+
+// ReadOggTags 读取 Ogg Vorbis 或 Opus 文件的 Vorbis comment (第一个逻辑流的第二个包)，没有时返回 ErrNoTag
+func ReadOggTags(path string) (Tags, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	var packets [][]byte
+	var current []byte
+	var serial uint32
+	header := make([]byte, 27)
+	for page := 0; len(packets) < 2; page++ {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, fmt.Errorf("failed to read Ogg page in %s: %w", path, err)
+		}
+		if string(header[:4]) != "OggS" {
+			return nil, fmt.Errorf("%s is not an Ogg file", path)
+		}
+		lacing := make([]byte, header[26])
+		if _, err := io.ReadFull(r, lacing); err != nil {
+			return nil, fmt.Errorf("failed to read Ogg page in %s: %w", path, err)
+		}
+		pageSerial := binary.LittleEndian.Uint32(header[14:18])
+		if page == 0 {
+			serial = pageSerial
+		}
+		for _, size := range lacing {
+			segment := make([]byte, size)
+			if _, err := io.ReadFull(r, segment); err != nil {
+				return nil, fmt.Errorf("failed to read Ogg page in %s: %w", path, err)
+			}
+			if pageSerial != serial { // 复用的其他逻辑流
+				continue
+			}
+			current = append(current, segment...)
+			if len(current) > maxOggCommentSize {
+				return nil, fmt.Errorf("ogg comment packet in %s is too large", path)
+			}
+			if size < 255 { // 小于 255 的段结束一个包
+				packets = append(packets, current)
+				current = nil
+			}
+		}
+	}
+	comment := packets[1]
+	switch {
+	case bytes.HasPrefix(comment, []byte("\x03vorbis")):
+		comment = comment[7:]
+	case bytes.HasPrefix(comment, []byte("OpusTags")):
+		comment = comment[8:]
+	default:
+		return nil, ErrNoTag
+	}
+	tags := make(Tags)
+	if err := parseVorbisComment(comment, tags); err != nil {
+		return nil, fmt.Errorf("malformed Vorbis comment in %s: %w", path, err)
+	}
+	return tags, nil
+}
@@ -0,0 +1,155 @@
+package tag
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Tags 保存从音频文件中读取的文本标签，键统一为大写，同一个键可能有多个值
+type Tags map[string][]string
+
+// Get 返回键对应的第一个值，不存在时返回空字符串
+func (t Tags) Get(key string) string {
+	if values := t[strings.ToUpper(key)]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// add 追加一个标签值
+func (t Tags) add(key, value string) {
+	key = strings.ToUpper(key)
+	t[key] = append(t[key], value)
+}
+
+// tagAliases 将不同工具和 APEv2 中常见的字段名统一为 Vorbis comment 的字段名
+var tagAliases = map[string]string{
+	"TRACK":          "TRACKNUMBER",
+	"DISC":           "DISCNUMBER",
+	"YEAR":           "DATE",
+	"ALBUM ARTIST":   "ALBUMARTIST",
+	"UNSYNCEDLYRICS": "LYRICS",
+}
+
+// ReadTags 读取音频文件中的文本标签，键统一为 Vorbis comment 的字段名 (如 TITLE、TRACKNUMBER)。
+// 各格式读取的标签按优先级排列如下，同一个字段只取优先级最高的标签中的值:
+//
+//	.flac                 Vorbis comment、ID3v2
+//	.ogg .oga .opus       Vorbis comment
+//	.mp3 .aac             ID3v2、APEv2
+//	.ape .wv .tta .mpc    APEv2、ID3v2
+//	.m4a .mp4             iTunes 风格元数据
+//	.wav .aiff .aif       "id3 " 块中的 ID3v2
+//
+// 不支持的格式或没有任何标签时返回 ErrNoTag，只有所有标签都无法读取时才返回其他错误
+func ReadTags(path string) (Tags, error) {
+	var readers []func(string) (Tags, error)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".flac":
+		readers = append(readers, readFLACComments, ReadID3v2)
+	case ".ogg", ".oga", ".opus":
+		readers = append(readers, ReadOggTags)
+	case ".mp3", ".aac":
+		readers = append(readers, ReadID3v2, readAPEItems)
+	case ".ape", ".wv", ".tta", ".mpc":
+		readers = append(readers, readAPEItems, ReadID3v2)
+	case ".m4a", ".mp4":
+		readers = append(readers, ReadMP4Tags)
+	case ".wav", ".aiff", ".aif":
+		readers = append(readers, readChunkID3)
+	}
+	var result Tags
+	var firstErr error
+	for _, read := range readers {
+		tags, err := read(path)
+		if err != nil {
+			if !errors.Is(err, ErrNoTag) && firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if result == nil {
+			result = make(Tags)
+		}
+		for key, values := range tags {
+			if alias, ok := tagAliases[key]; ok {
+				key = alias
+			}
+			if _, exists := result[key]; !exists {
+				result[key] = values
+			}
+		}
+	}
+	if result == nil {
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		return nil, ErrNoTag
+	}
+	return result, nil
+}
+
+// readFLACComments 读取 FLAC 文件的 Vorbis comment
+func readFLACComments(path string) (Tags, error) {
+	meta, err := ReadFLACMetadata(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(meta.Comments) == 0 {
+		return nil, ErrNoTag
+	}
+	return meta.Comments, nil
+}
+
+// readAPEItems 读取 APEv2 标签中的文本项
+func readAPEItems(path string) (Tags, error) {
+	apeTag, err := ReadAPETag(path)
+	if err != nil {
+		return nil, err
+	}
+	return apeTag.Items, nil
+}
+
+// ReadEmbeddedCover 读取 FLAC 的 PICTURE 块或 APE/WavPack/TTA 的 APEv2 "Cover Art" 项中的封面图片，
+// 优先使用封面 (类型 3 或 "Cover Art (Front)")，没有时取第一张图片。没有内嵌图片时返回 ErrNoTag
+func ReadEmbeddedCover(path string) ([]byte, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".flac":
+		meta, err := ReadFLACMetadata(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, pic := range meta.Pictures {
+			if pic.Type == 3 && len(pic.Data) > 0 {
+				return pic.Data, nil
+			}
+		}
+		for _, pic := range meta.Pictures {
+			if len(pic.Data) > 0 {
+				return pic.Data, nil
+			}
+		}
+	case ".ape", ".wv", ".tta", ".mpc":
+		ape, err := ReadAPETag(path)
+		if err != nil {
+			return nil, err
+		}
+		keys := []string{"COVER ART (FRONT)"}
+		for key := range ape.Binary {
+			if strings.HasPrefix(key, "COVER ART") && key != keys[0] {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys[1:])
+		for _, key := range keys {
+			// 值为 文件名\0图片数据
+			if _, data, ok := bytes.Cut(ape.Binary[key], []byte{0}); ok && len(data) > 0 {
+				return data, nil
+			}
+		}
+	}
+	return nil, ErrNoTag
+}
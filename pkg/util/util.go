@@ -7,7 +7,6 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 	"unicode/utf8"
 
 	"golang.org/x/text/encoding/simplifiedchinese"
@@ -56,19 +55,6 @@ func SanitizeFileName(name string) string {
 	return name
 }
 
-// FormatDurationToFFmpegTime 将 time.Duration 格式化为 FFmpeg 的 HH:MM:SS.ms 格式
-func FormatDurationToFFmpegTime(d time.Duration) string {
-	d = d.Round(time.Millisecond) // Round to nearest millisecond
-	h := d / time.Hour
-	d -= h * time.Hour
-	m := d / time.Minute
-	d -= m * time.Minute
-	s := d / time.Second
-	d -= s * time.Second
-	ms := d / time.Millisecond
-	return fmt.Sprintf("%02d:%02d:%02d.%03d", h, m, s, ms)
-}
-
 // IsDirectory 辅助函数，检查路径是否为目录
 func IsDirectory(path string) bool {
 	info, err := os.Stat(path)
@@ -82,9 +68,10 @@ func IsDirectory(path string) bool {
 func IsRelevantMusicFile(filePath string) bool {
 	ext := strings.ToLower(filepath.Ext(filePath))
 	name := strings.ToLower(filepath.Base(filePath))
-	switch ext {
-	case ".wav", ".flac", ".mp3", ".m4a", ".aac", ".ogg", ".ape", ".wv":
+	if IsAudioFile(filePath) {
 		return true
+	}
+	switch ext {
 	case ".cue", ".json", ".jpg", ".png": // CUE文件，潜在的json元数据，图片封面
 		return true
 	default:
@@ -95,3 +82,27 @@ func IsRelevantMusicFile(filePath string) bool {
 		return false
 	}
 }
+
+// IsAudioFile 辅助函数，判断文件是否为音频文件
+func IsAudioFile(filePath string) bool {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".wav", ".flac", ".mp3", ".m4a", ".aac", ".ogg", ".ape", ".wv", ".tta", ".aiff", ".aif":
+		return true
+	default:
+		return false
+	}
+}
+
+// LosslessImageExts 是可以作为 CUE 整轨镜像的无损音频格式，按查找优先级排列
+var LosslessImageExts = []string{".wav", ".flac", ".ape", ".wv", ".tta", ".aiff", ".aif"}
+
+// IsLosslessImageFile 辅助函数，判断文件是否为可配合 CUE 切割的无损音频镜像
+func IsLosslessImageFile(filePath string) bool {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	for _, e := range LosslessImageExts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
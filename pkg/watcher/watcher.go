@@ -0,0 +1,112 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/yleoer/music/pkg/scanner"
+	"github.com/yleoer/music/pkg/util"
+)
+
+// DirWatcher 递归监听下载目录，将发生变化的专辑目录交给 onAlbum。
+// 之后新建的子目录会自动加入监听，专辑目录的层级不超过 maxDepth
+type DirWatcher struct {
+	root     string
+	maxDepth int
+	onAlbum  func(dir string)
+	fsw      *fsnotify.Watcher
+	logger   *log.Logger
+}
+
+// NewDirWatcher 创建一个新的 DirWatcher 实例，并监听 root 下已经存在的目录
+func NewDirWatcher(root string, maxDepth int, onAlbum func(dir string), logger *log.Logger) (*DirWatcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("error creating file watcher: %w", err)
+	}
+	w := &DirWatcher{
+		root:     root,
+		maxDepth: maxDepth,
+		onAlbum:  onAlbum,
+		fsw:      fsw,
+		logger:   logger,
+	}
+	if err := fsw.Add(root); err != nil {
+		fsw.Close()
+		return nil, fmt.Errorf("error adding download root path %s to watcher: %w", root, err)
+	}
+	w.addTree(root)
+	return w, nil
+}
+
+// addTree 监听 dir 及其子目录。专辑目录最深为 maxDepth 层，其光盘子目录还要再深一层
+func (w *DirWatcher) addTree(dir string) {
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			w.logger.Printf("WARN: Cannot read %s for watching: %v", path, err)
+			return nil
+		}
+		if !d.IsDir() || path == w.root {
+			return nil
+		}
+		if scanner.Depth(w.root, path) > w.maxDepth+1 {
+			return filepath.SkipDir
+		}
+		if err := w.fsw.Add(path); err != nil {
+			w.logger.Printf("WARN: Failed to watch %s: %v", path, err)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+// Run 处理文件系统事件直到 ctx 被取消或 Close 被调用
+func (w *DirWatcher) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			w.handleEvent(event)
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			w.logger.Printf("ERROR: Watcher error: %v", err)
+		}
+	}
+}
+
+// handleEvent 找出事件所属的专辑目录。新建的目录先加入监听，再查找其中已有的专辑
+// (整个目录被移入下载目录时不会再有其中文件的事件)
+func (w *DirWatcher) handleEvent(event fsnotify.Event) {
+	w.logger.Printf("Watcher event: %s, on %s", event.Op.String(), event.Name)
+	if event.Has(fsnotify.Create) && util.IsDirectory(event.Name) {
+		w.addTree(event.Name)
+		if roots := scanner.FindAlbumRoots(w.root, event.Name, w.maxDepth); len(roots) > 0 {
+			for _, dir := range roots {
+				w.logger.Printf("  -> Found album directory %s in new directory %s. Scheduling scan.", dir, event.Name)
+				w.onAlbum(dir)
+			}
+			return
+		}
+	}
+	if dir, ok := scanner.AlbumRoot(w.root, event.Name, w.maxDepth); ok {
+		w.logger.Printf("  -> Change detected in album directory %s. Scheduling rescan.", dir)
+		w.onAlbum(dir)
+		return
+	}
+	w.logger.Printf("  -> Event %s is not inside an album directory. Ignoring.", event.Name)
+}
+
+// Close 停止监听
+func (w *DirWatcher) Close() error {
+	return w.fsw.Close()
+}